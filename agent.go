@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/approval"
+	"github.com/ajeetraina/genai-app-demo/pkg/tools"
+	"github.com/openai/openai-go"
+)
+
+// agentOptions limits the tool calling loop of a chat request
+type agentOptions struct {
+	MaxIterations int           // Model turns per request; the last one gets no tools
+	Timeout       time.Duration // Whole request, including every tool call
+	ToolTimeout   time.Duration // Per tool call
+	MaxParallel   int           // Tool calls run at once
+}
+
+// toolCall is a tool call assembled from streamed deltas
+type toolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// toolCallEvent is the payload of the tool_call event
+type toolCallEvent struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Arguments interface{} `json:"arguments"` // Decoded JSON, or the raw text when the model sent invalid JSON
+}
+
+// approvalEvent is the payload of the approval_required event. The client
+// answers with POST /approvals/{approval_id}/approve or /deny.
+type approvalEvent struct {
+	ApprovalID string      `json:"approval_id"`
+	ToolCallID string      `json:"tool_call_id"`
+	Name       string      `json:"name"`
+	Arguments  interface{} `json:"arguments"`
+	ExpiresAt  time.Time   `json:"expires_at"`
+}
+
+// toolResultEvent is the payload of the tool_result event
+type toolResultEvent struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Result     string `json:"result,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// toolParams converts tools to chat completion tool definitions
+func toolParams(list []tools.Tool) []openai.ChatCompletionToolParam {
+	params := make([]openai.ChatCompletionToolParam, len(list))
+	for i, tool := range list {
+		params[i] = openai.ChatCompletionToolParam{
+			Type: openai.F(openai.ChatCompletionToolTypeFunction),
+			Function: openai.F(openai.FunctionDefinitionParam{
+				Name:        openai.F(tool.Name),
+				Description: openai.F(tool.Description),
+				Parameters:  openai.F(openai.FunctionParameters(tool.Parameters)),
+			}),
+		}
+	}
+	return params
+}
+
+// accumulateToolCalls merges streamed tool call deltas. The first delta of a
+// call carries its ID and name; later deltas append to the arguments.
+func accumulateToolCalls(calls []*toolCall, deltas []openai.ChatCompletionChunkChoicesDeltaToolCall) []*toolCall {
+	for _, delta := range deltas {
+		for int(delta.Index) >= len(calls) {
+			calls = append(calls, &toolCall{})
+		}
+		call := calls[delta.Index]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Function.Name != "" {
+			call.Name = delta.Function.Name
+		}
+		call.Arguments += delta.Function.Arguments
+	}
+	return calls
+}
+
+// assistantToolCallMessage records the model's tool calls in the history
+func assistantToolCallMessage(content string, calls []*toolCall) openai.ChatCompletionMessageParamUnion {
+	params := make([]openai.ChatCompletionMessageToolCallParam, len(calls))
+	for i, call := range calls {
+		params[i] = openai.ChatCompletionMessageToolCallParam{
+			ID:   openai.F(call.ID),
+			Type: openai.F(openai.ChatCompletionMessageToolCallTypeFunction),
+			Function: openai.F(openai.ChatCompletionMessageToolCallFunctionParam{
+				Name:      openai.F(call.Name),
+				Arguments: openai.F(call.Arguments),
+			}),
+		}
+	}
+
+	message := openai.ChatCompletionAssistantMessageParam{
+		Role:      openai.F(openai.ChatCompletionAssistantMessageParamRoleAssistant),
+		ToolCalls: openai.F(params),
+	}
+	if content != "" {
+		message.Content = openai.F([]openai.ChatCompletionAssistantMessageParamContentUnion{openai.TextPart(content)})
+	}
+	return message
+}
+
+// runTools executes the model's tool calls in parallel and returns the tool
+// messages to send back. Every call is announced with a tool_call event before
+// any of them runs; results are streamed in call order once all have finished.
+// Calls the approval policy asks about are announced with an approval_required
+// event and wait for the user's decision before running. Only the tools
+// offered to the model may run; calls to any other tool are answered with an
+// error. Failures and denials are reported to the model as the tool result so
+// it can recover.
+func (s *chatService) runTools(ctx context.Context, stream chatWriter, user string, offered map[string]bool, calls []*toolCall) []openai.ChatCompletionMessageParamUnion {
+	results := make([]toolResultEvent, len(calls))
+	approvals := make([]string, len(calls))
+	for i, call := range calls {
+		// Some servers omit IDs; the model still needs them to match results
+		if call.ID == "" {
+			call.ID = fmt.Sprintf("call_%d", i)
+		}
+		args := decodeArguments(call.Arguments)
+		stream.Event("tool_call", toolCallEvent{ID: call.ID, Name: call.Name, Arguments: args})
+
+		if !offered[call.Name] {
+			log.Printf("Model called tool %q that was not offered", call.Name)
+			results[i] = toolResultEvent{ID: call.ID, Name: call.Name, Error: fmt.Sprintf("tool %q is not available in this request", call.Name)}
+			continue
+		}
+		tool, ok := s.tools.Get(call.Name)
+		if !ok {
+			continue
+		}
+		switch s.policy.Evaluate(tool) {
+		case approval.Deny:
+			s.approvals.Reject(user, call.Name, json.RawMessage(call.Arguments))
+			results[i] = toolResultEvent{ID: call.ID, Name: call.Name, Error: "tool call denied by policy"}
+		case approval.Ask:
+			pending := s.approvals.Open(user, call.ID, call.Name, json.RawMessage(call.Arguments))
+			approvals[i] = pending.ID
+			stream.Event("approval_required", approvalEvent{
+				ApprovalID: pending.ID,
+				ToolCallID: call.ID,
+				Name:       call.Name,
+				Arguments:  args,
+				ExpiresAt:  pending.ExpiresAt,
+			})
+		}
+	}
+
+	slots := make(chan struct{}, max(s.agent.MaxParallel, 1))
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		if results[i].Error != "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Waiting for a decision does not take a slot or count towards the tool timeout
+			if approvals[i] != "" {
+				if err := s.approvals.Wait(ctx, approvals[i]); err != nil {
+					log.Printf("Tool %s not approved: %v", call.Name, err)
+					results[i] = toolResultEvent{ID: call.ID, Name: call.Name, Error: err.Error()}
+					return
+				}
+			}
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			callCtx, cancel := context.WithTimeout(ctx, s.agent.ToolTimeout)
+			defer cancel()
+
+			start := time.Now()
+			output, err := s.tools.Call(callCtx, call.Name, json.RawMessage(call.Arguments))
+			results[i] = toolResultEvent{ID: call.ID, Name: call.Name, Result: output, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				log.Printf("Tool %s failed: %v", call.Name, err)
+				results[i].Result = ""
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	messages := make([]openai.ChatCompletionMessageParamUnion, len(calls))
+	for i, result := range results {
+		stream.Event("tool_result", result)
+		content := result.Result
+		if result.Error != "" {
+			content = "Error: " + result.Error
+		}
+		messages[i] = openai.ToolMessage(result.ID, content)
+	}
+	return messages
+}
+
+// decodeArguments returns the decoded JSON arguments of a call, or the raw
+// text when the model sent invalid JSON
+func decodeArguments(arguments string) interface{} {
+	var decoded interface{}
+	if json.Unmarshal([]byte(arguments), &decoded) == nil {
+		return decoded
+	}
+	return arguments
+}
+
+// offeredTools indexes the names of the tools offered to the model
+func offeredTools(list []tools.Tool) map[string]bool {
+	offered := make(map[string]bool, len(list))
+	for _, tool := range list {
+		offered[tool.Name] = true
+	}
+	return offered
+}
+
+// toolNames lists the names of the tools, for logging
+func toolNames(list []tools.Tool) string {
+	names := make([]string, len(list))
+	for i, tool := range list {
+		names[i] = tool.Name
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,683 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/approval"
+	"github.com/ajeetraina/genai-app-demo/pkg/cache"
+	"github.com/ajeetraina/genai-app-demo/pkg/conversation"
+	"github.com/ajeetraina/genai-app-demo/pkg/identity"
+	"github.com/ajeetraina/genai-app-demo/pkg/ingest"
+	"github.com/ajeetraina/genai-app-demo/pkg/models"
+	"github.com/ajeetraina/genai-app-demo/pkg/prompts"
+	"github.com/ajeetraina/genai-app-demo/pkg/summarizer"
+	"github.com/ajeetraina/genai-app-demo/pkg/tools"
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// chatService holds the dependencies of the chat endpoints
+type chatService struct {
+	current       *atomic.Pointer[provider]
+	models        *models.Catalog
+	conversations conversation.Store
+	summaries     *summarizer.Summarizer
+	rag           *ragService
+	tools         *tools.Registry
+	agent         agentOptions
+	prompts       *prompts.Library
+	structured    structuredOptions
+	policy        approval.Policy
+	approvals     *approval.Gate
+	cache         responseCacheOptions
+	semantic      semanticCacheOptions
+	flights       *flightGroup // Coalesces identical requests; disabled when nil
+	promptCache   promptCacheOptions
+	generations   *generationRegistry // Tracks generations to cancel and resume; disabled when nil
+	heartbeat     time.Duration       // Between SSE heartbeats on an idle stream; zero disables them
+}
+
+// newStream starts streaming a reply and returns the request to generate it
+// with. Tracked generations of HTTP clients carry on when the client drops,
+// so it can resume them; framed responses such as WebSocket generations
+// have their own cancellation.
+func (s *chatService) newStream(w http.ResponseWriter, r *http.Request) (*chatStream, *http.Request) {
+	stream := newChatStream(w, r)
+	if s.generations != nil {
+		stream.gen, r = s.generations.start(w, r, stream.frames == nil)
+	}
+	return stream, r
+}
+
+// handleChat handles the chat endpoint with simple tracing
+func (s *chatService) handleChat() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Invalid request body: %v", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			requestCounter.WithLabelValues(r.Method, r.URL.Path, fmt.Sprintf("%d", http.StatusBadRequest)).Inc()
+			return
+		}
+
+		// Load the history server-side when the request belongs to a stored conversation.
+		// The new turn replies to parent_id, or to the head of the active branch.
+		history := req.Messages
+		var parentID string
+		if req.ConversationID != "" {
+			conv, ok := loadConversation(w, r, s.conversations, req.ConversationID)
+			if !ok {
+				return
+			}
+
+			parentID = conv.HeadID
+			if req.ParentID != "" {
+				parentID = req.ParentID
+			}
+			branch, err := conv.Branch(parentID)
+			if err != nil {
+				http.Error(w, "Message not found", http.StatusNotFound)
+				return
+			}
+			history = toChatMessages(branch)
+		}
+
+		// Retrieve context from the requested collections before streaming,
+		// so retrieval failures are reported with a proper status code
+		var sources []ingest.Hit
+		if len(req.Collections) > 0 {
+			var ok bool
+			sources, req.retrieved, ok = s.rag.prepare(w, r, req, history)
+			if !ok {
+				return
+			}
+		}
+
+		stream, r := s.newStream(w, r)
+		defer stream.finish()
+		reply, err := s.streamChat(stream, r, req, history)
+		if err != nil {
+			return
+		}
+		if len(req.Collections) > 0 {
+			stream.Event("citations", newCitations(reply, sources))
+		}
+		stream.Done()
+
+		// Persist the completed turn
+		if req.ConversationID != "" {
+			var turn []conversation.Message
+			if req.Message != "" {
+				turn = append(turn, conversation.Message{Role: "user", Content: req.Message})
+			}
+			turn = append(turn, conversation.Message{Role: "assistant", Content: reply})
+			saveTurn(r.Context(), s.conversations, s.summaries, req.ConversationID, parentID, turn...)
+		}
+	}
+}
+
+// branchChatRequest is the body accepted by the regenerate and edit endpoints
+type branchChatRequest struct {
+	Content string         `json:"content"`
+	Format  responseFormat `json:"format,omitempty"`
+	Model   string         `json:"model,omitempty"`
+	promptSelection
+}
+
+// handleRegenerate streams a new reply to the same user turn as an existing
+// assistant message. The new reply is stored as a sibling of that message and
+// becomes the head of the conversation.
+func (s *chatService) handleRegenerate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body branchChatRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		conv, target, history, ok := loadBranchTarget(w, r, s.conversations, "assistant")
+		if !ok {
+			return
+		}
+
+		req := ChatRequest{Format: body.Format, Model: body.Model, ConversationID: conv.ID, promptSelection: body.promptSelection, bypassCache: true}
+		stream, r := s.newStream(w, r)
+		defer stream.finish()
+		reply, err := s.streamChat(stream, r, req, history)
+		if err != nil {
+			return
+		}
+		stream.Done()
+
+		saveTurn(r.Context(), s.conversations, s.summaries, conv.ID, target.ParentID,
+			conversation.Message{Role: "assistant", Content: reply})
+	}
+}
+
+// handleEditMessage replaces a user message with new content and streams a
+// reply to it. The edited message is stored as a sibling of the original, so
+// the original branch remains available.
+func (s *chatService) handleEditMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body branchChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Content == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		conv, target, history, ok := loadBranchTarget(w, r, s.conversations, "user")
+		if !ok {
+			return
+		}
+
+		req := ChatRequest{Message: body.Content, Format: body.Format, Model: body.Model, ConversationID: conv.ID, promptSelection: body.promptSelection}
+		stream, r := s.newStream(w, r)
+		defer stream.finish()
+		reply, err := s.streamChat(stream, r, req, history)
+		if err != nil {
+			return
+		}
+		stream.Done()
+
+		saveTurn(r.Context(), s.conversations, s.summaries, conv.ID, target.ParentID,
+			conversation.Message{Role: "user", Content: body.Content},
+			conversation.Message{Role: "assistant", Content: reply})
+	}
+}
+
+// loadConversation loads a conversation for the requesting user, writing the
+// error response and returning false on failure
+func loadConversation(w http.ResponseWriter, r *http.Request, store conversation.Store, id string) (*conversation.Conversation, bool) {
+	conv, err := conversation.LoadForUser(r, store, id)
+	if errors.Is(err, conversation.ErrNotFound) {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to load conversation %s: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	w.Header().Set("X-Conversation-ID", conv.ID)
+	return conv, true
+}
+
+// loadBranchTarget resolves the {id} and {messageID} path values, checks the
+// message has the expected role and returns the history preceding it
+func loadBranchTarget(w http.ResponseWriter, r *http.Request, store conversation.Store, role string) (*conversation.Conversation, conversation.Message, []Message, bool) {
+	conv, ok := loadConversation(w, r, store, r.PathValue("id"))
+	if !ok {
+		return nil, conversation.Message{}, nil, false
+	}
+
+	target, found := conv.Message(r.PathValue("messageID"))
+	if !found {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return nil, conversation.Message{}, nil, false
+	}
+	if target.Role != role {
+		http.Error(w, fmt.Sprintf("Message is not a %s message", role), http.StatusBadRequest)
+		return nil, conversation.Message{}, nil, false
+	}
+
+	branch, err := conv.Branch(target.ParentID)
+	if err != nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return nil, conversation.Message{}, nil, false
+	}
+	return conv, target, toChatMessages(branch), true
+}
+
+// saveTurn stores the messages of a completed turn below parentID and
+// schedules a summary refresh. It runs even if the client has gone away,
+// since the reply was fully generated.
+func saveTurn(ctx context.Context, store conversation.Store, summaries *summarizer.Summarizer, conversationID, parentID string, turn ...conversation.Message) {
+	if _, err := store.AppendMessages(context.WithoutCancel(ctx), conversationID, parentID, turn...); err != nil {
+		log.Printf("Failed to save turn to conversation %s: %v", conversationID, err)
+		return
+	}
+	summaries.Enqueue(conversationID)
+}
+
+// toChatMessages converts stored messages into chat request messages
+func toChatMessages(msgs []conversation.Message) []Message {
+	history := make([]Message, 0, len(msgs))
+	for _, msg := range msgs {
+		history = append(history, Message{Role: msg.Role, Content: msg.Content})
+	}
+	return history
+}
+
+// interactiveStreams counts chat streams in flight so background work can yield to them
+var interactiveStreams atomic.Int64
+
+// streamChat sends the history plus the request's message to the model and
+// streams the reply to the client. It returns the full reply text, or an
+// error if the stream failed (in which case the response has been written).
+func (s *chatService) streamChat(stream *chatStream, r *http.Request, req ChatRequest, history []Message) (string, error) {
+	interactiveStreams.Add(1)
+	defer interactiveStreams.Add(-1)
+
+	// The whole request runs against the provider current when it started,
+	// even if the configuration changes meanwhile
+	p := s.current.Load()
+
+	// Resolve the requested model against the allowlist. Every metric below
+	// is labelled with the model actually used.
+	requested := req.Model
+	if requested == "" {
+		requested = p.DefaultModel
+	}
+	selected, err := s.models.Resolve(requested, identity.TenantID(r))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, models.ErrNotPermitted) {
+			status = http.StatusForbidden
+		}
+		stream.Error(err.Error(), status)
+		return "", err
+	}
+	model, apiBaseURL := selected.Name, p.BaseURL
+	sampling := newSamplingParams(selected.Defaults, req)
+
+	// Retrieved context usually comes first. When the server reuses its
+	// prompt cache it goes after the history instead, so the history stays
+	// a prefix the server has already evaluated.
+	promptCaching := s.promptCache.enabled(p.BaseURL)
+	if req.retrieved != "" {
+		retrieved := Message{Role: "system", Content: req.retrieved}
+		if promptCaching {
+			history = append(history[:len(history):len(history)], retrieved)
+		} else {
+			history = append([]Message{retrieved}, history...)
+		}
+	}
+
+	// Count input tokens (rough estimate)
+	inputTokens := 0
+	for _, msg := range history {
+		inputTokens += len(msg.Content) / 4 // Rough estimate
+	}
+	inputTokens += len(req.Message) / 4
+
+	// Track metrics for input tokens
+	chatTokensCounter.WithLabelValues("input", model).Add(float64(inputTokens))
+
+	start := time.Now()
+
+	var messages []openai.ChatCompletionMessageParamUnion
+	for _, msg := range history {
+		var message openai.ChatCompletionMessageParamUnion
+		switch msg.Role {
+		case "system":
+			message = openai.SystemMessage(msg.Content)
+		case "user":
+			message = openai.UserMessage(msg.Content)
+		case "assistant":
+			message = openai.AssistantMessage(msg.Content)
+		}
+
+		messages = append(messages, message)
+	}
+
+	// Check if the user is requesting markdown output
+	useMarkdown := false
+	userMessage := req.Message
+
+	// Format can be explicitly set in the request
+	if req.Format.Kind == formatMarkdown {
+		useMarkdown = true
+	}
+
+	// Or it can be detected from the message, unless the reply must be JSON
+	if !req.Format.structured() &&
+		(strings.Contains(strings.ToLower(userMessage), "in markdown") ||
+			strings.Contains(strings.ToLower(userMessage), "using markdown")) {
+		useMarkdown = true
+	}
+
+	// The system prompt comes from the selected template. Asking for
+	// markdown without a template selects the markdown template.
+	selection := req.promptSelection
+	if selection.TemplateID == "" && useMarkdown {
+		selection.TemplateID = "markdown"
+	}
+	prompt, status, err := renderPrompt(r.Context(), s.prompts, selection)
+	if err != nil {
+		log.Printf("Prompt template %s: %v", selection.TemplateID, err)
+		stream.Error(err.Error(), status)
+		return "", err
+	}
+	if prompt != nil {
+		systemMsg := openai.SystemMessage(prompt.Text)
+		messages = append([]openai.ChatCompletionMessageParamUnion{systemMsg}, messages...)
+	}
+
+	// JSON replies are asked for in the system prompt and enforced on each
+	// turn without tools
+	if req.Format.structured() {
+		systemMsg := openai.SystemMessage(req.Format.instruction())
+		messages = append([]openai.ChatCompletionMessageParamUnion{systemMsg}, messages...)
+	}
+
+	// Add the user message to the conversation. Regenerating a reply has no
+	// new message since the history already ends with the user turn.
+	if userMessage != "" {
+		messages = append(messages, openai.UserMessage(userMessage))
+	}
+
+	// Offer the requested tools. The whole tool calling loop shares one deadline.
+	ctx := r.Context()
+	var toolset []openai.ChatCompletionToolParam
+	var offered map[string]bool
+	if len(req.Tools) > 0 {
+		selected, err := s.tools.Select(req.Tools)
+		if err != nil {
+			stream.Error(err.Error(), http.StatusBadRequest)
+			return "", err
+		}
+		log.Printf("Offering tools: %s", toolNames(selected))
+		toolset = toolParams(selected)
+		offered = offeredTools(selected)
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.agent.Timeout)
+		defer cancel()
+	}
+
+	// Deterministic requests without tools are answered from the cache when
+	// an identical one has been answered before, and share the generation
+	// of an identical one in flight
+	cacheStatus, key := "bypass", ""
+	if (s.cache.Cache != nil || s.flights != nil) && len(toolset) == 0 && sampling.deterministic() && !req.bypassCache {
+		var sent []Message
+		if req.Format.structured() {
+			sent = append(sent, Message{Role: "system", Content: req.Format.instruction()})
+		}
+		if prompt != nil {
+			sent = append(sent, Message{Role: "system", Content: prompt.Text})
+		}
+		sent = append(sent, history...)
+		if userMessage != "" {
+			sent = append(sent, Message{Role: "user", Content: userMessage})
+		}
+		key = cacheKey{BaseURL: p.BaseURL, Model: model, Messages: sent, Sampling: sampling, Format: req.Format}.key()
+	}
+	if key != "" && s.cache.Cache != nil {
+		if entry, tier, ok := s.cache.Cache.Get(key); ok {
+			responseCacheCounter.WithLabelValues("hit", tier).Inc()
+			responseCacheEntries.Set(float64(s.cache.Cache.Len()))
+			tracing.AddAttributes(r.Context(), attribute.String("cache", "hit"), attribute.String("cache.tier", tier))
+			if err := serveCached(stream, r, cachedEvent{Cached: "exact"}, entry.Reply, s.cache.ReplayDelay, start); err != nil {
+				return "", err
+			}
+			return entry.Reply, nil
+		}
+		cacheStatus = "miss"
+		stream.w.Header().Set("X-Cache", "MISS")
+	}
+	// Nothing is counted while the cache is disabled
+	if s.cache.Cache != nil {
+		responseCacheCounter.WithLabelValues(cacheStatus, "").Inc()
+		tracing.AddAttributes(r.Context(), attribute.String("cache", cacheStatus))
+	}
+
+	// A single question can also be answered with the reply to a similar one
+	var semanticVector []float32
+	var scope string
+	if s.semantic.applies(r, req, history, len(toolset)) {
+		scope = semanticScope(identity.TenantID(r), model, req)
+		vectors, err := s.semantic.Embedder.Embed(r.Context(), s.semantic.EmbeddingModel, []string{userMessage})
+		if err != nil {
+			log.Printf("Skipping the semantic cache: %v", err)
+		} else {
+			semanticVector = vectors[0]
+			if entry, similarity, ok := s.semantic.Cache.Lookup(scope, semanticVector); ok {
+				tracing.AddAttributes(r.Context(),
+					attribute.String("cache", "hit"),
+					attribute.String("cache.tier", "semantic"),
+					attribute.Float64("cache.similarity", similarity),
+				)
+				event := cachedEvent{Cached: "semantic", EntryID: entry.ID, Similarity: similarity}
+				if err := serveCached(stream, r, event, entry.Reply, s.cache.ReplayDelay, start); err != nil {
+					return "", err
+				}
+				return entry.Reply, nil
+			}
+		}
+	}
+
+	// The response headers are final, so heartbeats can start sending them
+	stream.heartbeat(s.heartbeat)
+
+	// Later turns of a conversation go to the slot holding its prompt cache
+	var promptCacheOpts []option.RequestOption
+	if promptCaching {
+		slot := -1
+		if s.promptCache.Slots != nil {
+			var reused bool
+			var release func()
+			slot, reused, release = s.promptCache.Slots.assign(affinityKey(req, history, identity.UserID(r)))
+			defer release()
+			result := "assigned"
+			if reused {
+				result = "reused"
+			}
+			slotAssignmentsCounter.WithLabelValues(result).Inc()
+			tracing.AddAttributes(r.Context(), attribute.Int("llamacpp.slot", slot), attribute.Bool("llamacpp.slot_reused", reused))
+		}
+		promptCacheOpts = s.promptCache.requestOptions(slot)
+	}
+
+	// run generates the reply, streaming it to out. Coalesced requests run it
+	// once for all of them, so it records the inference metrics itself.
+	userID := identity.UserID(r)
+	run := func(ctx context.Context, out chatWriter) (string, error) {
+		modelStartTime := time.Now()
+		var firstTokenTime time.Time
+		outputTokens := 0
+
+		// Set prompt evaluation start time for llama.cpp metrics
+		promptEvalStartTime := time.Now()
+
+		var reply strings.Builder
+		var streamErr, formatErr error
+		repairs := 0
+		for iteration := 1; ; iteration++ {
+			param := openai.ChatCompletionNewParams{
+				Messages: openai.F(messages),
+				Model:    openai.F(model),
+			}
+			sampling.apply(&param)
+			// The last iteration withholds the tools so the model has to answer,
+			// and so do repairs of a structured reply
+			opts := append([]option.RequestOption(nil), promptCacheOpts...)
+			if len(toolset) > 0 && iteration < s.agent.MaxIterations && repairs == 0 {
+				param.Tools = openai.F(toolset)
+			} else if req.Format.structured() {
+				responseFormat, constraintOpts := req.Format.constraint(s.structured.grammar(p.BaseURL))
+				if responseFormat != nil {
+					param.ResponseFormat = openai.F(responseFormat)
+				}
+				opts = append(opts, constraintOpts...)
+			}
+
+			completion := p.Client.Chat.Completions.NewStreaming(ctx, param, opts...)
+			var content strings.Builder
+			var calls []*toolCall
+			// The last chunks report how much of the prompt was evaluated
+			var cachedTokens, evaluatedTokens int64
+			var reported bool
+
+			for completion.Next() {
+				chunk := completion.Current()
+				if cached, evaluated, ok := promptTokens(chunk); ok {
+					cachedTokens, evaluatedTokens, reported = cached, evaluated, true
+				}
+				if len(chunk.Choices) == 0 {
+					continue
+				}
+				delta := chunk.Choices[0].Delta
+
+				// Record first token time
+				if firstTokenTime.IsZero() && (delta.Content != "" || len(delta.ToolCalls) > 0) {
+					firstTokenTime = time.Now()
+
+					// For llama.cpp, record prompt evaluation time
+					if strings.Contains(strings.ToLower(model), "llama") ||
+						strings.Contains(apiBaseURL, "llama.cpp") {
+						promptEvalTime := firstTokenTime.Sub(promptEvalStartTime)
+						llamacppPromptEvalTime.WithLabelValues(model).Observe(promptEvalTime.Seconds())
+					}
+				}
+
+				// Stream each chunk as it arrives. Structured replies are only
+				// sent once they have been validated.
+				if delta.Content != "" {
+					outputTokens++
+					content.WriteString(delta.Content)
+					if req.Format.structured() {
+						continue
+					}
+					if err := out.Text(delta.Content); err != nil {
+						log.Printf("Error writing to stream: %v", err)
+						return "", err
+					}
+				}
+				if len(delta.ToolCalls) > 0 {
+					outputTokens++
+					calls = accumulateToolCalls(calls, delta.ToolCalls)
+				}
+			}
+			if reported {
+				promptTokensCounter.WithLabelValues(model, "cached").Add(float64(cachedTokens))
+				promptTokensCounter.WithLabelValues(model, "evaluated").Add(float64(evaluatedTokens))
+			}
+			if streamErr = completion.Err(); streamErr != nil {
+				break
+			}
+
+			if len(calls) > 0 {
+				// Run the requested tools and let the model continue with their results
+				reply.WriteString(content.String())
+				messages = append(messages, assistantToolCallMessage(content.String(), calls))
+				messages = append(messages, s.runTools(ctx, out, userID, offered, calls)...)
+				continue
+			}
+
+			if !req.Format.structured() {
+				reply.WriteString(content.String())
+				break
+			}
+
+			// Validate the final answer, asking the model to repair it on failure
+			output, err := req.Format.validate(content.String())
+			if err == nil {
+				result := "valid"
+				if repairs > 0 {
+					result = "repaired"
+				}
+				structuredOutputCounter.WithLabelValues(req.Format.Kind, result).Inc()
+				reply.Reset()
+				reply.WriteString(output)
+				if err := out.Text(output); err != nil {
+					log.Printf("Error writing to stream: %v", err)
+					return "", err
+				}
+				break
+			}
+			log.Printf("Structured reply failed validation (attempt %d): %v", repairs+1, err)
+			out.Event("validation_error", validationErrorEvent{Attempt: repairs + 1, Error: err.Error()})
+			if repairs >= s.structured.MaxRepairs {
+				structuredOutputCounter.WithLabelValues(req.Format.Kind, "invalid").Inc()
+				formatErr = err
+				break
+			}
+			repairs++
+			messages = append(messages, openai.AssistantMessage(content.String()), openai.UserMessage(repairPrompt(err)))
+		}
+
+		// Calculate tokens per second for llama.cpp metrics
+		if strings.Contains(strings.ToLower(model), "llama") ||
+			strings.Contains(apiBaseURL, "llama.cpp") {
+			totalTime := time.Since(firstTokenTime).Seconds()
+			if totalTime > 0 && outputTokens > 0 {
+				tokensPerSecond := float64(outputTokens) / totalTime
+				llamacppTokensPerSecond.WithLabelValues(model).Set(tokensPerSecond)
+			}
+		}
+
+		chatTokensCounter.WithLabelValues("output", model).Add(float64(outputTokens))
+		modelLatency.WithLabelValues(model, "inference").Observe(time.Since(modelStartTime).Seconds())
+		if prompt != nil {
+			promptTemplateLatency.WithLabelValues(prompt.labels()...).Observe(time.Since(modelStartTime).Seconds())
+		}
+
+		if !firstTokenTime.IsZero() {
+			ttft := firstTokenTime.Sub(modelStartTime).Seconds()
+			log.Printf("Time to first token: %.3f seconds", ttft)
+			firstTokenLatency.WithLabelValues(model).Observe(ttft)
+		}
+
+		if streamErr != nil {
+			log.Printf("Error in stream: %v", streamErr)
+			out.Error("Internal server error", http.StatusInternalServerError)
+			return "", streamErr
+		}
+		if formatErr != nil {
+			out.Error(fmt.Sprintf("Reply did not match the requested format: %v", formatErr), http.StatusBadGateway)
+			return "", formatErr
+		}
+
+		if key != "" && s.cache.Cache != nil && reply.Len() > 0 {
+			s.cache.Cache.Put(cache.Entry{Key: key, Model: model, Reply: reply.String()})
+			responseCacheEntries.Set(float64(s.cache.Cache.Len()))
+		}
+		return reply.String(), nil
+	}
+
+	// Identical deterministic requests in flight share one generation
+	var reply string
+	if s.flights != nil && key != "" {
+		var coalesced bool
+		reply, coalesced, err = s.flights.do(r.Context(), key, stream, run)
+		if coalesced {
+			coalescedRequestsCounter.WithLabelValues(model).Inc()
+		}
+		tracing.AddAttributes(r.Context(), attribute.Bool("coalesced", coalesced))
+	} else {
+		reply, err = run(ctx, stream)
+	}
+
+	// Record metrics
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(time.Since(start).Seconds())
+	requestCounter.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
+	if err != nil {
+		return "", err
+	}
+
+	if semanticVector != nil && reply != "" {
+		if _, err := s.semantic.Cache.Store(scope, identity.TenantID(r), userMessage, reply, semanticVector); err != nil {
+			log.Printf("Failed to store reply in the semantic cache: %v", err)
+		}
+	}
+	return reply, nil
+}
@@ -0,0 +1,26 @@
+// Command mcp-stub runs the stub MCP server from pkg/mcp/mcptest, over stdio
+// by default or over streamable HTTP with -http.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/mcp/mcptest"
+)
+
+func main() {
+	addr := flag.String("http", "", "Serve streamable HTTP on this address instead of stdio, e.g. :8765")
+	flag.Parse()
+
+	server := mcptest.NewServer()
+	if *addr != "" {
+		log.Printf("MCP stub server listening on %s", *addr)
+		log.Fatal(http.ListenAndServe(*addr, server))
+	}
+	if err := server.ServeStdio(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// flightGroup coalesces identical requests in flight: the first one starts
+// the generation and the others follow it instead of running their own
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// do streams the output of run to the request, running it only if no
+// identical request is in flight. The generation is not tied to the request
+// that started it: it runs until it finishes or every follower has gone.
+// It reports whether the request joined a generation already in flight.
+func (g *flightGroup) do(ctx context.Context, key string, stream *chatStream, run func(context.Context, chatWriter) (string, error)) (string, bool, error) {
+	g.mu.Lock()
+	f, joined := g.flights[key]
+	if !joined {
+		runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{changed: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		go func() {
+			defer cancel()
+			reply, err := run(runCtx, f)
+			g.mu.Lock()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			g.mu.Unlock()
+			f.finish(reply, err)
+		}()
+	}
+	f.followers++
+	g.mu.Unlock()
+
+	defer g.leave(key, f)
+	reply, err := f.follow(ctx, stream)
+	return reply, joined, err
+}
+
+// leave stops the generation once its last follower has gone
+func (g *flightGroup) leave(key string, f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f.followers--
+	if f.followers > 0 || f.finished() {
+		return
+	}
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	f.cancel()
+}
+
+// flight is one generation shared by coalesced requests. Its output is kept
+// so each follower streams it at its own pace, from the start: a slow client
+// holds back neither the generation nor the other clients.
+type flight struct {
+	cancel    context.CancelFunc
+	followers int // Guarded by the group's mutex
+
+	mu      sync.Mutex
+	chunks  []flightChunk
+	changed chan struct{} // Closed and replaced whenever the flight changes
+	done    bool
+	reply   string
+	err     error
+}
+
+// flightChunk is a piece of output: reply text, a named event or an error
+type flightChunk struct {
+	Event   string
+	Data    interface{}
+	Text    string
+	Message string
+	Status  int // Set for errors
+}
+
+// Text implements chatWriter
+func (f *flight) Text(content string) error {
+	f.append(flightChunk{Text: content})
+	return nil
+}
+
+// Event implements chatWriter
+func (f *flight) Event(name string, data interface{}) error {
+	f.append(flightChunk{Event: name, Data: data})
+	return nil
+}
+
+// Error implements chatWriter
+func (f *flight) Error(message string, status int) {
+	f.append(flightChunk{Message: message, Status: status})
+}
+
+func (f *flight) append(chunk flightChunk) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.chunks = append(f.chunks, chunk)
+	f.notify()
+}
+
+// finish records the result of the generation
+func (f *flight) finish(reply string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done, f.reply, f.err = true, reply, err
+	f.notify()
+}
+
+func (f *flight) finished() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.done
+}
+
+// notify wakes the followers; callers hold f.mu
+func (f *flight) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// follow writes the output to the stream as it arrives and returns the
+// result of the generation
+func (f *flight) follow(ctx context.Context, stream *chatStream) (string, error) {
+	next := 0
+	for {
+		f.mu.Lock()
+		chunks, done, changed := f.chunks[next:], f.done, f.changed
+		f.mu.Unlock()
+
+		for _, chunk := range chunks {
+			if err := writeChunk(stream, chunk); err != nil {
+				log.Printf("Error writing to stream: %v", err)
+				return "", err
+			}
+		}
+		next += len(chunks)
+		if done {
+			return f.reply, f.err
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+func writeChunk(stream *chatStream, chunk flightChunk) error {
+	switch {
+	case chunk.Status != 0:
+		stream.Error(chunk.Message, chunk.Status)
+		return nil
+	case chunk.Event != "":
+		return stream.Event(chunk.Event, chunk.Data)
+	default:
+		return stream.Text(chunk.Text)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestStream returns a chat stream for a request with the given Accept
+// header, plain text when empty, and the recorder it writes to
+func newTestStream(accept string) (*chatStream, *httptest.ResponseRecorder) {
+	r := httptest.NewRequest(http.MethodPost, "/chat", nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	return newChatStream(w, r), w
+}
+
+type flightResult struct {
+	reply  string
+	joined bool
+	err    error
+	body   string
+}
+
+// follow runs do in the background and returns its result channel
+func follow(ctx context.Context, g *flightGroup, key string, run func(context.Context, chatWriter) (string, error)) <-chan flightResult {
+	results := make(chan flightResult, 1)
+	go func() {
+		stream, w := newTestStream("")
+		reply, joined, err := g.do(ctx, key, stream, run)
+		results <- flightResult{reply: reply, joined: joined, err: err, body: w.Body.String()}
+	}()
+	return results
+}
+
+func TestFlightGroupFanOut(t *testing.T) {
+	g := newFlightGroup()
+	var runs atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	run := func(ctx context.Context, w chatWriter) (string, error) {
+		runs.Add(1)
+		w.Text("Hello, ")
+		close(started)
+		<-release
+		w.Text("world")
+		return "Hello, world", nil
+	}
+
+	first := follow(context.Background(), g, "key", run)
+	<-started
+	// A request that joins late still gets the reply from the start
+	second := follow(context.Background(), g, "key", run)
+	other := follow(context.Background(), g, "other", func(ctx context.Context, w chatWriter) (string, error) {
+		return "different", nil
+	})
+	if got := <-other; got.joined || got.reply != "different" {
+		t.Fatalf("request with another key = %+v, want its own generation", got)
+	}
+	waitFor(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.flights["key"] != nil && g.flights["key"].followers == 2
+	})
+	close(release)
+
+	for i, results := range []<-chan flightResult{first, second} {
+		got := <-results
+		if got.err != nil || got.reply != "Hello, world" || got.body != "Hello, world" {
+			t.Fatalf("follower %d = %+v, want the whole reply", i, got)
+		}
+		if got.joined != (i == 1) {
+			t.Fatalf("follower %d joined = %t", i, got.joined)
+		}
+	}
+	if got := runs.Load(); got != 1 {
+		t.Fatalf("generation ran %d times, want 1", got)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.flights) != 0 {
+		t.Fatalf("finished flights are still registered: %v", g.flights)
+	}
+}
+
+func TestFlightGroupLastFollowerCancels(t *testing.T) {
+	g := newFlightGroup()
+	started, stopped := make(chan struct{}), make(chan struct{})
+	run := func(ctx context.Context, w chatWriter) (string, error) {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+		return "", ctx.Err()
+	}
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	secondCtx, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	first := follow(firstCtx, g, "key", run)
+	<-started
+	second := follow(secondCtx, g, "key", run)
+	waitFor(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.flights["key"].followers == 2
+	})
+
+	// The request that started the generation leaving does not stop it
+	cancelFirst()
+	if got := <-first; !errors.Is(got.err, context.Canceled) {
+		t.Fatalf("first follower err = %v, want context.Canceled", got.err)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("generation stopped while a follower remained")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The last one leaving does
+	cancelSecond()
+	<-second
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("generation kept running after every follower left")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.flights) != 0 {
+		t.Fatalf("abandoned flight is still registered: %v", g.flights)
+	}
+}
+
+func TestFlightGroupErrors(t *testing.T) {
+	g := newFlightGroup()
+	stream, w := newTestStream("text/event-stream")
+	_, _, err := g.do(context.Background(), "key", stream, func(ctx context.Context, cw chatWriter) (string, error) {
+		cw.Error("model unavailable", http.StatusBadGateway)
+		return "", errors.New("model unavailable")
+	})
+	if err == nil || err.Error() != "model unavailable" {
+		t.Fatalf("err = %v, want the generation's error", err)
+	}
+	// Nothing was streamed yet, so the follower answers with the status
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", w.Code)
+	}
+}
+
+// waitFor polls until cond holds, failing the test after a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/openai/openai-go"
+)
+
+// openAICompleter implements summarizer.Completer with a non-streaming chat
+// completion against the current provider
+type openAICompleter struct {
+	current   *atomic.Pointer[provider]
+	model     string // Defaults to the provider's default model
+	maxTokens int64
+}
+
+// Complete sends a system prompt and a single user prompt to the model
+func (c *openAICompleter) Complete(ctx context.Context, system, prompt string) (string, error) {
+	p := c.current.Load()
+	model := c.model
+	if model == "" {
+		model = p.DefaultModel
+	}
+
+	completion, err := p.Client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(system),
+			openai.UserMessage(prompt),
+		}),
+		Model:     openai.F(model),
+		MaxTokens: openai.F(c.maxTokens),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 {
+		return "", errors.New("model returned no choices")
+	}
+
+	chatTokensCounter.WithLabelValues("input", model).Add(float64(completion.Usage.PromptTokens))
+	chatTokensCounter.WithLabelValues("output", model).Add(float64(completion.Usage.CompletionTokens))
+	return completion.Choices[0].Message.Content, nil
+}
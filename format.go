@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/jsonschema"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
+)
+
+// Kinds of response format
+const (
+	formatMarkdown = "markdown"
+	formatJSON     = "json"        // Any JSON object
+	formatSchema   = "json_schema" // JSON matching a schema
+)
+
+// responseFormat is the format field of a chat request: "markdown", "json",
+// or a JSON Schema object the reply must match
+type responseFormat struct {
+	Kind   string
+	Schema jsonschema.Schema // Set when Kind is formatSchema
+}
+
+// UnmarshalJSON accepts a format name or a schema object
+func (f *responseFormat) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		switch name {
+		case "", formatMarkdown, formatJSON:
+			f.Kind = name
+			return nil
+		}
+		return fmt.Errorf("unknown format %q", name)
+	}
+
+	var schema jsonschema.Schema
+	if err := json.Unmarshal(data, &schema); err != nil || schema == nil {
+		return errors.New(`format must be "markdown", "json" or a JSON Schema object`)
+	}
+	f.Kind, f.Schema = formatSchema, schema
+	return nil
+}
+
+// structured reports whether the reply must be JSON
+func (f responseFormat) structured() bool {
+	return f.Kind == formatJSON || f.Kind == formatSchema
+}
+
+// schema returns the schema the reply is validated against
+func (f responseFormat) schema() jsonschema.Schema {
+	if f.Kind == formatSchema {
+		return f.Schema
+	}
+	return jsonschema.Schema{"type": "object"}
+}
+
+// structuredOptions configures JSON replies
+type structuredOptions struct {
+	Mode       string // "grammar", "response_format", or "auto" for a grammar on llama.cpp only
+	MaxRepairs int    // Extra attempts after a reply fails validation
+}
+
+// grammar reports whether replies from the server at baseURL are constrained
+// with a llama.cpp grammar rather than response_format
+func (o structuredOptions) grammar(baseURL string) bool {
+	return o.Mode == "grammar" || (o.Mode == "auto" && strings.Contains(baseURL, "llama.cpp"))
+}
+
+// instruction is the system prompt asking the model for JSON. Backends that
+// ignore response_format still get told what to produce.
+func (f responseFormat) instruction() string {
+	if f.Kind == formatSchema {
+		schema, _ := json.Marshal(f.Schema)
+		return "Reply with only a JSON value that matches this JSON Schema, without any other text or code fences:\n" + string(schema)
+	}
+	return "Reply with only a JSON object, without any other text or code fences."
+}
+
+// constraint returns how a completion is held to the format: a
+// response_format parameter, or a llama.cpp grammar sent as an extra field
+func (f responseFormat) constraint(grammar bool) (openai.ChatCompletionNewParamsResponseFormatUnion, []option.RequestOption) {
+	if grammar {
+		gbnf, err := jsonschema.Grammar(f.schema())
+		if err != nil {
+			// Still constrain the reply to JSON; validation catches the rest
+			log.Printf("Cannot convert the schema to a grammar, using a JSON object grammar: %v", err)
+			gbnf, _ = jsonschema.Grammar(nil)
+		}
+		return nil, []option.RequestOption{option.WithJSONSet("grammar", gbnf)}
+	}
+
+	if f.Kind == formatSchema {
+		return shared.ResponseFormatJSONSchemaParam{
+			Type: openai.F(shared.ResponseFormatJSONSchemaTypeJSONSchema),
+			JSONSchema: openai.F(shared.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   openai.F("response"),
+				Schema: openai.F[interface{}](f.Schema),
+			}),
+		}, nil
+	}
+	return shared.ResponseFormatJSONObjectParam{
+		Type: openai.F(shared.ResponseFormatJSONObjectTypeJSONObject),
+	}, nil
+}
+
+// validate checks a reply against the format and returns it without the
+// whitespace and code fences models tend to add around JSON
+func (f responseFormat) validate(reply string) (string, error) {
+	cleaned := strings.TrimSpace(reply)
+	if strings.HasPrefix(cleaned, "```") && strings.HasSuffix(cleaned, "```") {
+		cleaned = strings.TrimSuffix(cleaned, "```")
+		if newline := strings.IndexByte(cleaned, '\n'); newline >= 0 {
+			cleaned = cleaned[newline+1:]
+		}
+		cleaned = strings.TrimSpace(cleaned)
+	}
+	return cleaned, jsonschema.ValidateJSON(f.schema(), []byte(cleaned))
+}
+
+// repairPrompt asks the model to fix a reply that failed validation
+func repairPrompt(err error) string {
+	return fmt.Sprintf("Your reply did not match the required format: %v. Reply again with only the corrected JSON, without any other text.", err)
+}
+
+// validationErrorEvent is the payload of the validation_error event
+type validationErrorEvent struct {
+	Attempt int    `json:"attempt"`
+	Error   string `json:"error"`
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/identity"
+	"github.com/google/uuid"
+)
+
+// Causes a generation is cancelled with, reported to its clients
+var (
+	errGenerationCancelled = errors.New("generation cancelled")
+	errGenerationAbandoned = errors.New("generation abandoned after the client disconnected")
+)
+
+// Generation outcomes
+const (
+	outcomeCompleted = "completed"
+	outcomeFailed    = "failed"
+	outcomeCancelled = "cancelled"
+)
+
+// generationOptions configures generation tracking
+type generationOptions struct {
+	BufferSize   int           // Events kept per generation for clients that resume
+	ResumeWindow time.Duration // How long a generation waits for its client to come back, and is kept once it ends
+}
+
+// generationRegistry tracks the chat generations in flight, so they can be
+// cancelled from anywhere and resumed after a dropped connection
+type generationRegistry struct {
+	opts generationOptions
+
+	mu          sync.Mutex
+	generations map[string]*generation
+}
+
+func newGenerationRegistry(opts generationOptions) *generationRegistry {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1024
+	}
+	return &generationRegistry{opts: opts, generations: make(map[string]*generation)}
+}
+
+// generationEvent is an SSE event a generation emitted
+type generationEvent struct {
+	ID      int
+	Name    string
+	Payload []byte
+}
+
+// generation is one chat reply being generated
+type generation struct {
+	ID   string
+	User string
+
+	registry *generationRegistry
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	done     chan struct{} // Closed when the generation ends
+
+	mu       sync.Mutex
+	events   []generationEvent // The latest, up to the buffer size
+	changed  chan struct{}     // Closed and replaced whenever events are added or the generation ends
+	finished bool
+	clients  int         // Clients streaming the generation
+	abandon  *time.Timer // Cancels the generation once no client is left
+}
+
+// start registers a generation for a chat request and returns the request
+// to run it with. When detach is set the generation outlives the client's
+// connection for the resume window, so the client can pick it up again.
+func (g *generationRegistry) start(w http.ResponseWriter, r *http.Request, detach bool) (*generation, *http.Request) {
+	parent := r.Context()
+	if detach {
+		parent = context.WithoutCancel(parent)
+	}
+	ctx, cancel := context.WithCancelCause(parent)
+	gen := &generation{
+		ID:       uuid.NewString(),
+		User:     identity.UserID(r),
+		registry: g,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		changed:  make(chan struct{}),
+		clients:  1,
+	}
+	g.mu.Lock()
+	g.generations[gen.ID] = gen
+	g.mu.Unlock()
+	w.Header().Set("X-Generation-ID", gen.ID)
+
+	if detach {
+		go func() {
+			select {
+			case <-r.Context().Done():
+				gen.detach()
+			case <-gen.done:
+			}
+		}()
+	}
+	return gen, r.WithContext(ctx)
+}
+
+// lookup returns a generation of the requesting user
+func (g *generationRegistry) lookup(r *http.Request) (*generation, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	gen, ok := g.generations[r.PathValue("id")]
+	if !ok || gen.User != identity.UserID(r) {
+		return nil, false
+	}
+	return gen, true
+}
+
+// record keeps an event, dropping the oldest beyond the buffer size
+func (gen *generation) record(id int, name string, payload []byte) {
+	gen.mu.Lock()
+	defer gen.mu.Unlock()
+	gen.events = append(gen.events, generationEvent{ID: id, Name: name, Payload: payload})
+	if over := len(gen.events) - gen.registry.opts.BufferSize; over > 0 {
+		gen.events = gen.events[over:]
+	}
+	gen.notify()
+}
+
+// notify wakes the clients; callers hold gen.mu
+func (gen *generation) notify() {
+	close(gen.changed)
+	gen.changed = make(chan struct{})
+}
+
+// attach counts a client that resumed the generation
+func (gen *generation) attach() {
+	gen.mu.Lock()
+	defer gen.mu.Unlock()
+	gen.clients++
+	if gen.abandon != nil {
+		gen.abandon.Stop()
+		gen.abandon = nil
+	}
+}
+
+// detach counts a client that went away before the generation ended. Once
+// none is left, the generation is cancelled unless one resumes in time.
+func (gen *generation) detach() {
+	gen.mu.Lock()
+	defer gen.mu.Unlock()
+	gen.clients--
+	if gen.finished {
+		return
+	}
+	generationDisconnectsCounter.Inc()
+	log.Printf("Client disconnected from generation %s", gen.ID)
+	if gen.clients > 0 || gen.abandon != nil {
+		return
+	}
+	gen.abandon = time.AfterFunc(gen.registry.opts.ResumeWindow, func() {
+		gen.cancel(errGenerationAbandoned)
+	})
+}
+
+// cancelled returns why the generation was cancelled, or nil
+func (gen *generation) cancelled() error {
+	if gen.ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(gen.ctx)
+}
+
+// finish records how the generation ended and keeps it for the resume
+// window so clients that lost the end can still fetch it
+func (gen *generation) finish(outcome string) {
+	if cause := gen.cancelled(); cause != nil {
+		outcome = outcomeCancelled
+		reason := "client"
+		switch {
+		case errors.Is(cause, errGenerationCancelled):
+			reason = "api"
+		case errors.Is(cause, errGenerationAbandoned):
+			reason = "disconnect"
+		}
+		generationCancellationsCounter.WithLabelValues(reason).Inc()
+		log.Printf("Generation %s was cancelled: %v", gen.ID, cause)
+	}
+	generationsCounter.WithLabelValues(outcome).Inc()
+
+	gen.mu.Lock()
+	gen.finished = true
+	if gen.abandon != nil {
+		gen.abandon.Stop()
+		gen.abandon = nil
+	}
+	gen.notify()
+	gen.mu.Unlock()
+	close(gen.done)
+	gen.cancel(nil)
+
+	time.AfterFunc(gen.registry.opts.ResumeWindow, func() {
+		gen.registry.mu.Lock()
+		delete(gen.registry.generations, gen.ID)
+		gen.registry.mu.Unlock()
+	})
+}
+
+// Register adds the generation routes to the mux
+func (g *generationRegistry) Register(mux *http.ServeMux) {
+	mux.HandleFunc("DELETE /generations/{id}", g.handleCancel)
+	mux.HandleFunc("GET /generations/{id}/events", g.handleEvents)
+}
+
+// handleCancel stops a generation, such as from another tab
+func (g *generationRegistry) handleCancel(w http.ResponseWriter, r *http.Request) {
+	gen, ok := g.lookup(r)
+	if !ok {
+		http.Error(w, "Generation not found", http.StatusNotFound)
+		return
+	}
+	gen.mu.Lock()
+	finished := gen.finished
+	gen.mu.Unlock()
+	if finished {
+		http.Error(w, "Generation has already finished", http.StatusConflict)
+		return
+	}
+	gen.cancel(errGenerationCancelled)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEvents streams a generation's events as SSE, starting after the
+// Last-Event-ID header so a client that lost its connection can resume
+func (g *generationRegistry) handleEvents(w http.ResponseWriter, r *http.Request) {
+	gen, ok := g.lookup(r)
+	if !ok {
+		http.Error(w, "Generation not found", http.StatusNotFound)
+		return
+	}
+	last := 0
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		var err error
+		if last, err = strconv.Atoi(header); err != nil || last < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	gen.mu.Lock()
+	expired := len(gen.events) > 0 && gen.events[0].ID > last+1
+	gen.mu.Unlock()
+	if expired {
+		generationResumesCounter.WithLabelValues("expired").Inc()
+		http.Error(w, fmt.Sprintf("Events after %d are no longer buffered", last), http.StatusGone)
+		return
+	}
+	generationResumesCounter.WithLabelValues("resumed").Inc()
+
+	gen.attach()
+	defer gen.detach()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		gen.mu.Lock()
+		var pending []generationEvent
+		start := 0
+		if len(gen.events) > 0 {
+			start = last + 1 - gen.events[0].ID
+			if start >= 0 && start < len(gen.events) {
+				pending = append(pending, gen.events[start:]...)
+			}
+		}
+		finished, changed := gen.finished, gen.changed
+		gen.mu.Unlock()
+
+		// Events were dropped while this client lagged; it can resume and
+		// learn they are gone
+		if start < 0 {
+			return
+		}
+
+		for _, event := range pending {
+			if err := writeEvent(w, event.ID, event.Name, event.Payload); err != nil {
+				countStreamTimeout(r.Pattern, err)
+				return
+			}
+			last = event.ID
+		}
+		if flusher != nil && len(pending) > 0 {
+			flusher.Flush()
+		}
+		if finished {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one SSE event
+func writeEvent(w io.Writer, id int, name string, payload []byte) error {
+	event := fmt.Sprintf("id: %d\n", id)
+	if name != "" {
+		event += fmt.Sprintf("event: %s\n", name)
+	}
+	event += fmt.Sprintf("data: %s\n\n", payload)
+	_, err := io.WriteString(w, event)
+	return err
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startGeneration starts a tracked SSE chat reply for alice and returns its
+// stream and the request the reply runs with
+func startGeneration(ctx context.Context, registry *generationRegistry) (*chatStream, *http.Request) {
+	r := httptest.NewRequest(http.MethodPost, "/chat", nil).WithContext(ctx)
+	r.Header.Set("Accept", "text/event-stream")
+	r.Header.Set("X-User-ID", "alice")
+	stream := newChatStream(httptest.NewRecorder(), r)
+	stream.gen, r = registry.start(stream.w, r, true)
+	return stream, r
+}
+
+// serveGenerations sends a request to the generation routes as the user
+func serveGenerations(registry *generationRegistry, method, path, user, lastEventID string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	registry.Register(mux)
+	r := httptest.NewRequest(method, path, nil)
+	r.Header.Set("X-User-ID", user)
+	if lastEventID != "" {
+		r.Header.Set("Last-Event-ID", lastEventID)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+// eventIDs returns the IDs of the SSE events in a body
+func eventIDs(body string) []string {
+	var ids []string
+	for _, line := range strings.Split(body, "\n") {
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestGenerationResume(t *testing.T) {
+	registry := newGenerationRegistry(generationOptions{BufferSize: 3, ResumeWindow: time.Minute})
+	stream, _ := startGeneration(context.Background(), registry)
+	id := stream.gen.ID
+	path := "/generations/" + id + "/events"
+
+	stream.Text("Hello")
+	// A client resuming mid-reply gets what it missed, then the rest as it comes
+	resumed := make(chan *httptest.ResponseRecorder)
+	go func() { resumed <- serveGenerations(registry, http.MethodGet, path, "alice", "1") }()
+	waitFor(t, func() bool {
+		stream.gen.mu.Lock()
+		defer stream.gen.mu.Unlock()
+		return stream.gen.clients == 2
+	})
+	stream.Text(", world")
+	stream.Done()
+	stream.finish()
+
+	w := <-resumed
+	if got := strings.Join(eventIDs(w.Body.String()), ","); w.Code != http.StatusOK || got != "2,3,4" {
+		t.Fatalf("resume after 1 = %d with events %s, want 200 with 2,3,4:\n%s", w.Code, got, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "event: done") {
+		t.Fatalf("resumed stream lacks the done event:\n%s", w.Body)
+	}
+
+	// The buffer holds the last 3 events, so resuming from the start is too late
+	if w := serveGenerations(registry, http.MethodGet, path, "alice", ""); w.Code != http.StatusGone {
+		t.Fatalf("resume from the start = %d, want 410", w.Code)
+	}
+	if w := serveGenerations(registry, http.MethodGet, path, "alice", "x"); w.Code != http.StatusBadRequest {
+		t.Fatalf("resume with an invalid Last-Event-ID = %d, want 400", w.Code)
+	}
+	// Generations are private to their user
+	if w := serveGenerations(registry, http.MethodGet, path, "bob", "1"); w.Code != http.StatusNotFound {
+		t.Fatalf("resume as bob = %d, want 404", w.Code)
+	}
+}
+
+func TestGenerationExpiry(t *testing.T) {
+	registry := newGenerationRegistry(generationOptions{ResumeWindow: 20 * time.Millisecond})
+	stream, _ := startGeneration(context.Background(), registry)
+	stream.Text("Hello")
+	stream.Done()
+	stream.finish()
+	path := "/generations/" + stream.gen.ID + "/events"
+
+	if w := serveGenerations(registry, http.MethodGet, path, "alice", ""); w.Code != http.StatusOK || len(eventIDs(w.Body.String())) != 3 {
+		t.Fatalf("fetch of a finished generation = %d:\n%s", w.Code, w.Body)
+	}
+	// It is forgotten once the resume window has passed
+	waitFor(t, func() bool {
+		return serveGenerations(registry, http.MethodGet, path, "alice", "").Code == http.StatusNotFound
+	})
+}
+
+func TestGenerationCancel(t *testing.T) {
+	registry := newGenerationRegistry(generationOptions{ResumeWindow: time.Minute})
+	stream, r := startGeneration(context.Background(), registry)
+	path := "/generations/" + stream.gen.ID
+
+	if w := serveGenerations(registry, http.MethodDelete, path, "bob", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("cancel as bob = %d, want 404", w.Code)
+	}
+	if w := serveGenerations(registry, http.MethodDelete, path, "alice", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("cancel = %d, want 204", w.Code)
+	}
+	if !errors.Is(context.Cause(r.Context()), errGenerationCancelled) {
+		t.Fatalf("request cause = %v, want errGenerationCancelled", context.Cause(r.Context()))
+	}
+
+	// The error the cancellation causes is reported as the cancellation
+	stream.Text("partial")
+	stream.Error("context canceled", http.StatusInternalServerError)
+	stream.finish()
+	w := serveGenerations(registry, http.MethodGet, path+"/events", "alice", "")
+	if !strings.Contains(w.Body.String(), `"message":"generation cancelled"`) {
+		t.Fatalf("events lack the cancellation:\n%s", w.Body)
+	}
+	if w := serveGenerations(registry, http.MethodDelete, path, "alice", ""); w.Code != http.StatusConflict {
+		t.Fatalf("cancel of a finished generation = %d, want 409", w.Code)
+	}
+}
+
+func TestGenerationAbandon(t *testing.T) {
+	registry := newGenerationRegistry(generationOptions{ResumeWindow: 200 * time.Millisecond})
+
+	// A client that resumes in time keeps the generation going
+	clientCtx, disconnect := context.WithCancel(context.Background())
+	stream, r := startGeneration(clientCtx, registry)
+	stream.Text("Hello")
+	disconnect()
+	waitFor(t, func() bool {
+		stream.gen.mu.Lock()
+		defer stream.gen.mu.Unlock()
+		return stream.gen.clients == 0
+	})
+	resumeCtx, leave := context.WithCancel(context.Background())
+	resumed := make(chan struct{})
+	go func() {
+		defer close(resumed)
+		mux := http.NewServeMux()
+		registry.Register(mux)
+		req := httptest.NewRequest(http.MethodGet, "/generations/"+stream.gen.ID+"/events", nil).WithContext(resumeCtx)
+		req.Header.Set("X-User-ID", "alice")
+		req.Header.Set("Last-Event-ID", "2")
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	time.Sleep(300 * time.Millisecond)
+	if r.Context().Err() != nil {
+		t.Fatal("generation was cancelled while a client had resumed it")
+	}
+
+	// Once the last client goes, it is cancelled after the resume window
+	leave()
+	<-resumed
+	select {
+	case <-r.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("abandoned generation was not cancelled")
+	}
+	if !errors.Is(context.Cause(r.Context()), errGenerationAbandoned) {
+		t.Fatalf("cause = %v, want errGenerationAbandoned", context.Cause(r.Context()))
+	}
+	stream.finish()
+}
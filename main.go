@@ -3,24 +3,33 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/ajeetraina/genai-app-demo/pkg/approval"
+	"github.com/ajeetraina/genai-app-demo/pkg/cache"
+	"github.com/ajeetraina/genai-app-demo/pkg/conversation"
+	"github.com/ajeetraina/genai-app-demo/pkg/health"
+	"github.com/ajeetraina/genai-app-demo/pkg/ingest"
+	"github.com/ajeetraina/genai-app-demo/pkg/mcp"
 	"github.com/ajeetraina/genai-app-demo/pkg/middleware"
+	"github.com/ajeetraina/genai-app-demo/pkg/models"
+	"github.com/ajeetraina/genai-app-demo/pkg/prompts"
+	"github.com/ajeetraina/genai-app-demo/pkg/summarizer"
+	"github.com/ajeetraina/genai-app-demo/pkg/tools"
 	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"github.com/openai/openai-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	dto "github.com/prometheus/client_model/go"
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
 )
 
 // Create a custom registry for metrics
@@ -33,13 +42,26 @@ type Message struct {
 }
 
 type ChatRequest struct {
-	Messages []Message `json:"messages"`
-	Message  string    `json:"message"`
-	Format   string    `json:"format,omitempty"` // Optional format parameter
+	Messages       []Message `json:"messages"`
+	Message        string    `json:"message"`
+	Format         responseFormat `json:"format,omitempty"`     // "markdown", "json" or a JSON Schema the reply must match
+	ConversationID string    `json:"conversation_id,omitempty"` // Load history from the conversation store
+	ParentID       string    `json:"parent_id,omitempty"`       // Reply to this stored message instead of the head
+	Collections    []string  `json:"collections,omitempty"`     // Ground the reply in these document collections
+	TopK           int       `json:"top_k,omitempty"`           // Number of chunks to retrieve across the collections
+	Tools          []string  `json:"tools,omitempty"`           // Tools the model may call; "*" offers every tool
+	Model          string    `json:"model,omitempty"`           // Allowlisted model name or alias; the default model otherwise
+	Temperature    *float64  `json:"temperature,omitempty"`     // Overrides the model's default temperature
+	Seed           *int64    `json:"seed,omitempty"`            // Fixed sampling seed for reproducible replies
+	promptSelection
+
+	bypassCache bool   // Set when regenerating, which asks for a new reply
+	retrieved   string // System prompt with the context retrieved from the collections
 }
 
 type MetricLog struct {
 	MessageID      string  `json:"message_id"`
+	Model          string  `json:"model,omitempty"` // Model that produced the message; the default model otherwise
 	TokensIn       int     `json:"tokens_in"`
 	TokensOut      int     `json:"tokens_out"`
 	ResponseTimeMs float64 `json:"response_time_ms"`
@@ -62,6 +84,7 @@ type LlamaCppMetrics struct {
 	ThreadsUsed     int     `json:"threads_used"`
 	BatchSize       int     `json:"batch_size"`
 	ModelType       string  `json:"model_type"`
+	Model           string  `json:"model,omitempty"` // Model the metrics belong to; the default model otherwise
 }
 
 // MetricsSummary represents the summary metrics sent to the frontend
@@ -186,6 +209,308 @@ var (
 		},
 		[]string{"model"},
 	)
+
+	promptTokensCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_llamacpp_prompt_tokens_total",
+			Help: "Prompt tokens by source: cached (reused from the slot's prompt cache) or evaluated",
+		},
+		[]string{"model", "source"},
+	)
+
+	slotAssignmentsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_llamacpp_slot_assignments_total",
+			Help: "llama.cpp slot assignments by result: reused (the conversation's slot) or assigned (a new slot)",
+		},
+		[]string{"result"},
+	)
+
+	// CORS rejection metric
+	corsRejectedCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_cors_rejected_total",
+			Help: "Total number of cross-origin requests rejected by the CORS policy",
+		},
+		[]string{"reason"},
+	)
+
+	// Background summarization metrics
+	summarizerJobsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_summarizer_jobs_total",
+			Help: "Total number of conversation summarization jobs by result",
+		},
+		[]string{"result"},
+	)
+
+	summarizerQueueDepth = promautoFactory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "genai_app_summarizer_queue_depth",
+			Help: "Number of conversations waiting to be summarized",
+		},
+	)
+
+	// Document ingestion metrics
+	ingestDocumentsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_ingest_documents_total",
+			Help: "Total number of documents ingested by format and result",
+		},
+		[]string{"format", "result"},
+	)
+
+	ingestChunksCounter = promautoFactory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "genai_app_ingest_chunks_total",
+			Help: "Total number of chunks embedded during ingestion",
+		},
+	)
+
+	embeddingDuration = promautoFactory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_embedding_duration_seconds",
+			Help:    "Embedding request duration in seconds",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+		},
+		[]string{"model"},
+	)
+
+	// Retrieval metrics
+	retrievalLatency = promautoFactory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_retrieval_latency_seconds",
+			Help:    "Retrieval latency per collection in seconds, including query embedding",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2},
+		},
+		[]string{"collection"},
+	)
+
+	retrievalHitsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_retrieval_hits_total",
+			Help: "Total number of chunks retrieved per collection",
+		},
+		[]string{"collection"},
+	)
+
+	// Tool calling metrics
+	toolCallsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_tool_calls_total",
+			Help: "Total number of tool calls by tool and result",
+		},
+		[]string{"tool", "result"},
+	)
+
+	toolDuration = promautoFactory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_tool_duration_seconds",
+			Help:    "Tool call duration in seconds",
+			Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30},
+		},
+		[]string{"tool"},
+	)
+
+	// Prompt template metrics
+	promptTemplateCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_prompt_template_requests_total",
+			Help: "Total number of chat requests by prompt template and version",
+		},
+		[]string{"template", "version"},
+	)
+
+	promptTemplateLatency = promautoFactory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_prompt_template_latency_seconds",
+			Help:    "Model latency in seconds by prompt template and version",
+			Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 20, 30, 60},
+		},
+		[]string{"template", "version"},
+	)
+
+	// Structured output metrics
+	structuredOutputCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_structured_output_total",
+			Help: "Total number of structured replies by format and validation result",
+		},
+		[]string{"format", "result"},
+	)
+
+	// Startup metrics
+	modelWarmupDuration = promautoFactory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "genai_app_model_warmup_seconds",
+			Help: "Duration of the startup warm-up completion, including the time to load the model",
+		},
+		[]string{"model"},
+	)
+
+	readyGauge = promautoFactory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "genai_app_ready",
+			Help: "1 once the startup warm-up has succeeded",
+		},
+	)
+
+	// Health check metrics
+	healthCheckStatus = promautoFactory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "genai_app_health_check_status",
+			Help: "Result of the last run of a health check: 1 healthy, 0 failing",
+		},
+		[]string{"check"},
+	)
+
+	healthCheckDuration = promautoFactory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_health_check_duration_seconds",
+			Help:    "Duration of health check runs in seconds",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2},
+		},
+		[]string{"check"},
+	)
+
+	// Response cache metrics
+	responseCacheCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_response_cache_requests_total",
+			Help: "Chat requests by response cache result (hit, miss or bypass) and the tier hits came from",
+		},
+		[]string{"result", "tier"},
+	)
+
+	responseCacheEntries = promautoFactory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "genai_app_response_cache_entries",
+			Help: "Replies held in the in-memory tier of the response cache",
+		},
+	)
+
+	semanticCacheLookups = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_semantic_cache_lookups_total",
+			Help: "Semantic cache lookups by result (hit or miss)",
+		},
+		[]string{"result"},
+	)
+
+	semanticCacheFeedback = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_semantic_cache_feedback_total",
+			Help: "Feedback on semantic cache hits by verdict (correct or incorrect)",
+		},
+		[]string{"verdict"},
+	)
+
+	semanticCacheSimilarity = promautoFactory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_semantic_cache_similarity",
+			Help:    "Cosine similarity of semantic cache hits",
+			Buckets: []float64{0.8, 0.85, 0.9, 0.92, 0.94, 0.96, 0.98, 0.99, 1},
+		},
+	)
+
+	coalescedRequestsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_coalesced_requests_total",
+			Help: "Chat requests that followed an identical generation already in flight instead of running their own",
+		},
+		[]string{"model"},
+	)
+
+	// WebSocket chat metrics
+	wsConnectionsGauge = promautoFactory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "genai_app_websocket_connections",
+			Help: "Open chat WebSocket connections",
+		},
+	)
+
+	wsMessagesCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_websocket_messages_total",
+			Help: "Chat WebSocket messages by direction (in or out) and type",
+		},
+		[]string{"direction", "type"},
+	)
+
+	// Generation metrics
+	generationsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_generations_total",
+			Help: "Chat generations by outcome (completed, failed or cancelled)",
+		},
+		[]string{"outcome"},
+	)
+
+	generationCancellationsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_generation_cancellations_total",
+			Help: "Cancelled chat generations by reason (api, disconnect or client)",
+		},
+		[]string{"reason"},
+	)
+
+	generationDisconnectsCounter = promautoFactory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "genai_app_generation_disconnects_total",
+			Help: "Clients that disconnected from a chat generation before it ended",
+		},
+	)
+
+	generationResumesCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_generation_resumes_total",
+			Help: "Requests to resume a chat generation by result (resumed or expired)",
+		},
+		[]string{"result"},
+	)
+
+	streamTimeoutsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_stream_timeouts_total",
+			Help: "Streamed responses cut off because their write deadline passed, by route",
+		},
+		[]string{"route"},
+	)
+
+	// Runtime configuration metrics
+	configVersionGauge = promautoFactory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "genai_app_config_version",
+			Help: "Version of the runtime provider configuration, incremented on every change",
+		},
+	)
+
+	// Tool approval metrics
+	approvalDecisionsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_tool_approvals_total",
+			Help: "Total number of tool call approval decisions by outcome",
+		},
+		[]string{"outcome"},
+	)
+
+	// MCP client metrics
+	mcpRequestsCounter = promautoFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "genai_app_mcp_requests_total",
+			Help: "Total number of MCP requests by server, method and result",
+		},
+		[]string{"server", "method", "result"},
+	)
+
+	mcpRequestDuration = promautoFactory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "genai_app_mcp_request_duration_seconds",
+			Help:    "MCP request duration in seconds",
+			Buckets: []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30},
+		},
+		[]string{"server", "method"},
+	)
 )
 
 // Helper function to get counter value
@@ -318,6 +643,28 @@ func main() {
 	model := os.Getenv("MODEL")
 	apiKey := os.Getenv("API_KEY")
 
+	// Models requests may select. MODEL is the default unless the allowlist
+	// names another.
+	modelCatalog, err := models.LoadCatalog(getEnvOrDefault("MODELS_CONFIG", "models.json"), model)
+	if err != nil {
+		log.Fatalf("Failed to load model allowlist: %v", err)
+	}
+	if defaultModel, ok := modelCatalog.Default(); ok {
+		model = defaultModel.Name
+	}
+
+	// metricsModel resolves the model named by a metrics request, so labels
+	// only ever hold allowlisted model names
+	metricsModel := func(requested string) string {
+		if m, ok := modelCatalog.Lookup(requested); ok {
+			return m.Name
+		}
+		if m, ok := modelCatalog.Default(); ok {
+			return m.Name
+		}
+		return model
+	}
+
 	// Tracing setup
 	tracingEnabled, _ := strconv.ParseBool(getEnvOrDefault("TRACING_ENABLED", "false"))
 	var tracingCleanup func()
@@ -336,40 +683,298 @@ func main() {
 		}
 	}
 
-	// Create OpenAI client
-	client := openai.NewClient(
-		option.WithBaseURL(baseURL),
-		option.WithAPIKey(apiKey),
+	// Create the OpenAI client. The provider can be switched at runtime
+	// through the admin endpoint.
+	var current atomic.Pointer[provider]
+	current.Store(newProvider(1, baseURL, apiKey, model, ""))
+	configVersionGauge.Set(1)
+
+	// Create conversation store
+	conversationStore, err := conversation.NewStore(
+		getEnvOrDefault("CONVERSATION_STORE", "memory"),
+		getEnvOrDefault("CONVERSATION_DB_PATH", "data/conversations.db"),
 	)
+	if err != nil {
+		log.Fatalf("Failed to create conversation store: %v", err)
+	}
+	defer conversationStore.Close()
+
+	// Start background title and summary generation
+	summaryWorkers, _ := strconv.Atoi(getEnvOrDefault("SUMMARY_WORKERS", "1"))
+	summaryRate, _ := strconv.Atoi(getEnvOrDefault("SUMMARY_RATE_PER_MINUTE", "10"))
+	summaryMinMessages, _ := strconv.Atoi(getEnvOrDefault("SUMMARY_MIN_MESSAGES", "2"))
+	summaryMaxDeferral, _ := time.ParseDuration(getEnvOrDefault("SUMMARY_MAX_DEFERRAL", "2m"))
+	summaries := summarizer.New(conversationStore,
+		&openAICompleter{current: &current, model: os.Getenv("SUMMARY_MODEL"), maxTokens: 200},
+		summarizer.Options{
+			Workers:       summaryWorkers,
+			RatePerMinute: summaryRate,
+			MinMessages:   summaryMinMessages,
+			Idle:          func() bool { return interactiveStreams.Load() == 0 },
+			MaxDeferral:   summaryMaxDeferral,
+			JobsCounter:   summarizerJobsCounter,
+			QueueDepth:    summarizerQueueDepth,
+		})
+	defer summaries.Close()
+
+	// Create document ingestion pipeline
+	collectionStore, err := ingest.NewStore(getEnvOrDefault("COLLECTIONS_DIR", "data/collections"))
+	if err != nil {
+		log.Fatalf("Failed to create collection store: %v", err)
+	}
+	embeddingBatchSize, _ := strconv.Atoi(getEnvOrDefault("EMBEDDING_BATCH_SIZE", "32"))
+	maxUploadMB, _ := strconv.Atoi(getEnvOrDefault("INGEST_MAX_UPLOAD_MB", "20"))
+	// Embeddings follow the current provider; the embedding model is fixed, so
+	// stored vectors remain comparable
+	embedder := ingest.NewOpenAIEmbedder(func() *openai.Client { return current.Load().Client }, embeddingBatchSize, embeddingDuration)
+	ingester := ingest.NewIngester(collectionStore, embedder,
+		ingest.Options{
+			DocumentsCounter: ingestDocumentsCounter,
+			ChunksCounter:    ingestChunksCounter,
+		})
+
+	// Create retrieval for chat requests that name collections
+	ragTopK, _ := strconv.Atoi(getEnvOrDefault("RAG_TOP_K", "4"))
+	rag, err := newRAGService(
+		ingest.NewRetriever(collectionStore, embedder, ingest.RetrieverOptions{
+			Latency: retrievalLatency,
+			Hits:    retrievalHitsCounter,
+		}),
+		os.Getenv("RAG_PROMPT_TEMPLATE"), ragTopK)
+	if err != nil {
+		log.Fatalf("Failed to set up retrieval: %v", err)
+	}
+
+	// Register the tools the model can call
+	toolRegistry := tools.NewRegistry(tools.Options{Calls: toolCallsCounter, Duration: toolDuration})
+	toolRegistry.Register(tools.Calculator())
+	toolRegistry.Register(tools.CurrentTime())
+	fileRoot := getEnvOrDefault("TOOLS_FILE_ROOT", "data/files")
+	if fileLookup, err := tools.FileLookup(fileRoot, 64<<10); err != nil {
+		log.Printf("File lookup tool disabled: %v", err)
+	} else {
+		toolRegistry.Register(fileLookup)
+	}
+
+	// Connect to MCP servers and expose their tools, resources and prompts
+	mcpConfig, err := mcp.LoadConfig(getEnvOrDefault("MCP_CONFIG", "mcp.json"))
+	if err != nil {
+		log.Fatalf("Failed to load MCP config: %v", err)
+	}
+	mcpManager := mcp.NewManager(toolRegistry, mcp.Options{Calls: mcpRequestsCounter, Duration: mcpRequestDuration})
+	mcpManager.Connect(context.Background(), mcpConfig)
+	defer mcpManager.Close()
+
+	agentMaxIterations, _ := strconv.Atoi(getEnvOrDefault("AGENT_MAX_ITERATIONS", "5"))
+	agentMaxParallel, _ := strconv.Atoi(getEnvOrDefault("TOOL_MAX_PARALLEL", "4"))
+	agentTimeout, _ := time.ParseDuration(getEnvOrDefault("AGENT_TIMEOUT", "60s"))
+	toolTimeout, _ := time.ParseDuration(getEnvOrDefault("TOOL_TIMEOUT", "10s"))
+	if agentMaxIterations <= 0 {
+		agentMaxIterations = 5
+	}
+	if agentTimeout <= 0 {
+		agentTimeout = 60 * time.Second
+	}
+	if toolTimeout <= 0 {
+		toolTimeout = 10 * time.Second
+	}
+
+	// System prompt templates
+	promptLibrary, err := prompts.Load(getEnvOrDefault("PROMPTS_DIR", "prompts"))
+	if err != nil {
+		log.Fatalf("Failed to load prompt templates: %v", err)
+	}
+
+	// JSON replies are constrained with a grammar on llama.cpp and with
+	// response_format elsewhere
+	structuredMode := getEnvOrDefault("STRUCTURED_OUTPUT", "auto")
+	if structuredMode != "auto" && structuredMode != "grammar" && structuredMode != "response_format" {
+		log.Fatalf("Invalid STRUCTURED_OUTPUT %q: use auto, grammar or response_format", structuredMode)
+	}
+	structuredRepairs, err := strconv.Atoi(getEnvOrDefault("STRUCTURED_OUTPUT_REPAIRS", "2"))
+	if err != nil || structuredRepairs < 0 {
+		structuredRepairs = 2
+	}
+	structured := structuredOptions{Mode: structuredMode, MaxRepairs: structuredRepairs}
+
+	// llama.cpp reuses the KV cache of a conversation's earlier turns when
+	// asked to and when the conversation returns to the same slot
+	promptCacheMode := getEnvOrDefault("PROMPT_CACHE", "auto")
+	if promptCacheMode != "auto" && promptCacheMode != "on" && promptCacheMode != "off" {
+		log.Fatalf("Invalid PROMPT_CACHE %q: use auto, on or off", promptCacheMode)
+	}
+	promptCache := promptCacheOptions{Mode: promptCacheMode}
+	if slots, _ := strconv.Atoi(getEnvOrDefault("PROMPT_CACHE_SLOTS", "1")); slots > 1 {
+		conversations, _ := strconv.Atoi(getEnvOrDefault("PROMPT_CACHE_CONVERSATIONS", "10000"))
+		promptCache.Slots = newSlotAffinity(slots, conversations)
+	}
+
+	// Tool calls that mutate state wait for the user's approval
+	approvalPolicy, err := approval.LoadPolicy(getEnvOrDefault("APPROVAL_POLICY", "approval-policy.json"))
+	if err != nil {
+		log.Fatalf("Failed to load approval policy: %v", err)
+	}
+	approvalTimeout, _ := time.ParseDuration(getEnvOrDefault("APPROVAL_TIMEOUT", "30s"))
+	if approvalTimeout <= 0 {
+		approvalTimeout = 30 * time.Second
+	}
+	auditLog, err := approval.OpenAuditLog(getEnvOrDefault("APPROVAL_AUDIT_LOG", "data/approvals.log"))
+	if err != nil {
+		log.Fatalf("Failed to open approval audit log: %v", err)
+	}
+	defer auditLog.Close()
+	approvalGate := approval.NewGate(approval.Options{
+		Timeout:   approvalTimeout,
+		Audit:     auditLog,
+		Decisions: approvalDecisionsCounter,
+	})
+
+	// Deterministic replies are cached in memory and, optionally, on disk
+	var responseCache *cache.Cache
+	if enabled, _ := strconv.ParseBool(getEnvOrDefault("RESPONSE_CACHE_ENABLED", "true")); enabled {
+		cacheSize, _ := strconv.Atoi(getEnvOrDefault("RESPONSE_CACHE_SIZE", "1000"))
+		cacheDiskSize, _ := strconv.Atoi(getEnvOrDefault("RESPONSE_CACHE_DISK_SIZE", "10000"))
+		cacheTTL, err := time.ParseDuration(getEnvOrDefault("RESPONSE_CACHE_TTL", "1h"))
+		if err != nil || cacheTTL < 0 {
+			log.Fatalf("Invalid RESPONSE_CACHE_TTL: must be a duration, or 0 to keep replies until evicted")
+		}
+		responseCache, err = cache.New(cache.Options{
+			MaxEntries:     cacheSize,
+			MaxDiskEntries: cacheDiskSize,
+			TTL:            cacheTTL,
+			Dir:            os.Getenv("RESPONSE_CACHE_DIR"),
+		})
+		if err != nil {
+			log.Fatalf("Failed to create response cache: %v", err)
+		}
+		go responseCache.Watch(context.Background(), time.Minute)
+	}
+	cacheReplayDelay, err := time.ParseDuration(getEnvOrDefault("RESPONSE_CACHE_REPLAY_DELAY", "0s"))
+	if err != nil || cacheReplayDelay < 0 {
+		log.Fatalf("Invalid RESPONSE_CACHE_REPLAY_DELAY: must be a duration")
+	}
+
+	// Similar questions can be answered from the semantic cache
+	semanticCache := semanticCacheOptions{
+		Embedder:       embedder,
+		EmbeddingModel: getEnvOrDefault("SEMANTIC_CACHE_EMBEDDING_MODEL", getEnvOrDefault("EMBEDDING_MODEL", "ai/mxbai-embed-large")),
+		DisabledRoutes: make(map[string]bool),
+	}
+	if enabled, _ := strconv.ParseBool(getEnvOrDefault("SEMANTIC_CACHE_ENABLED", "false")); enabled {
+		threshold, err := strconv.ParseFloat(getEnvOrDefault("SEMANTIC_CACHE_THRESHOLD", "0.95"), 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			log.Fatalf("Invalid SEMANTIC_CACHE_THRESHOLD: must be a similarity in (0, 1]")
+		}
+		size, _ := strconv.Atoi(getEnvOrDefault("SEMANTIC_CACHE_SIZE", "1000"))
+		ttl, err := time.ParseDuration(getEnvOrDefault("SEMANTIC_CACHE_TTL", "1h"))
+		if err != nil || ttl < 0 {
+			log.Fatalf("Invalid SEMANTIC_CACHE_TTL: must be a duration, or 0 to keep replies until evicted")
+		}
+		semanticCache.Cache = cache.NewSemantic(cache.SemanticOptions{
+			Threshold:  threshold,
+			MaxEntries: size,
+			TTL:        ttl,
+			Lookups:    semanticCacheLookups,
+			Feedback:   semanticCacheFeedback,
+			Scores:     semanticCacheSimilarity,
+		})
+		for _, route := range getEnvList("SEMANTIC_CACHE_DISABLED_ROUTES", "") {
+			semanticCache.DisabledRoutes[route] = true
+		}
+	}
+
+	// Identical deterministic requests in flight share one generation
+	var flights *flightGroup
+	if enabled, _ := strconv.ParseBool(getEnvOrDefault("REQUEST_COALESCING_ENABLED", "true")); enabled {
+		flights = newFlightGroup()
+	}
+
+	// Generations get an ID to cancel them by, and keep their events for
+	// clients that reconnect
+	generationBuffer, _ := strconv.Atoi(getEnvOrDefault("GENERATION_BUFFER_EVENTS", "1024"))
+	generationResumeWindow, _ := time.ParseDuration(getEnvOrDefault("GENERATION_RESUME_WINDOW", "30s"))
+	if generationResumeWindow <= 0 {
+		generationResumeWindow = 30 * time.Second
+	}
+	generations := newGenerationRegistry(generationOptions{
+		BufferSize:   generationBuffer,
+		ResumeWindow: generationResumeWindow,
+	})
+
+	// SSE clients get comments while waiting for the first token, so idle
+	// proxies keep the connection open
+	heartbeatInterval, err := time.ParseDuration(getEnvOrDefault("SSE_HEARTBEAT_INTERVAL", "15s"))
+	if err != nil || heartbeatInterval < 0 {
+		log.Fatalf("Invalid SSE_HEARTBEAT_INTERVAL: must be a duration, or 0 to disable heartbeats")
+	}
+
+	chat := &chatService{
+		current:       &current,
+		models:        modelCatalog,
+		conversations: conversationStore,
+		summaries:     summaries,
+		rag:           rag,
+		tools:         toolRegistry,
+		agent: agentOptions{
+			MaxIterations: agentMaxIterations,
+			Timeout:       agentTimeout,
+			ToolTimeout:   toolTimeout,
+			MaxParallel:   agentMaxParallel,
+		},
+		prompts:     promptLibrary,
+		structured:  structured,
+		policy:      approvalPolicy,
+		approvals:   approvalGate,
+		cache:       responseCacheOptions{Cache: responseCache, ReplayDelay: cacheReplayDelay},
+		semantic:    semanticCache,
+		flights:     flights,
+		promptCache: promptCache,
+		generations: generations,
+		heartbeat:   heartbeatInterval,
+	}
 
 	// Create router
 	mux := http.NewServeMux()
 
-	// Apply middleware
-	handlersChain := func(h http.Handler) http.Handler {
+	// CORS policy shared by all routes
+	corsMaxAge, _ := strconv.Atoi(getEnvOrDefault("CORS_MAX_AGE", "600"))
+	corsAllowCredentials, _ := strconv.ParseBool(getEnvOrDefault("CORS_ALLOW_CREDENTIALS", "false"))
+	corsConfig := middleware.CORSConfig{
+		AllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS", "*"),
+		AllowedMethods:   getEnvList("CORS_ALLOWED_METHODS", "GET, POST, PUT, PATCH, DELETE, OPTIONS"),
+		AllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS", "Content-Type, Authorization, X-User-ID, X-Tenant-ID"),
+		ExposedHeaders:   getEnvList("CORS_EXPOSED_HEADERS", "X-Generation-ID, X-Conversation-ID, X-Cache, X-Cache-Match, X-Cache-Entry"),
+		AllowCredentials: corsAllowCredentials,
+		MaxAge:           corsMaxAge,
+	}
+	if corsAllowCredentials {
+		listed := false
+		for _, origin := range corsConfig.AllowedOrigins {
+			listed = listed || origin != "*"
+		}
+		if !listed {
+			log.Printf("CORS_ALLOW_CREDENTIALS has no effect: credentials are only allowed for origins CORS_ALLOWED_ORIGINS lists, not \"*\"")
+		}
+	}
+
+	// Apply middleware. WebSocket generations are observed like requests too.
+	observe := func(h http.Handler) http.Handler {
 		h = middleware.MetricsMiddleware(requestCounter, requestDuration, activeRequests)(h)
 		if tracingEnabled {
 			h = middleware.TracingMiddleware(h)
 		}
 		return h
 	}
+	handlersChain := func(h http.Handler) http.Handler {
+		return observe(middleware.CORSMiddleware(corsConfig, corsRejectedCounter)(h))
+	}
 
-	// Add CORS handler
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-	})
-
-	// Add health check endpoint
+	// Model information for the UI; dependency health is served by /healthz
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.WriteHeader(http.StatusOK)
+		model := metricsModel(r.URL.Query().Get("model"))
+		baseURL := current.Load().BaseURL
 		
 		// Check if the model is a llama.cpp model
 		isLlamaCpp := strings.Contains(strings.ToLower(model), "llama") || 
@@ -415,15 +1020,9 @@ func main() {
 	
 	// Add metrics summary endpoint for frontend
 	mux.HandleFunc("/metrics/summary", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 		w.Header().Set("Content-Type", "application/json")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+		model := metricsModel(r.URL.Query().Get("model"))
+		baseURL := current.Load().BaseURL
 
 		// Get llama.cpp metrics if the model is a llama.cpp model
 		var llamaCppMetrics *LlamaCppMetrics
@@ -448,15 +1047,6 @@ func main() {
 	
 	// Add metrics logging endpoint
 	mux.HandleFunc("/metrics/log", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
 		// Parse metrics from the request
 		var metricLog MetricLog
 		if err := json.NewDecoder(r.Body).Decode(&metricLog); err != nil {
@@ -467,7 +1057,7 @@ func main() {
 		// Log the metrics using Prometheus (don't increment counters as they are already tracked)
 		// Just log the first token latency which isn't already tracked
 		if metricLog.FirstTokenMs > 0 {
-			firstTokenLatency.WithLabelValues(model).Observe(metricLog.FirstTokenMs / 1000.0)
+			firstTokenLatency.WithLabelValues(metricsModel(metricLog.Model)).Observe(metricLog.FirstTokenMs / 1000.0)
 		}
 
 		w.WriteHeader(http.StatusOK)
@@ -475,15 +1065,6 @@ func main() {
 	
 	// Add llama.cpp metrics logging endpoint
 	mux.HandleFunc("/metrics/llamacpp", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
 		// Parse metrics from the request
 		var llamaCppLog LlamaCppMetrics
 		if err := json.NewDecoder(r.Body).Decode(&llamaCppLog); err != nil {
@@ -492,6 +1073,7 @@ func main() {
 		}
 
 		// Record all llama.cpp metrics
+		model := metricsModel(llamaCppLog.Model)
 		llamacppContextSize.WithLabelValues(model).Set(float64(llamaCppLog.ContextSize))
 		llamacppPromptEvalTime.WithLabelValues(model).Observe(llamaCppLog.PromptEvalTime / 1000.0) // Convert ms to seconds
 		llamacppTokensPerSecond.WithLabelValues(model).Set(llamaCppLog.TokensPerSecond)
@@ -504,15 +1086,6 @@ func main() {
 	
 	// Add error logging endpoint
 	mux.HandleFunc("/metrics/error", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
 		// Parse error from the request
 		var errorLog ErrorLog
 		if err := json.NewDecoder(r.Body).Decode(&errorLog); err != nil {
@@ -526,15 +1099,110 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	// Add conversation endpoints
+	conversation.NewHandler(conversationStore).Register(mux)
+
+	// Add collection and document ingestion endpoints
+	ingest.NewHandler(ingester, getEnvOrDefault("EMBEDDING_MODEL", "ai/mxbai-embed-large"), int64(maxUploadMB)<<20).Register(mux)
+
+	// Add MCP server status endpoint
+	mcp.NewHandler(mcpManager).Register(mux)
+	approval.NewHandler(approvalGate).Register(mux)
+	prompts.NewHandler(promptLibrary).Register(mux)
+	models.NewHandler(modelCatalog).Register(mux)
+	if semanticCache.Cache != nil {
+		cache.NewHandler(semanticCache.Cache).Register(mux)
+	}
+	admin := &adminHandler{current: &current, catalog: modelCatalog, token: os.Getenv("ADMIN_TOKEN")}
+	admin.Register(mux)
+
+	// Model Runner management, behind the admin token. The runner URL is
+	// derived from the current provider's base URL when it points at Model Runner.
+	runner := &runnerHandler{url: os.Getenv("MODEL_RUNNER_URL"), current: &current}
+	mux.Handle("/admin/models", admin.authorize(runner))
+	mux.Handle("/admin/models/", admin.authorize(runner))
+
+	// Health checks. Readiness also fails until the model has been warmed up.
+	readiness := health.NewReadiness()
+	healthCheckTimeout, _ := time.ParseDuration(getEnvOrDefault("HEALTH_CHECK_TIMEOUT", "2s"))
+	healthCheckCacheTTL, _ := time.ParseDuration(getEnvOrDefault("HEALTH_CHECK_CACHE_TTL", "5s"))
+	healthChecks := health.New(health.Options{Status: healthCheckStatus, Duration: healthCheckDuration})
+	healthChecks.Add(health.Check{Name: "warmup", Checker: readiness, Critical: true, CacheTTL: time.Millisecond})
+	healthChecks.Add(health.Check{
+		Name: "upstream_model",
+		Checker: health.CheckerFunc(func(ctx context.Context) error {
+			p := current.Load()
+			return checkModel(ctx, p.Client, p.DefaultModel)
+		}),
+		Critical: true,
+		Timeout:  healthCheckTimeout,
+		CacheTTL: healthCheckCacheTTL,
+	})
+	healthChecks.Add(health.Check{
+		Name:     "conversation_store",
+		Checker:  health.CheckerFunc(conversationStore.Ping),
+		Critical: true,
+		Timeout:  healthCheckTimeout,
+		CacheTTL: healthCheckCacheTTL,
+	})
+	healthChecks.Add(health.Check{
+		Name:     "vector_index",
+		Checker:  health.CheckerFunc(collectionStore.Ping),
+		Timeout:  healthCheckTimeout,
+		CacheTTL: healthCheckCacheTTL,
+	})
+	if tracingEnabled {
+		otlpEndpoint := getEnvOrDefault("OTLP_ENDPOINT", "jaeger:4318")
+		healthChecks.Add(health.Check{
+			Name: "tracing_exporter",
+			Checker: health.CheckerFunc(func(ctx context.Context) error {
+				return tracing.PingExporter(ctx, otlpEndpoint)
+			}),
+			Timeout:  healthCheckTimeout,
+			CacheTTL: healthCheckCacheTTL,
+		})
+	}
+	healthChecks.Register(mux)
+
 	// Add chat endpoint with advanced tracing
-	mux.HandleFunc("/chat", handleChat(client, model, baseURL))
+	mux.HandleFunc("/chat", chat.handleChat())
+	mux.HandleFunc("POST /conversations/{id}/messages/{messageID}/regenerate", chat.handleRegenerate())
+	mux.HandleFunc("POST /conversations/{id}/messages/{messageID}/edit", chat.handleEditMessage())
+
+	// The same chat over a WebSocket, for clients behind proxies that buffer SSE
+	wsMaxGenerations, _ := strconv.Atoi(getEnvOrDefault("WS_MAX_GENERATIONS", "4"))
+	if wsMaxGenerations <= 0 {
+		wsMaxGenerations = 4
+	}
+	wsWriteTimeout, _ := time.ParseDuration(getEnvOrDefault("WS_WRITE_TIMEOUT", "10s"))
+	if wsWriteTimeout <= 0 {
+		wsWriteTimeout = 10 * time.Second
+	}
+	mux.Handle("GET /ws/chat", chat.handleWebSocket(corsConfig, observe, wsOptions{
+		MaxGenerations: wsMaxGenerations,
+		WriteTimeout:   wsWriteTimeout,
+	}))
+
+	// Cancel and resume chat generations by the ID in X-Generation-ID
+	generations.Register(mux)
+
+	// Streaming routes get their own write deadline in place of the server's
+	writeTimeout, _ := time.ParseDuration(getEnvOrDefault("HTTP_WRITE_TIMEOUT", "90s"))
+	if writeTimeout <= 0 {
+		writeTimeout = 90 * time.Second
+	}
+	timeouts := parseRouteTimeouts(mux, getEnvList("ROUTE_TIMEOUTS",
+		"/chat=10m,"+
+			"POST /conversations/{id}/messages/{messageID}/regenerate=10m,"+
+			"POST /conversations/{id}/messages/{messageID}/edit=10m,"+
+			"GET /generations/{id}/events=10m"))
 
 	// Create HTTP server
 	server := &http.Server{
 		Addr:         ":8080",
-		Handler:      handlersChain(mux),
+		Handler:      handlersChain(timeouts.wrap(mux)),
 		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 90 * time.Second,
+		WriteTimeout: writeTimeout,
 	}
 
 	// Start metrics server on a separate port with custom registry
@@ -558,6 +1226,36 @@ func main() {
 		}
 	}()
 
+	// Warm up the model in the background; /livez answers meanwhile and
+	// /readyz once it is done
+	warmupCtx, stopWarmup := context.WithCancel(context.Background())
+	defer stopWarmup()
+	healthCheckInterval, _ := time.ParseDuration(getEnvOrDefault("HEALTH_CHECK_INTERVAL", "15s"))
+	if healthCheckInterval <= 0 {
+		healthCheckInterval = 15 * time.Second
+	}
+	go healthChecks.Watch(warmupCtx, healthCheckInterval)
+	warmupEnabled, _ := strconv.ParseBool(getEnvOrDefault("WARMUP_ENABLED", "true"))
+	if warmupEnabled {
+		warmupTimeout, _ := time.ParseDuration(getEnvOrDefault("WARMUP_TIMEOUT", "5m"))
+		if warmupTimeout <= 0 {
+			warmupTimeout = 5 * time.Minute
+		}
+		warmupRetryInterval, _ := time.ParseDuration(getEnvOrDefault("WARMUP_RETRY_INTERVAL", "5s"))
+		if warmupRetryInterval <= 0 {
+			warmupRetryInterval = 5 * time.Second
+		}
+		go func() {
+			opts := warmupOptions{Timeout: warmupTimeout, RetryInterval: warmupRetryInterval}
+			if err := warmUp(warmupCtx, &current, opts, readiness); err != nil {
+				log.Printf("Warm-up failed, /readyz will keep failing: %v", err)
+			}
+		}()
+	} else {
+		readiness.SetReady()
+		readyGauge.Set(1)
+	}
+
 	// Set up graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -588,155 +1286,13 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return value
 }
 
-// handleChat handles the chat endpoint with simple tracing
-func handleChat(client *openai.Client, model string, apiBaseURL string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		var req ChatRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Invalid request body: %v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			requestCounter.WithLabelValues(r.Method, r.URL.Path, fmt.Sprintf("%d", http.StatusBadRequest)).Inc()
-			return
-		}
-
-		// Set headers for SSE
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
-		// Count input tokens (rough estimate)
-		inputTokens := 0
-		for _, msg := range req.Messages {
-			inputTokens += len(msg.Content) / 4 // Rough estimate
-		}
-		inputTokens += len(req.Message) / 4
-		
-		// Track metrics for input tokens
-		chatTokensCounter.WithLabelValues("input", model).Add(float64(inputTokens))
-
-		// Start model timing
-		start := time.Now()
-		modelStartTime := time.Now()
-		var firstTokenTime time.Time
-		outputTokens := 0
-
-		var messages []openai.ChatCompletionMessageParamUnion
-		for _, msg := range req.Messages {
-			var message openai.ChatCompletionMessageParamUnion
-			switch msg.Role {
-			case "user":
-				message = openai.UserMessage(msg.Content)
-			case "assistant":
-				message = openai.AssistantMessage(msg.Content)
-			}
-
-			messages = append(messages, message)
-		}
-
-		// Check if the user is requesting markdown output
-		useMarkdown := false
-		userMessage := req.Message
-		
-		// Format can be explicitly set in the request
-		if req.Format == "markdown" {
-			useMarkdown = true
-		}
-		
-		// Or it can be detected from the message
-		if strings.Contains(strings.ToLower(userMessage), "in markdown") ||
-		   strings.Contains(strings.ToLower(userMessage), "using markdown") {
-			useMarkdown = true
-		}
-		
-		// If markdown is requested, modify the system prompt
-		if useMarkdown {
-			// Prepend a system message to request markdown formatting
-			systemMsg := openai.SystemMessage("Please format your response using markdown. Use proper headings, bullet points, numbered lists, code blocks with syntax highlighting, and tables where appropriate.")
-			messages = append([]openai.ChatCompletionMessageParamUnion{systemMsg}, messages...)
-		}
-
-		// Add the user message to the conversation
-		messages = append(messages, openai.UserMessage(userMessage))
-		
-		param := openai.ChatCompletionNewParams{
-			Messages: openai.F(messages),
-			Model:    openai.F(model),
-		}
-
-		// Set prompt evaluation start time for llama.cpp metrics
-		promptEvalStartTime := time.Now()
-
-		ctx := r.Context()
-		stream := client.Chat.Completions.NewStreaming(ctx, param)
-
-		for stream.Next() {
-			chunk := stream.Current()
-
-			// Record first token time
-			if firstTokenTime.IsZero() && len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
-				firstTokenTime = time.Now()
-				
-				// For llama.cpp, record prompt evaluation time
-				if strings.Contains(strings.ToLower(model), "llama") || 
-				   strings.Contains(apiBaseURL, "llama.cpp") {
-					promptEvalTime := firstTokenTime.Sub(promptEvalStartTime)
-					llamacppPromptEvalTime.WithLabelValues(model).Observe(promptEvalTime.Seconds())
-				}
-			}
-
-			// Stream each chunk as it arrives
-			if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
-				outputTokens++
-				_, err := fmt.Fprintf(w, "%s", chunk.Choices[0].Delta.Content)
-				if err != nil {
-					log.Printf("Error writing to stream: %v", err)
-					return
-				}
-				w.(http.Flusher).Flush()
-			}
-		}
-
-		// Calculate tokens per second for llama.cpp metrics
-		if strings.Contains(strings.ToLower(model), "llama") || 
-		   strings.Contains(apiBaseURL, "llama.cpp") {
-			totalTime := time.Since(firstTokenTime).Seconds()
-			if totalTime > 0 && outputTokens > 0 {
-				tokensPerSecond := float64(outputTokens) / totalTime
-				llamacppTokensPerSecond.WithLabelValues(model).Set(tokensPerSecond)
-			}
-		}
-
-		// Record metrics
-		requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(time.Since(start).Seconds())
-		requestCounter.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
-		chatTokensCounter.WithLabelValues("output", model).Add(float64(outputTokens))
-		modelLatency.WithLabelValues(model, "inference").Observe(time.Since(modelStartTime).Seconds())
-		
-		if !firstTokenTime.IsZero() {
-			ttft := firstTokenTime.Sub(modelStartTime).Seconds()
-			log.Printf("Time to first token: %.3f seconds", ttft)
-			firstTokenLatency.WithLabelValues(model).Observe(ttft)
-		}
-
-		if err := stream.Err(); err != nil {
-			log.Printf("Error in stream: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+// getEnvList gets a comma-separated environment variable as a list of trimmed values
+func getEnvList(key, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnvOrDefault(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
 		}
 	}
-}
\ No newline at end of file
+	return values
+}
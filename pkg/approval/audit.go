@@ -0,0 +1,97 @@
+package approval
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Outcomes recorded in the audit log
+const (
+	OutcomeApproved     = "approved"
+	OutcomeDenied       = "denied"
+	OutcomeTimeout      = "timeout"
+	OutcomeCancelled    = "cancelled"
+	OutcomePolicyDenied = "policy_denied"
+)
+
+// AuditEntry records a decision about a tool call
+type AuditEntry struct {
+	Time       time.Time       `json:"time"`
+	ApprovalID string          `json:"approval_id,omitempty"`
+	User       string          `json:"user"`       // Who the chat request belonged to
+	DecidedBy  string          `json:"decided_by"` // Who approved or denied; "policy" or "system" for automatic decisions
+	Tool       string          `json:"tool"`
+	Arguments  json.RawMessage `json:"arguments"`
+	Outcome    string          `json:"outcome"`
+	Reason     string          `json:"reason,omitempty"`
+}
+
+// AuditLog appends decisions to a JSON lines file and the application log
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenAuditLog opens the audit file for appending, creating it if needed
+func OpenAuditLog(file string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: f}, nil
+}
+
+// Record writes an entry. Failures are logged rather than returned, so an
+// audit problem never blocks the chat.
+func (a *AuditLog) Record(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if !json.Valid(entry.Arguments) {
+		// Keep the exact text the model sent, even when it is not JSON
+		raw, _ := json.Marshal(string(entry.Arguments))
+		entry.Arguments = raw
+	}
+
+	log.Info().
+		Str("approval_id", entry.ApprovalID).
+		Str("user", entry.User).
+		Str("decided_by", entry.DecidedBy).
+		Str("tool", entry.Tool).
+		RawJSON("arguments", entry.Arguments).
+		Str("outcome", entry.Outcome).
+		Str("reason", entry.Reason).
+		Msg("Tool call decision")
+
+	if a == nil || a.file == nil {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode audit entry")
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		log.Error().Err(err).Msg("Failed to write audit entry")
+		return
+	}
+	a.file.Sync()
+}
+
+// Close closes the audit file
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
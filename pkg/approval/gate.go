@@ -0,0 +1,188 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Errors returned by the gate
+var (
+	ErrNotFound = errors.New("approval not found")
+	ErrDenied   = errors.New("tool call denied")
+	ErrTimeout  = errors.New("approval timed out")
+)
+
+// Options configures the gate
+type Options struct {
+	Timeout   time.Duration          // How long a call waits for a decision
+	Audit     *AuditLog              // Where decisions are recorded
+	Decisions *prometheus.CounterVec // Labelled by outcome
+}
+
+// Request is a tool call waiting for a decision
+type Request struct {
+	ID         string          `json:"id"`
+	User       string          `json:"-"`
+	ToolCallID string          `json:"tool_call_id"`
+	Tool       string          `json:"tool"`
+	Arguments  json.RawMessage `json:"arguments"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ExpiresAt  time.Time       `json:"expires_at"`
+}
+
+// decision is the answer to a request
+type decision struct {
+	approved bool
+	reason   string
+}
+
+type pending struct {
+	Request
+	decided chan decision
+	done    bool // Whether Decide sent a decision Wait has not collected yet
+}
+
+// Gate holds tool calls until their user approves or denies them
+type Gate struct {
+	opts Options
+
+	mu      sync.Mutex
+	pending map[string]*pending
+}
+
+// NewGate creates a gate
+func NewGate(opts Options) *Gate {
+	return &Gate{opts: opts, pending: make(map[string]*pending)}
+}
+
+// Open registers a tool call that needs approval. The caller announces it to
+// the user and then blocks in Wait.
+func (g *Gate) Open(user, toolCallID, tool string, args json.RawMessage) Request {
+	now := time.Now().UTC()
+	req := Request{
+		ID:         uuid.New().String(),
+		User:       user,
+		ToolCallID: toolCallID,
+		Tool:       tool,
+		Arguments:  args,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(g.opts.Timeout),
+	}
+
+	g.mu.Lock()
+	g.pending[req.ID] = &pending{Request: req, decided: make(chan decision, 1)}
+	g.mu.Unlock()
+	return req
+}
+
+// Wait blocks until the request is decided, expires or ctx ends. It returns
+// nil when the call was approved.
+func (g *Gate) Wait(ctx context.Context, id string) error {
+	g.mu.Lock()
+	p, ok := g.pending[id]
+	g.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+
+	ctx, span := tracing.StartChildSpan(ctx, "approval.wait")
+	defer span.End()
+	span.SetAttributes(attribute.String("tool.name", p.Tool), attribute.String("approval.id", id))
+
+	timer := time.NewTimer(time.Until(p.ExpiresAt))
+	defer timer.Stop()
+
+	var d *decision
+	var expired error
+	select {
+	case got := <-p.decided:
+		d = &got
+	case <-timer.C:
+		expired = ErrTimeout
+	case <-ctx.Done():
+		expired = ctx.Err()
+	}
+	g.mu.Lock()
+	delete(g.pending, id)
+	if d == nil && p.done {
+		// Decide got there first; honour the decision it reported as accepted
+		got := <-p.decided
+		d = &got
+	}
+	g.mu.Unlock()
+
+	entry := AuditEntry{ApprovalID: id, User: p.User, Tool: p.Tool, Arguments: p.Arguments}
+	var err error
+	switch {
+	case d != nil && d.approved:
+		entry.DecidedBy, entry.Outcome, entry.Reason = p.User, OutcomeApproved, d.reason
+	case d != nil:
+		entry.DecidedBy, entry.Outcome, entry.Reason = p.User, OutcomeDenied, d.reason
+		err = ErrDenied
+		if d.reason != "" {
+			err = fmt.Errorf("%w: %s", ErrDenied, d.reason)
+		}
+	case errors.Is(expired, ErrTimeout):
+		entry.DecidedBy, entry.Outcome = "system", OutcomeTimeout
+		err = expired
+	default:
+		entry.DecidedBy, entry.Outcome = "system", OutcomeCancelled
+		err = expired
+	}
+
+	span.SetAttributes(attribute.String("approval.outcome", entry.Outcome))
+	g.record(entry)
+	return err
+}
+
+// Decide approves or denies a pending request. Only the user who made the
+// chat request may decide; other users get ErrNotFound so pending calls are
+// not leaked. The decision is kept until Wait collects it, so it is not lost
+// when the user answers before the caller starts waiting.
+func (g *Gate) Decide(id, user string, approve bool, reason string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.pending[id]
+	if !ok || p.User != user || p.done {
+		return ErrNotFound
+	}
+	p.done = true
+	p.decided <- decision{approved: approve, reason: reason}
+	return nil
+}
+
+// Reject records a call the policy refused without asking
+func (g *Gate) Reject(user, tool string, args json.RawMessage) {
+	g.record(AuditEntry{User: user, DecidedBy: "policy", Tool: tool, Arguments: args, Outcome: OutcomePolicyDenied})
+}
+
+// Pending lists the user's requests awaiting a decision, oldest first
+func (g *Gate) Pending(user string) []Request {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	list := []Request{}
+	for _, p := range g.pending {
+		if p.User == user && !p.done {
+			list = append(list, p.Request)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+func (g *Gate) record(entry AuditEntry) {
+	if g.opts.Decisions != nil {
+		g.opts.Decisions.WithLabelValues(entry.Outcome).Inc()
+	}
+	g.opts.Audit.Record(entry)
+}
@@ -0,0 +1,192 @@
+package approval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newGate(t *testing.T, timeout time.Duration) (*Gate, string, *prometheus.CounterVec) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "audit", "approvals.jsonl")
+	audit, err := OpenAuditLog(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { audit.Close() })
+	decisions := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "tool_approvals_total"}, []string{"outcome"})
+	return NewGate(Options{Timeout: timeout, Audit: audit, Decisions: decisions}), file, decisions
+}
+
+// readAudit returns the entries written to the audit file
+func readAudit(t *testing.T, file string) []AuditEntry {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// waitAsync runs Wait in the background and returns its result channel
+func waitAsync(ctx context.Context, gate *Gate, id string) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- gate.Wait(ctx, id) }()
+	return done
+}
+
+func TestGateDecide(t *testing.T) {
+	gate, file, decisions := newGate(t, time.Minute)
+
+	approved := gate.Open("alice", "call-1", "write_file", json.RawMessage(`{"path":"a.txt"}`))
+	denied := gate.Open("alice", "call-2", "delete_file", json.RawMessage(`{"path":"b.txt"}`))
+	if pending := gate.Pending("alice"); len(pending) != 2 || pending[0].ID != approved.ID {
+		t.Fatalf("Pending = %+v, want both requests oldest first", pending)
+	}
+	if pending := gate.Pending("bob"); len(pending) != 0 {
+		t.Fatalf("Pending for bob = %+v, want none", pending)
+	}
+
+	approvedDone := waitAsync(context.Background(), gate, approved.ID)
+	deniedDone := waitAsync(context.Background(), gate, denied.ID)
+
+	// Other users cannot see or decide alice's calls
+	if err := gate.Decide(approved.ID, "bob", true, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Decide as bob: err = %v, want ErrNotFound", err)
+	}
+	if err := gate.Decide(approved.ID, "alice", true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := gate.Decide(denied.ID, "alice", false, "wrong file"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gate.Decide(approved.ID, "alice", false, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second Decide: err = %v, want ErrNotFound", err)
+	}
+
+	if err := <-approvedDone; err != nil {
+		t.Fatalf("approved call: err = %v", err)
+	}
+	err := <-deniedDone
+	if !errors.Is(err, ErrDenied) || err.Error() != "tool call denied: wrong file" {
+		t.Fatalf("denied call: err = %v, want ErrDenied with the reason", err)
+	}
+	if len(gate.Pending("alice")) != 0 {
+		t.Fatal("decided requests are still pending")
+	}
+
+	entries := readAudit(t, file)
+	if len(entries) != 2 {
+		t.Fatalf("audit has %d entries, want 2", len(entries))
+	}
+	outcomes := map[string]AuditEntry{}
+	for _, entry := range entries {
+		outcomes[entry.Outcome] = entry
+	}
+	if entry := outcomes[OutcomeApproved]; entry.ApprovalID != approved.ID || entry.DecidedBy != "alice" || string(entry.Arguments) != `{"path":"a.txt"}` {
+		t.Fatalf("approved entry = %+v", entry)
+	}
+	if entry := outcomes[OutcomeDenied]; entry.Tool != "delete_file" || entry.Reason != "wrong file" {
+		t.Fatalf("denied entry = %+v", entry)
+	}
+	if got := testutil.ToFloat64(decisions.WithLabelValues(OutcomeApproved)); got != 1 {
+		t.Fatalf("approved decisions = %v, want 1", got)
+	}
+}
+
+func TestGateDecideBeforeWait(t *testing.T) {
+	gate, _, _ := newGate(t, time.Minute)
+	req := gate.Open("alice", "call-1", "write_file", json.RawMessage(`{}`))
+
+	// The user can answer the announced request before the caller waits
+	if err := gate.Decide(req.ID, "alice", true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(gate.Pending("alice")) != 0 {
+		t.Fatal("decided request is still listed as pending")
+	}
+	if err := gate.Wait(context.Background(), req.ID); err != nil {
+		t.Fatalf("Wait after Decide: err = %v, want the approval", err)
+	}
+	if err := gate.Wait(context.Background(), req.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second Wait: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGateTimeout(t *testing.T) {
+	gate, file, decisions := newGate(t, 20*time.Millisecond)
+	req := gate.Open("alice", "call-1", "write_file", json.RawMessage(`{}`))
+
+	if err := gate.Wait(context.Background(), req.ID); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Wait: err = %v, want ErrTimeout", err)
+	}
+	if err := gate.Decide(req.ID, "alice", true, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Decide after the timeout: err = %v, want ErrNotFound", err)
+	}
+	entries := readAudit(t, file)
+	if len(entries) != 1 || entries[0].Outcome != OutcomeTimeout || entries[0].DecidedBy != "system" {
+		t.Fatalf("audit = %+v, want one timeout decided by the system", entries)
+	}
+	if got := testutil.ToFloat64(decisions.WithLabelValues(OutcomeTimeout)); got != 1 {
+		t.Fatalf("timeout decisions = %v, want 1", got)
+	}
+}
+
+func TestGateCancel(t *testing.T) {
+	gate, file, _ := newGate(t, time.Minute)
+	req := gate.Open("alice", "call-1", "write_file", json.RawMessage(`not json`))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := waitAsync(ctx, gate, req.ID)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait: err = %v, want context.Canceled", err)
+	}
+	if len(gate.Pending("alice")) != 0 {
+		t.Fatal("cancelled request is still pending")
+	}
+
+	entries := readAudit(t, file)
+	if len(entries) != 1 || entries[0].Outcome != OutcomeCancelled {
+		t.Fatalf("audit = %+v, want one cancellation", entries)
+	}
+	// Arguments that are not JSON are kept as a string
+	if string(entries[0].Arguments) != `"not json"` {
+		t.Fatalf("arguments = %s, want the text as a JSON string", entries[0].Arguments)
+	}
+
+	if err := gate.Wait(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Wait for a missing request: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGateReject(t *testing.T) {
+	gate, file, decisions := newGate(t, time.Minute)
+	gate.Reject("alice", "shell", json.RawMessage(`{"command":"rm -rf /"}`))
+
+	entries := readAudit(t, file)
+	if len(entries) != 1 || entries[0].Outcome != OutcomePolicyDenied || entries[0].DecidedBy != "policy" {
+		t.Fatalf("audit = %+v, want one policy denial", entries)
+	}
+	if got := testutil.ToFloat64(decisions.WithLabelValues(OutcomePolicyDenied)); got != 1 {
+		t.Fatalf("policy denials = %v, want 1", got)
+	}
+}
@@ -0,0 +1,66 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/identity"
+)
+
+// Handler serves the approval endpoints
+type Handler struct {
+	gate *Gate
+}
+
+// NewHandler creates an HTTP handler for the gate
+func NewHandler(gate *Gate) *Handler {
+	return &Handler{gate: gate}
+}
+
+// Register adds the approval routes to the mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /approvals", h.handleList)
+	mux.HandleFunc("POST /approvals/{id}/approve", h.handleDecide(true))
+	mux.HandleFunc("POST /approvals/{id}/deny", h.handleDecide(false))
+}
+
+// decideRequest is the optional body of an approve or deny call
+type decideRequest struct {
+	Reason string `json:"reason"`
+}
+
+// handleList returns the caller's tool calls awaiting a decision
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"approvals": h.gate.Pending(identity.UserID(r))})
+}
+
+func (h *Handler) handleDecide(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req decideRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		id := r.PathValue("id")
+		if err := h.gate.Decide(id, identity.UserID(r), approve, req.Reason); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				http.Error(w, "Approval not found or already decided", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		outcome := OutcomeDenied
+		if approve {
+			outcome = OutcomeApproved
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"id": id, "outcome": outcome})
+	}
+}
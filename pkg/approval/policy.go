@@ -0,0 +1,78 @@
+// Package approval decides which tool calls need a human decision before
+// they run. A policy maps tools to allow, deny or ask; the gate holds "ask"
+// calls until the user approves or denies them, and every decision is written
+// to an audit log.
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/tools"
+)
+
+// Action is what the policy does with a tool call
+type Action string
+
+// Policy actions
+const (
+	Allow Action = "allow" // Run without asking
+	Ask   Action = "ask"   // Pause until the user approves or denies
+	Deny  Action = "deny"  // Never run
+)
+
+// Rule applies an action to the tools whose names match a path.Match pattern,
+// such as "github__*"
+type Rule struct {
+	Tool   string `json:"tool"`
+	Action Action `json:"action"`
+}
+
+// Policy is an ordered list of rules; the first match wins. Tools no rule
+// matches are asked about when they mutate state and allowed otherwise.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Evaluate returns the action for a tool
+func (p Policy) Evaluate(tool tools.Tool) Action {
+	for _, rule := range p.Rules {
+		if matched, _ := path.Match(rule.Tool, tool.Name); matched {
+			return rule.Action
+		}
+	}
+	if tool.Mutating {
+		return Ask
+	}
+	return Allow
+}
+
+// LoadPolicy reads a policy file. A missing file is the default policy.
+func LoadPolicy(file string) (Policy, error) {
+	var p Policy
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("invalid approval policy %s: %w", file, err)
+	}
+	for _, rule := range p.Rules {
+		if _, err := path.Match(rule.Tool, ""); err != nil {
+			return p, fmt.Errorf("invalid approval policy %s: bad pattern %q", file, rule.Tool)
+		}
+		switch rule.Action {
+		case Allow, Ask, Deny:
+		default:
+			return p, fmt.Errorf("invalid approval policy %s: unknown action %q for %s", file, rule.Action, rule.Tool)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,56 @@
+package approval
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/tools"
+)
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy := Policy{Rules: []Rule{
+		{Tool: "github__delete_*", Action: Deny},
+		{Tool: "github__*", Action: Allow},
+		{Tool: "calculator", Action: Ask},
+	}}
+	tests := []struct {
+		tool tools.Tool
+		want Action
+	}{
+		{tools.Tool{Name: "github__delete_repo", Mutating: true}, Deny},
+		{tools.Tool{Name: "github__create_issue", Mutating: true}, Allow},
+		{tools.Tool{Name: "calculator"}, Ask},
+		{tools.Tool{Name: "write_file", Mutating: true}, Ask},
+		{tools.Tool{Name: "read_file"}, Allow},
+	}
+	for _, tt := range tests {
+		if got := policy.Evaluate(tt.tool); got != tt.want {
+			t.Errorf("Evaluate(%s) = %s, want %s", tt.tool.Name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	policy, err := LoadPolicy(filepath.Join(dir, "missing.json"))
+	if err != nil || len(policy.Rules) != 0 {
+		t.Fatalf("LoadPolicy of a missing file = %+v, %v, want the default policy", policy, err)
+	}
+
+	tests := map[string]bool{
+		`{"rules":[{"tool":"github__*","action":"allow"}]}`: true,
+		`{"rules":[{"tool":"github__*","action":"maybe"}]}`: false,
+		`{"rules":[{"tool":"[","action":"deny"}]}`:          false,
+		`{"rules":`: false,
+	}
+	for data, valid := range tests {
+		file := filepath.Join(dir, "policy.json")
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadPolicy(file); (err == nil) != valid {
+			t.Errorf("LoadPolicy(%s): err = %v, want valid %t", data, err, valid)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+// Package cache stores chat replies so identical requests can be answered
+// without running inference again. Entries live in a size-bounded LRU in
+// memory and, optionally, in a size-bounded directory that survives restarts.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Tiers an entry can be found in
+const (
+	TierMemory = "memory"
+	TierDisk   = "disk"
+)
+
+// Entry is a cached reply
+type Entry struct {
+	Key       string    `json:"key"`
+	Model     string    `json:"model"`
+	Reply     string    `json:"reply"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Options configures a cache
+type Options struct {
+	MaxEntries     int           // Entries kept in memory; the least recently used are evicted
+	MaxDiskEntries int           // Entries kept on disk; the oldest are removed. Defaults to 10 times MaxEntries
+	TTL            time.Duration // Entries expire this long after they were stored; 0 keeps them
+	Dir            string        // Directory of the disk tier; disabled when empty
+}
+
+// Cache is an LRU of replies with an optional disk tier. Every entry is
+// written to both tiers; entries evicted from memory are still found on disk.
+type Cache struct {
+	opts Options
+
+	mu    sync.Mutex
+	lru   *list.List               // Most recently used first
+	items map[string]*list.Element // Values are *Entry
+	files *list.List               // Entries on disk, most recently written first
+	disk  map[string]*list.Element // Values are *diskEntry
+}
+
+// diskEntry is an entry file and when it was written
+type diskEntry struct {
+	key     string
+	written time.Time
+}
+
+// New creates a cache, creating the disk tier directory if needed. Expired
+// and excess entries left on disk by an earlier run are removed.
+func New(opts Options) (*Cache, error) {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	if opts.MaxDiskEntries <= 0 {
+		opts.MaxDiskEntries = 10 * opts.MaxEntries
+	}
+	c := &Cache{
+		opts:  opts,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+		files: list.New(),
+		disk:  make(map[string]*list.Element),
+	}
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create cache directory: %w", err)
+		}
+		if err := c.scan(); err != nil {
+			return nil, fmt.Errorf("read cache directory: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Key hashes the parts of a request that determine its reply
+func Key(parts interface{}) string {
+	data, _ := json.Marshal(parts)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns an unexpired entry and the tier it was found in. Entries found
+// on disk are moved back into memory.
+func (c *Cache) Get(key string) (Entry, string, bool) {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*Entry)
+		if !c.expired(entry) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return *entry, TierMemory, true
+		}
+		c.remove(el)
+	}
+	c.mu.Unlock()
+
+	if c.opts.Dir == "" {
+		return Entry{}, "", false
+	}
+	entry, err := c.readFile(key)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warn().Err(err).Str("key", key).Msg("Ignoring unreadable cache entry")
+		}
+		return Entry{}, "", false
+	}
+	if c.expired(&entry) {
+		c.mu.Lock()
+		c.forget(key)
+		c.mu.Unlock()
+		os.Remove(c.path(key))
+		return Entry{}, "", false
+	}
+
+	c.mu.Lock()
+	c.add(&entry)
+	c.mu.Unlock()
+	return entry, TierDisk, true
+}
+
+// Put stores an entry in both tiers
+func (c *Cache) Put(entry Entry) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	c.mu.Lock()
+	if el, ok := c.items[entry.Key]; ok {
+		c.remove(el)
+	}
+	c.add(&entry)
+	c.mu.Unlock()
+
+	if c.opts.Dir != "" {
+		if err := c.writeFile(entry); err != nil {
+			log.Warn().Err(err).Str("key", entry.Key).Msg("Failed to write cache entry")
+			return
+		}
+		c.mu.Lock()
+		c.forget(entry.Key)
+		c.disk[entry.Key] = c.files.PushFront(&diskEntry{key: entry.Key, written: time.Now()})
+		excess := c.trim()
+		c.mu.Unlock()
+		c.removeFiles(excess)
+	}
+}
+
+// Sweep removes expired entries from disk
+func (c *Cache) Sweep() {
+	if c.opts.Dir == "" || c.opts.TTL <= 0 {
+		return
+	}
+	c.mu.Lock()
+	var expired []string
+	for el := c.files.Back(); el != nil; el = c.files.Back() {
+		file := el.Value.(*diskEntry)
+		if time.Since(file.written) <= c.opts.TTL {
+			break
+		}
+		c.forget(file.key)
+		expired = append(expired, file.key)
+	}
+	c.mu.Unlock()
+	c.removeFiles(expired)
+}
+
+// Watch sweeps the disk tier at the given interval until the context ends
+func (c *Cache) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Sweep()
+		}
+	}
+}
+
+// Len returns the number of entries in memory
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// add inserts an entry and evicts the least recently used beyond the limit;
+// callers hold c.mu
+func (c *Cache) add(entry *Entry) {
+	c.items[entry.Key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.opts.MaxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops an entry from memory; callers hold c.mu
+func (c *Cache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.items, el.Value.(*Entry).Key)
+}
+
+// forget drops an entry from the disk index; callers hold c.mu
+func (c *Cache) forget(key string) {
+	if el, ok := c.disk[key]; ok {
+		c.files.Remove(el)
+		delete(c.disk, key)
+	}
+}
+
+// trim drops the oldest entries beyond the disk limit from the index and
+// returns their keys; callers hold c.mu and remove the files
+func (c *Cache) trim() []string {
+	var excess []string
+	for c.files.Len() > c.opts.MaxDiskEntries {
+		file := c.files.Back().Value.(*diskEntry)
+		c.forget(file.key)
+		excess = append(excess, file.key)
+	}
+	return excess
+}
+
+func (c *Cache) removeFiles(keys []string) {
+	for _, key := range keys {
+		if err := os.Remove(c.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Warn().Err(err).Str("key", key).Msg("Failed to remove cache entry")
+		}
+	}
+}
+
+// scan indexes the entries on disk by when they were written, removing
+// expired ones, those beyond the limit and temporary files of failed writes
+func (c *Cache) scan() error {
+	dirEntries, err := os.ReadDir(c.opts.Dir)
+	if err != nil {
+		return err
+	}
+	var found []*diskEntry
+	var stale []string
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(filepath.Join(c.opts.Dir, name))
+			continue
+		}
+		key, ok := strings.CutSuffix(name, ".json")
+		if !ok {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		if c.opts.TTL > 0 && time.Since(info.ModTime()) > c.opts.TTL {
+			stale = append(stale, key)
+			continue
+		}
+		found = append(found, &diskEntry{key: key, written: info.ModTime()})
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].written.Before(found[j].written) })
+	for _, file := range found {
+		c.disk[file.key] = c.files.PushFront(file)
+	}
+	c.removeFiles(append(stale, c.trim()...))
+	return nil
+}
+
+func (c *Cache) expired(entry *Entry) bool {
+	return c.opts.TTL > 0 && time.Since(entry.CreatedAt) > c.opts.TTL
+}
+
+// path returns the file an entry is stored in on disk
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.opts.Dir, key+".json")
+}
+
+func (c *Cache) readFile(key string) (Entry, error) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return Entry{}, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// writeFile stores an entry through a temporary file so readers never see a
+// partial one
+func (c *Cache) writeFile(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.opts.Dir, entry.Key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(entry.Key))
+}
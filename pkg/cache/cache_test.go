@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newCache(t *testing.T, opts Options) *Cache {
+	t.Helper()
+	c, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// assertGet checks the tier a key is found in, "" for a miss
+func assertGet(t *testing.T, c *Cache, key, wantTier string) {
+	t.Helper()
+	entry, tier, ok := c.Get(key)
+	if tier != wantTier || ok != (wantTier != "") {
+		t.Fatalf("Get(%s) = tier %q, found %t, want tier %q", key, tier, ok, wantTier)
+	}
+	if ok && entry.Reply != "reply "+key {
+		t.Fatalf("Get(%s) = %+v", key, entry)
+	}
+}
+
+// assertFiles checks which entries are on disk
+func assertFiles(t *testing.T, dir string, keys ...string) {
+	t.Helper()
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool, len(files))
+	for _, file := range files {
+		names[file.Name()] = true
+	}
+	if len(names) != len(keys) {
+		t.Fatalf("disk tier holds %v, want %v", names, keys)
+	}
+	for _, key := range keys {
+		if !names[key+".json"] {
+			t.Fatalf("disk tier holds %v, want %v", names, keys)
+		}
+	}
+}
+
+func put(c *Cache, keys ...string) {
+	for _, key := range keys {
+		c.Put(Entry{Key: key, Model: "ai/smollm2", Reply: "reply " + key})
+	}
+}
+
+func TestKey(t *testing.T) {
+	a := Key(map[string]interface{}{"model": "m", "messages": []string{"hi"}})
+	b := Key(map[string]interface{}{"messages": []string{"hi"}, "model": "m"})
+	if a != b || len(a) != 64 {
+		t.Fatalf("Key = %s and %s, want the same hex SHA-256", a, b)
+	}
+	if a == Key(map[string]interface{}{"model": "m", "messages": []string{"hello"}}) {
+		t.Fatal("different requests have the same key")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := newCache(t, Options{MaxEntries: 2})
+	put(c, "a", "b")
+	assertGet(t, c, "a", TierMemory) // b is now the least recently used
+	put(c, "c")
+
+	assertGet(t, c, "b", "")
+	assertGet(t, c, "a", TierMemory)
+	assertGet(t, c, "c", TierMemory)
+	if c.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", c.Len())
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := newCache(t, Options{TTL: time.Minute, Dir: t.TempDir()})
+	c.Put(Entry{Key: "old", Reply: "reply old", CreatedAt: time.Now().Add(-2 * time.Minute)})
+	put(c, "new")
+
+	assertGet(t, c, "old", "")
+	assertGet(t, c, "new", TierMemory)
+	// The expired entry is gone from both tiers
+	assertFiles(t, c.opts.Dir, "new")
+}
+
+func TestDiskTier(t *testing.T) {
+	dir := t.TempDir()
+	c := newCache(t, Options{MaxEntries: 1, Dir: dir})
+	put(c, "a", "b")
+
+	// a was evicted from memory but is still on disk, and is read back into memory
+	assertGet(t, c, "a", TierDisk)
+	assertGet(t, c, "a", TierMemory)
+
+	// A new cache finds the entries of the previous run
+	os.WriteFile(filepath.Join(dir, "c.123.tmp"), []byte("partial"), 0o644)
+	c = newCache(t, Options{MaxEntries: 1, Dir: dir})
+	assertFiles(t, dir, "a", "b")
+	assertGet(t, c, "b", TierDisk)
+}
+
+func TestDiskLimit(t *testing.T) {
+	dir := t.TempDir()
+	c := newCache(t, Options{MaxEntries: 1, MaxDiskEntries: 2, Dir: dir})
+	put(c, "a", "b", "c")
+	assertFiles(t, dir, "b", "c")
+	assertGet(t, c, "a", "")
+
+	// Rewriting an entry makes it the newest on disk
+	put(c, "b", "d")
+	assertFiles(t, dir, "b", "d")
+
+	// A smaller limit drops the oldest files when the cache is opened
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, "b.json"), old, old)
+	newCache(t, Options{MaxEntries: 1, MaxDiskEntries: 1, Dir: dir})
+	assertFiles(t, dir, "d")
+}
+
+func TestSweep(t *testing.T) {
+	dir := t.TempDir()
+	c := newCache(t, Options{TTL: 50 * time.Millisecond, Dir: dir})
+	put(c, "a")
+	time.Sleep(60 * time.Millisecond)
+	put(c, "b")
+
+	c.Sweep()
+	assertFiles(t, dir, "b")
+
+	// Expired files are also removed when the cache is opened
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, "b.json"), old, old)
+	newCache(t, Options{TTL: 50 * time.Millisecond, Dir: dir})
+	assertFiles(t, dir)
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/identity"
+)
+
+// Handler collects feedback on semantic cache hits
+type Handler struct {
+	semantic *Semantic
+}
+
+// NewHandler creates an HTTP handler for the semantic cache
+func NewHandler(semantic *Semantic) *Handler {
+	return &Handler{semantic: semantic}
+}
+
+// Register adds the semantic cache routes to the mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /cache/semantic/{id}/feedback", h.handleFeedback)
+	mux.HandleFunc("GET /cache/semantic/stats", h.handleStats)
+}
+
+// handleFeedback records {"correct": false} for a cached answer that did not
+// fit the question, or {"correct": true} for one that did
+func (h *Handler) handleFeedback(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Correct *bool `json:"correct"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Correct == nil {
+		http.Error(w, `Request body must set "correct"`, http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.semantic.Feedback(r.PathValue("id"), identity.TenantID(r), *req.Correct)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Cache entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":         entry.ID,
+		"hits":       entry.Hits,
+		"false_hits": entry.FalseHits,
+		"removed":    !*req.Correct,
+	})
+}
+
+// handleStats returns the hit and feedback totals, including the false-hit rate
+func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.semantic.Stats())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
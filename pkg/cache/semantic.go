@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/vectorindex"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrNotFound is returned for feedback on an entry the semantic cache no
+// longer holds
+var ErrNotFound = errors.New("cache entry not found")
+
+// SemanticOptions configures a semantic cache
+type SemanticOptions struct {
+	Threshold  float64       // Minimum cosine similarity for a hit
+	MaxEntries int           // Entries kept; the least recently used are evicted
+	TTL        time.Duration // Entries expire this long after they were stored; 0 keeps them
+
+	Lookups  *prometheus.CounterVec // Labelled by result: hit or miss
+	Feedback *prometheus.CounterVec // Labelled by verdict: correct or incorrect
+	Scores   prometheus.Observer    // Similarity of hits
+}
+
+// SemanticEntry is a reply cached with the embedding of the question
+type SemanticEntry struct {
+	ID        string    `json:"id"`
+	Scope     string    `json:"-"`
+	Tenant    string    `json:"-"`
+	Question  string    `json:"question"`
+	Reply     string    `json:"reply"`
+	CreatedAt time.Time `json:"created_at"`
+	Hits      int       `json:"hits"`
+	FalseHits int       `json:"false_hits"` // Hits reported as wrong answers
+
+	vector []float32
+}
+
+// SemanticStats summarizes how well the semantic cache answers
+type SemanticStats struct {
+	Entries      int     `json:"entries"`
+	Hits         int64   `json:"hits"`
+	Misses       int64   `json:"misses"`
+	Correct      int64   `json:"correct"`        // Hits reported as right
+	Incorrect    int64   `json:"incorrect"`      // Hits reported as wrong
+	FalseHitRate float64 `json:"false_hit_rate"` // Incorrect share of the hits with feedback
+}
+
+// Semantic caches replies by the meaning of the question: a question whose
+// embedding is close enough to a cached one, in the same scope, gets its
+// reply. Scopes keep tenants, models and prompts apart.
+type Semantic struct {
+	opts SemanticOptions
+
+	mu      sync.Mutex
+	index   *vectorindex.Index
+	lru     *list.List               // Most recently used first
+	entries map[string]*list.Element // Values are *SemanticEntry
+	deleted int                      // Entries removed since the index was built
+	stats   SemanticStats
+}
+
+// NewSemantic creates an empty semantic cache
+func NewSemantic(opts SemanticOptions) *Semantic {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	s := &Semantic{opts: opts, lru: list.New(), entries: make(map[string]*list.Element)}
+	s.index = newSemanticIndex()
+	return s
+}
+
+func newSemanticIndex() *vectorindex.Index {
+	idx, _ := vectorindex.New(0, vectorindex.DefaultOptions)
+	return idx
+}
+
+// lookupCandidates is how many of the most similar entries a lookup
+// considers, so expired ones do not hide a valid entry behind them
+const lookupCandidates = 5
+
+// Lookup returns the most similar unexpired entry in the scope, if it
+// reaches the threshold, and its similarity. Expired entries it comes
+// across are removed.
+func (s *Semantic) Lookup(scope string, vector []float32) (SemanticEntry, float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results, err := s.index.Search(vector, lookupCandidates, vectorindex.Filter{"scope": scope})
+	if err != nil {
+		s.miss()
+		return SemanticEntry{}, 0, false
+	}
+	for _, result := range results {
+		similarity := float64(result.Score)
+		if similarity < s.opts.Threshold {
+			break
+		}
+		el, ok := s.entries[result.ID]
+		if !ok {
+			continue
+		}
+		entry := el.Value.(*SemanticEntry)
+		if s.opts.TTL > 0 && time.Since(entry.CreatedAt) > s.opts.TTL {
+			s.remove(el)
+			continue
+		}
+
+		s.lru.MoveToFront(el)
+		entry.Hits++
+		s.stats.Hits++
+		if s.opts.Lookups != nil {
+			s.opts.Lookups.WithLabelValues("hit").Inc()
+		}
+		if s.opts.Scores != nil {
+			s.opts.Scores.Observe(similarity)
+		}
+		return *entry, similarity, true
+	}
+	s.miss()
+	return SemanticEntry{}, 0, false
+}
+
+// miss counts a lookup without a hit; callers hold s.mu
+func (s *Semantic) miss() {
+	s.stats.Misses++
+	if s.opts.Lookups != nil {
+		s.opts.Lookups.WithLabelValues("miss").Inc()
+	}
+}
+
+// Store caches a tenant's reply to a question in the scope
+func (s *Semantic) Store(scope, tenant, question, reply string, vector []float32) (SemanticEntry, error) {
+	entry := &SemanticEntry{
+		ID:        uuid.NewString(),
+		Scope:     scope,
+		Tenant:    tenant,
+		Question:  question,
+		Reply:     reply,
+		CreatedAt: time.Now().UTC(),
+		vector:    vector,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.index.Add(semanticItem(entry)); err != nil {
+		return SemanticEntry{}, err
+	}
+	s.entries[entry.ID] = s.lru.PushFront(entry)
+	for s.lru.Len() > s.opts.MaxEntries {
+		s.remove(s.lru.Back())
+	}
+	return *entry, nil
+}
+
+// Feedback records whether a hit answered a tenant's question. A wrong
+// answer also removes the entry so it is not served again. Entries of other
+// tenants are not found.
+func (s *Semantic) Feedback(id, tenant string, correct bool) (SemanticEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[id]
+	if !ok || el.Value.(*SemanticEntry).Tenant != tenant {
+		return SemanticEntry{}, ErrNotFound
+	}
+	entry := el.Value.(*SemanticEntry)
+
+	verdict := "correct"
+	if correct {
+		s.stats.Correct++
+	} else {
+		verdict = "incorrect"
+		entry.FalseHits++
+		s.stats.Incorrect++
+		s.remove(el)
+	}
+	if s.opts.Feedback != nil {
+		s.opts.Feedback.WithLabelValues(verdict).Inc()
+	}
+	return *entry, nil
+}
+
+// Stats returns the hit and feedback totals
+func (s *Semantic) Stats() SemanticStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Entries = s.lru.Len()
+	if rated := stats.Correct + stats.Incorrect; rated > 0 {
+		stats.FalseHitRate = float64(stats.Incorrect) / float64(rated)
+	}
+	return stats
+}
+
+// remove drops an entry, rebuilding the index once removed entries outnumber
+// the live ones since the index keeps them as tombstones; callers hold s.mu
+func (s *Semantic) remove(el *list.Element) {
+	entry := el.Value.(*SemanticEntry)
+	s.lru.Remove(el)
+	delete(s.entries, entry.ID)
+	s.index.Delete(entry.ID)
+
+	s.deleted++
+	if s.deleted <= s.lru.Len() {
+		return
+	}
+	s.index, s.deleted = newSemanticIndex(), 0
+	for el := s.lru.Back(); el != nil; el = el.Prev() {
+		s.index.Add(semanticItem(el.Value.(*SemanticEntry)))
+	}
+}
+
+func semanticItem(entry *SemanticEntry) vectorindex.Item {
+	return vectorindex.Item{ID: entry.ID, Vector: entry.vector, Metadata: map[string]string{"scope": entry.Scope}}
+}
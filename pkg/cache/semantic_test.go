@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func store(t *testing.T, s *Semantic, scope, tenant, question string, vector []float32) SemanticEntry {
+	t.Helper()
+	entry, err := s.Store(scope, tenant, question, "reply to "+question, vector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestSemanticThreshold(t *testing.T) {
+	lookups := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "semantic_cache_lookups_total"}, []string{"result"})
+	s := NewSemantic(SemanticOptions{Threshold: 0.95, Lookups: lookups})
+	capital := store(t, s, "acme/ai/smollm2", "acme", "What is the capital of France?", []float32{1, 0, 0})
+	store(t, s, "acme/ai/smollm2", "acme", "How tall is Everest?", []float32{0, 1, 0})
+
+	entry, similarity, ok := s.Lookup("acme/ai/smollm2", []float32{0.95, 0.05, 0})
+	if !ok || entry.ID != capital.ID || similarity < 0.95 {
+		t.Fatalf("Lookup of a close question = %+v, %v, %t, want the capital entry", entry, similarity, ok)
+	}
+	if entry.Hits != 1 {
+		t.Fatalf("Hits = %d, want 1", entry.Hits)
+	}
+	// Similar, but below the threshold
+	if _, _, ok := s.Lookup("acme/ai/smollm2", []float32{0.7, 0.7, 0}); ok {
+		t.Fatal("Lookup below the threshold was a hit")
+	}
+	// The same question in another scope, such as another tenant or model
+	if _, _, ok := s.Lookup("other/ai/smollm2", []float32{1, 0, 0}); ok {
+		t.Fatal("Lookup in another scope was a hit")
+	}
+
+	stats := s.Stats()
+	if stats.Entries != 2 || stats.Hits != 1 || stats.Misses != 2 {
+		t.Fatalf("Stats = %+v, want 2 entries, 1 hit and 2 misses", stats)
+	}
+	if got := testutil.ToFloat64(lookups.WithLabelValues("miss")); got != 2 {
+		t.Fatalf("misses counted = %v, want 2", got)
+	}
+}
+
+func TestSemanticExpiry(t *testing.T) {
+	s := NewSemantic(SemanticOptions{Threshold: 0.9, TTL: 50 * time.Millisecond})
+	store(t, s, "scope", "acme", "old", []float32{1, 0})
+	time.Sleep(60 * time.Millisecond)
+	// An expired entry closer to the question does not hide a valid one
+	fresh := store(t, s, "scope", "acme", "new", []float32{0.95, 0.05})
+
+	entry, _, ok := s.Lookup("scope", []float32{1, 0})
+	if !ok || entry.ID != fresh.ID {
+		t.Fatalf("Lookup = %+v, %t, want the unexpired entry", entry, ok)
+	}
+	if s.Stats().Entries != 1 {
+		t.Fatalf("Entries = %d, want the expired one removed", s.Stats().Entries)
+	}
+}
+
+func TestSemanticEviction(t *testing.T) {
+	s := NewSemantic(SemanticOptions{Threshold: 0.9, MaxEntries: 2})
+	first := store(t, s, "scope", "acme", "first", []float32{1, 0, 0})
+	store(t, s, "scope", "acme", "second", []float32{0, 1, 0})
+	s.Lookup("scope", []float32{1, 0, 0}) // second is now the least recently used
+	store(t, s, "scope", "acme", "third", []float32{0, 0, 1})
+
+	if _, _, ok := s.Lookup("scope", []float32{0, 1, 0}); ok {
+		t.Fatal("least recently used entry was not evicted")
+	}
+	if entry, _, ok := s.Lookup("scope", []float32{1, 0, 0}); !ok || entry.ID != first.ID {
+		t.Fatal("recently used entry was evicted")
+	}
+}
+
+func TestSemanticFeedback(t *testing.T) {
+	feedback := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "semantic_cache_feedback_total"}, []string{"verdict"})
+	s := NewSemantic(SemanticOptions{Threshold: 0.9, Feedback: feedback})
+	right := store(t, s, "scope", "acme", "right", []float32{1, 0})
+	wrong := store(t, s, "scope", "acme", "wrong", []float32{0, 1})
+
+	if _, err := s.Feedback(right.ID, "acme", true); err != nil {
+		t.Fatal(err)
+	}
+	// Other tenants cannot rate or remove the entry
+	if _, err := s.Feedback(wrong.ID, "globex", false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Feedback from another tenant: err = %v, want ErrNotFound", err)
+	}
+	entry, err := s.Feedback(wrong.ID, "acme", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.FalseHits != 1 {
+		t.Fatalf("FalseHits = %d, want 1", entry.FalseHits)
+	}
+	// A wrong answer is not served again
+	if _, _, ok := s.Lookup("scope", []float32{0, 1}); ok {
+		t.Fatal("entry reported wrong is still served")
+	}
+	if _, err := s.Feedback(wrong.ID, "acme", false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Feedback on a removed entry: err = %v, want ErrNotFound", err)
+	}
+
+	stats := s.Stats()
+	if stats.Correct != 1 || stats.Incorrect != 1 || stats.FalseHitRate != 0.5 || stats.Entries != 1 {
+		t.Fatalf("Stats = %+v, want one of each verdict and a false-hit rate of 0.5", stats)
+	}
+	if got := testutil.ToFloat64(feedback.WithLabelValues("incorrect")); got != 1 {
+		t.Fatalf("incorrect verdicts counted = %v, want 1", got)
+	}
+}
+
+func TestFeedbackHandler(t *testing.T) {
+	s := NewSemantic(SemanticOptions{Threshold: 0.9})
+	entry := store(t, s, "scope", "acme", "question", []float32{1, 0})
+	mux := http.NewServeMux()
+	NewHandler(s).Register(mux)
+
+	post := func(id, tenant, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/cache/semantic/"+id+"/feedback", strings.NewReader(body))
+		r.Header.Set("X-Tenant-ID", tenant)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := post(entry.ID, "acme", `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("feedback without a verdict: status = %d, want 400", w.Code)
+	}
+	if w := post(entry.ID, "globex", `{"correct": false}`); w.Code != http.StatusNotFound {
+		t.Fatalf("feedback from another tenant: status = %d, want 404", w.Code)
+	}
+	w := post(entry.ID, "acme", `{"correct": false}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"removed":true`) {
+		t.Fatalf("feedback = %d %s, want the entry removed", w.Code, w.Body)
+	}
+}
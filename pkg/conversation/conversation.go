@@ -0,0 +1,161 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned when a conversation does not exist
+	ErrNotFound = errors.New("conversation not found")
+	// ErrMessageNotFound is returned when a message is not part of the conversation
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+// Message is a single stored turn of a conversation. Messages form a tree:
+// each message replies to its parent, and siblings are alternative branches
+// created by regenerating or editing.
+type Message struct {
+	ID        string    `json:"id"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Conversation is a persisted chat session
+type Conversation struct {
+	ID      string `json:"id"`
+	UserID  string `json:"user_id,omitempty"`
+	Title   string `json:"title"`
+	HeadID  string `json:"head_id,omitempty"` // Leaf of the active branch
+	Summary string `json:"summary,omitempty"` // Rolling summary generated in the background
+	// SummarizedThrough is the last message covered by Summary
+	SummarizedThrough string    `json:"-"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	MessageCount      int       `json:"message_count"`
+	Messages          []Message `json:"messages,omitempty"`
+}
+
+// Store persists conversations and their messages
+type Store interface {
+	// Create stores a new conversation, assigning its ID and timestamps.
+	// Initial messages are chained into a single branch.
+	Create(ctx context.Context, conv *Conversation) error
+	// List returns the conversations owned by a user, most recently updated first.
+	// A non-empty query keeps only conversations whose title or summary contains
+	// it (case-insensitive). Messages are not populated.
+	List(ctx context.Context, userID, query string) ([]Conversation, error)
+	// Get returns a conversation with every message of its tree in creation order
+	Get(ctx context.Context, id string) (*Conversation, error)
+	// Delete removes a conversation and its messages
+	Delete(ctx context.Context, id string) error
+	// AppendMessages chains messages below parentID ("" for the root) and makes
+	// the last one the conversation head. It returns the messages with their
+	// IDs, parents and timestamps assigned.
+	AppendMessages(ctx context.Context, id, parentID string, msgs ...Message) ([]Message, error)
+	// SetHead switches the active branch to the one ending at messageID
+	SetHead(ctx context.Context, id, messageID string) error
+	// UpdateSummary stores a generated summary covering the branch up to
+	// throughID. A non-empty title replaces the current one.
+	UpdateSummary(ctx context.Context, id, title, summary, throughID string) error
+	// Import stores conversations whose messages already have IDs, parents
+	// and timestamps, keeping their trees and heads. Each conversation gets a
+	// new ID and timestamps. Either every conversation is stored or none is.
+	Import(ctx context.Context, convs []*Conversation) error
+	// Ping checks that the store can be reached
+	Ping(ctx context.Context) error
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// NewStore creates a store for the given backend ("memory" or "sqlite")
+func NewStore(backend, dbPath string) (Store, error) {
+	switch backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "sqlite":
+		return NewSQLiteStore(dbPath)
+	default:
+		return nil, errors.New("unknown conversation store: " + backend)
+	}
+}
+
+// Message returns the message with the given ID
+func (c *Conversation) Message(id string) (Message, bool) {
+	for _, msg := range c.Messages {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// Branch returns the linear history from the root to leafID inclusive.
+// An empty leafID yields an empty history.
+func (c *Conversation) Branch(leafID string) ([]Message, error) {
+	byID := make(map[string]Message, len(c.Messages))
+	for _, msg := range c.Messages {
+		byID[msg.ID] = msg
+	}
+
+	var branch []Message
+	for id := leafID; id != ""; {
+		msg, ok := byID[id]
+		if !ok || len(branch) > len(c.Messages) {
+			return nil, ErrMessageNotFound
+		}
+		branch = append(branch, msg)
+		id = msg.ParentID
+	}
+
+	// Reverse into root-first order
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+	return branch, nil
+}
+
+// ActiveBranch returns the linear history of the branch ending at the head
+func (c *Conversation) ActiveBranch() []Message {
+	branch, err := c.Branch(c.HeadID)
+	if err != nil {
+		return nil
+	}
+	return branch
+}
+
+// newID generates a new unique identifier
+func newID() string {
+	return uuid.New().String()
+}
+
+// stampMessages assigns IDs and timestamps to messages that lack them and
+// chains them into a branch below parentID
+func stampMessages(msgs []Message, parentID string, now time.Time) []Message {
+	stamped := make([]Message, len(msgs))
+	for i, msg := range msgs {
+		if msg.ID == "" {
+			msg.ID = newID()
+		}
+		if msg.CreatedAt.IsZero() {
+			msg.CreatedAt = now
+		}
+		msg.ParentID = parentID
+		parentID = msg.ID
+		stamped[i] = msg
+	}
+	return stamped
+}
+
+// lastID returns the ID of the last message, or "" if there are none
+func lastID(msgs []Message) string {
+	if len(msgs) == 0 {
+		return ""
+	}
+	return msgs[len(msgs)-1].ID
+}
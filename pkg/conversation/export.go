@@ -0,0 +1,331 @@
+package conversation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatJSONL    = "jsonl" // OpenAI fine-tuning format, one conversation per line
+)
+
+// ErrUnsupportedFormat is returned for unknown export or import formats
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// ContentType returns the MIME type and file extension for an export format
+func ContentType(format string) (string, string, error) {
+	switch format {
+	case FormatJSON:
+		return "application/json", "json", nil
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8", "md", nil
+	case FormatHTML:
+		return "text/html; charset=utf-8", "html", nil
+	case FormatJSONL:
+		return "application/jsonl", "jsonl", nil
+	default:
+		return "", "", ErrUnsupportedFormat
+	}
+}
+
+// chatMessage is the role/content pair used by the fine-tuning format
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// fineTuningExample is one line of an OpenAI fine-tuning JSONL file
+type fineTuningExample struct {
+	Messages []chatMessage `json:"messages"`
+}
+
+// jsonExport is the document written by the JSON format
+type jsonExport struct {
+	Conversations []*Conversation `json:"conversations"`
+}
+
+// Export writes conversations in the given format. JSON keeps the full
+// message tree so it can be imported losslessly; the other formats contain
+// the active branch of each conversation.
+func Export(w io.Writer, format string, convs []*Conversation) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(jsonExport{Conversations: convs})
+	case FormatMarkdown:
+		return exportMarkdown(w, convs)
+	case FormatHTML:
+		return exportHTML(w, convs)
+	case FormatJSONL:
+		return exportJSONL(w, convs)
+	default:
+		return ErrUnsupportedFormat
+	}
+}
+
+func exportMarkdown(w io.Writer, convs []*Conversation) error {
+	var buf bytes.Buffer
+	for i, conv := range convs {
+		if i > 0 {
+			buf.WriteString("\n---\n\n")
+		}
+		fmt.Fprintf(&buf, "# %s\n\n", displayTitle(conv))
+		fmt.Fprintf(&buf, "_Created %s_\n", conv.CreatedAt.Format("2006-01-02 15:04 MST"))
+		for _, msg := range conv.ActiveBranch() {
+			fmt.Fprintf(&buf, "\n### %s\n\n%s\n", roleLabel(msg.Role), strings.TrimSpace(msg.Content))
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+var htmlTemplate = template.Must(template.New("export").Funcs(template.FuncMap{
+	"title": displayTitle,
+	"role":  roleLabel,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Conversation export</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; color: #111827; }
+section { margin-bottom: 3rem; }
+.message { padding: 0.75rem 1rem; border-radius: 0.5rem; margin: 0.75rem 0; white-space: pre-wrap; }
+.user { background: #dbeafe; }
+.assistant { background: #f3f4f6; }
+.system { background: #fef3c7; }
+.role { font-weight: 600; font-size: 0.85rem; margin-bottom: 0.25rem; }
+time { color: #6b7280; font-size: 0.85rem; }
+</style>
+</head>
+<body>
+{{range .}}<section>
+<h1>{{title .}}</h1>
+<time datetime="{{.CreatedAt.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.Format "2006-01-02 15:04 MST"}}</time>
+{{range .ActiveBranch}}<div class="message {{.Role}}"><div class="role">{{role .Role}}</div>{{.Content}}</div>
+{{end}}</section>
+{{end}}</body>
+</html>
+`))
+
+func exportHTML(w io.Writer, convs []*Conversation) error {
+	return htmlTemplate.Execute(w, convs)
+}
+
+func exportJSONL(w io.Writer, convs []*Conversation) error {
+	enc := json.NewEncoder(w)
+	for _, conv := range convs {
+		example := fineTuningExample{Messages: make([]chatMessage, 0)}
+		for _, msg := range conv.ActiveBranch() {
+			example.Messages = append(example.Messages, chatMessage{Role: msg.Role, Content: msg.Content})
+		}
+		if len(example.Messages) == 0 {
+			continue
+		}
+		if err := enc.Encode(example); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parse reads conversations exported in the JSON or JSONL format. The JSON
+// format also accepts a single conversation object or a bare array.
+func Parse(r io.Reader, format string) ([]*Conversation, error) {
+	switch format {
+	case FormatJSON:
+		return parseJSON(r)
+	case FormatJSONL:
+		return parseJSONL(r)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+func parseJSON(r io.Reader) ([]*Conversation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+
+	var convs []*Conversation
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		err = json.Unmarshal(data, &convs)
+	default:
+		var doc struct {
+			jsonExport
+			Conversation
+		}
+		if err = json.Unmarshal(data, &doc); err == nil {
+			convs = doc.Conversations
+			if convs == nil {
+				convs = []*Conversation{&doc.Conversation}
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON export: %w", err)
+	}
+
+	for i, conv := range convs {
+		if conv == nil || !validMessages(conv.Messages) {
+			return nil, fmt.Errorf("conversation %d: messages require a role and content", i+1)
+		}
+	}
+	return convs, nil
+}
+
+func parseJSONL(r io.Reader) ([]*Conversation, error) {
+	var convs []*Conversation
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var example fineTuningExample
+		if err := json.Unmarshal(text, &example); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		conv := &Conversation{}
+		for _, msg := range example.Messages {
+			conv.Messages = append(conv.Messages, Message{Role: msg.Role, Content: msg.Content})
+		}
+		if len(conv.Messages) == 0 || !validMessages(conv.Messages) {
+			return nil, fmt.Errorf("line %d: messages require a role and content", line)
+		}
+		convs = append(convs, conv)
+	}
+	return convs, scanner.Err()
+}
+
+// ErrInvalidTree is returned for imported conversations whose messages do
+// not form a tree
+var ErrInvalidTree = errors.New("messages do not form a tree")
+
+// Import stores parsed conversations for a user. Message IDs are reassigned
+// so imports never collide with existing conversations, while the tree shape,
+// active branch and message timestamps are preserved. Every conversation is
+// checked before any is stored, and either all of them are stored or none.
+func Import(ctx context.Context, store Store, userID string, convs []*Conversation) ([]Conversation, error) {
+	trees := make([]*Conversation, len(convs))
+	for i, src := range convs {
+		if err := src.checkTree(); err != nil {
+			return nil, fmt.Errorf("conversation %d: %w", i+1, err)
+		}
+		trees[i] = src.reassign(userID)
+	}
+	if err := store.Import(ctx, trees); err != nil {
+		return nil, err
+	}
+
+	imported := make([]Conversation, len(trees))
+	for i, conv := range trees {
+		imported[i] = *conv
+		imported[i].Messages = nil
+	}
+	return imported, nil
+}
+
+// hasTree reports whether the messages carry IDs and parent links, as opposed
+// to a plain linear list
+func (c *Conversation) hasTree() bool {
+	for _, msg := range c.Messages {
+		if msg.ID == "" {
+			return false
+		}
+	}
+	return len(c.Messages) > 0
+}
+
+// checkTree reports why the messages of a tree cannot be imported: IDs must
+// be unique, parents must come before their children, and the head must be
+// one of the messages. Linear lists are always valid.
+func (c *Conversation) checkTree() error {
+	if !c.hasTree() {
+		return nil
+	}
+	seen := make(map[string]bool, len(c.Messages))
+	for i, msg := range c.Messages {
+		if seen[msg.ID] {
+			return fmt.Errorf("%w: message %d has a duplicate id %q", ErrInvalidTree, i+1, msg.ID)
+		}
+		if msg.ParentID != "" && !seen[msg.ParentID] {
+			return fmt.Errorf("%w: parent %q of message %d is not an earlier message", ErrInvalidTree, msg.ParentID, i+1)
+		}
+		seen[msg.ID] = true
+	}
+	if c.HeadID != "" && !seen[c.HeadID] {
+		return fmt.Errorf("%w: head %q is not a message", ErrInvalidTree, c.HeadID)
+	}
+	return nil
+}
+
+// reassign copies a checked conversation for a user with new message IDs.
+// Linear lists are chained into a single branch ending at the head.
+func (c *Conversation) reassign(userID string) *Conversation {
+	conv := &Conversation{UserID: userID, Title: c.Title}
+	tree := c.hasTree()
+	newIDs := make(map[string]string, len(c.Messages))
+	now := time.Now().UTC()
+	parentID := ""
+	for _, msg := range c.Messages {
+		if tree {
+			parentID = newIDs[msg.ParentID]
+		}
+		if msg.CreatedAt.IsZero() {
+			msg.CreatedAt = now
+		}
+		id := newID()
+		newIDs[msg.ID] = id
+		conv.Messages = append(conv.Messages, Message{ID: id, ParentID: parentID, Role: msg.Role, Content: msg.Content, CreatedAt: msg.CreatedAt})
+		parentID = id
+	}
+
+	conv.HeadID = lastID(conv.Messages)
+	if head, ok := newIDs[c.HeadID]; tree && ok && c.HeadID != "" {
+		conv.HeadID = head
+	}
+	return conv
+}
+
+// displayTitle returns the conversation title or a placeholder
+func displayTitle(conv *Conversation) string {
+	if conv.Title != "" {
+		return conv.Title
+	}
+	return "Untitled conversation"
+}
+
+// roleLabel returns a human-readable label for a message role
+func roleLabel(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	case "system":
+		return "System"
+	default:
+		return role
+	}
+}
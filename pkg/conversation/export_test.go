@@ -0,0 +1,164 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// treeConversation stores a conversation whose reply was regenerated, so it
+// has two branches with the first one active
+func treeConversation(t *testing.T, store Store) *Conversation {
+	t.Helper()
+	ctx := context.Background()
+	conv := &Conversation{UserID: "alice", Title: "Colors", Messages: []Message{
+		{Role: "user", Content: "Name a color", CreatedAt: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)},
+		{Role: "assistant", Content: "Blue"},
+	}}
+	if err := store.Create(ctx, conv); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AppendMessages(ctx, conv.ID, conv.Messages[0].ID, Message{Role: "assistant", Content: "Green"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetHead(ctx, conv.ID, conv.Messages[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.Get(ctx, conv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		src := treeConversation(t, store)
+
+		var buf bytes.Buffer
+		if err := Export(&buf, FormatJSON, []*Conversation{src}); err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := Parse(&buf, FormatJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported, err := Import(ctx, store, "bob", parsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(imported) != 1 || imported[0].ID == src.ID || imported[0].UserID != "bob" || imported[0].MessageCount != 3 {
+			t.Fatalf("imported = %+v, want a new conversation of bob's with 3 messages", imported)
+		}
+
+		got, err := store.Get(ctx, imported[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != "Colors" || len(got.Messages) != 3 {
+			t.Fatalf("imported conversation = %+v", got)
+		}
+		for i, msg := range got.Messages {
+			if msg.ID == src.Messages[i].ID {
+				t.Fatalf("message %d kept its ID %s", i, msg.ID)
+			}
+			if msg.Content != src.Messages[i].Content || !msg.CreatedAt.Equal(src.Messages[i].CreatedAt) {
+				t.Fatalf("message %d = %+v, want %+v", i, msg, src.Messages[i])
+			}
+		}
+		// Both replies answer the question, and the first one is still active
+		if got.Messages[1].ParentID != got.Messages[0].ID || got.Messages[2].ParentID != got.Messages[0].ID {
+			t.Fatalf("imported tree = %+v, want both replies below the question", got.Messages)
+		}
+		assertBranch(t, got.ActiveBranch(), "Name a color", "Blue")
+	})
+}
+
+func TestExportFormats(t *testing.T) {
+	src := treeConversation(t, NewMemoryStore())
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatMarkdown, []string{"# Colors", "### User\n\nName a color", "### Assistant\n\nBlue"}},
+		{FormatHTML, []string{"<h1>Colors</h1>", `<div class="message assistant">`, "Blue"}},
+		{FormatJSONL, []string{`{"messages":[{"role":"user","content":"Name a color"},{"role":"assistant","content":"Blue"}]}`}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Export(&buf, tt.format, []*Conversation{src}); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s export lacks %q:\n%s", tt.format, want, buf.String())
+			}
+		}
+		// Only the active branch is exported
+		if strings.Contains(buf.String(), "Green") {
+			t.Errorf("%s export contains the inactive branch", tt.format)
+		}
+	}
+
+	if err := Export(&bytes.Buffer{}, "pdf", nil); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("Export as pdf: err = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestImportJSONL(t *testing.T) {
+	store := NewMemoryStore()
+	lines := `{"messages":[{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello"}]}` + "\n\n" +
+		`{"messages":[{"role":"user","content":"Bye"}]}` + "\n"
+	parsed, err := Parse(strings.NewReader(lines), FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := Import(context.Background(), store, "alice", parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("imported %d conversations, want 2", len(imported))
+	}
+	got, _ := store.Get(context.Background(), imported[0].ID)
+	assertBranch(t, got.ActiveBranch(), "Hi", "Hello")
+
+	if _, err := Parse(strings.NewReader(`{"messages":[{"role":"user"}]}`), FormatJSONL); err == nil {
+		t.Fatal("expected an error for a message without content")
+	}
+}
+
+func TestImportRejectsInvalidTrees(t *testing.T) {
+	tests := map[string]string{
+		"duplicate id":   `[{"messages":[{"id":"a","role":"user","content":"Hi"},{"id":"a","parent_id":"a","role":"assistant","content":"Hello"}]}]`,
+		"missing parent": `[{"messages":[{"id":"a","role":"user","content":"Hi"},{"id":"b","parent_id":"x","role":"assistant","content":"Hello"}]}]`,
+		"parent after":   `[{"messages":[{"id":"b","parent_id":"a","role":"assistant","content":"Hello"},{"id":"a","role":"user","content":"Hi"}]}]`,
+		"missing head":   `[{"head_id":"x","messages":[{"id":"a","role":"user","content":"Hi"}]}]`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := NewMemoryStore()
+			mux := http.NewServeMux()
+			NewHandler(store).Register(mux)
+
+			// A valid conversation ahead of the invalid one is not stored either
+			valid := `{"messages":[{"role":"user","content":"Fine"}]},`
+			r := httptest.NewRequest(http.MethodPost, "/conversations/import", strings.NewReader("["+valid+body[1:]))
+			r.Header.Set("X-User-ID", "alice")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+			}
+			if convs, _ := store.List(context.Background(), "alice", ""); len(convs) != 0 {
+				t.Fatalf("stored %d conversations from a rejected import", len(convs))
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/identity"
+	"github.com/rs/zerolog/log"
+)
+
+// Handler serves the conversation REST API
+type Handler struct {
+	store Store
+}
+
+// NewHandler creates a handler backed by the given store
+func NewHandler(store Store) *Handler {
+	return &Handler{store: store}
+}
+
+// Register adds the conversation routes to the mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /conversations", h.handleCreate)
+	mux.HandleFunc("GET /conversations", h.handleList)
+	mux.HandleFunc("GET /conversations/{id}", h.handleGet)
+	mux.HandleFunc("DELETE /conversations/{id}", h.handleDelete)
+	mux.HandleFunc("POST /conversations/{id}/messages", h.handleAppend)
+	mux.HandleFunc("GET /conversations/{id}/branches/{messageID}", h.handleBranch)
+	mux.HandleFunc("PUT /conversations/{id}/head", h.handleSetHead)
+	mux.HandleFunc("GET /conversations/{id}/export", h.handleExport)
+	mux.HandleFunc("GET /conversations/export", h.handleExportAll)
+	mux.HandleFunc("POST /conversations/import", h.handleImport)
+}
+
+// maxImportBytes bounds the size of an import upload
+const maxImportBytes = 32 << 20
+
+// createRequest is the body accepted when creating a conversation
+type createRequest struct {
+	Title    string    `json:"title"`
+	Messages []Message `json:"messages"`
+}
+
+// appendRequest is the body accepted when appending turns. ParentID defaults
+// to the conversation head; an explicit "" starts a new branch at the root.
+type appendRequest struct {
+	ParentID *string   `json:"parent_id"`
+	Messages []Message `json:"messages"`
+}
+
+// setHeadRequest is the body accepted when switching the active branch
+type setHeadRequest struct {
+	MessageID string `json:"message_id"`
+}
+
+func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validMessages(req.Messages) {
+		http.Error(w, "Messages require a role and content", http.StatusBadRequest)
+		return
+	}
+
+	conv := &Conversation{
+		UserID:   identity.UserID(r),
+		Title:    req.Title,
+		Messages: req.Messages,
+	}
+	if err := h.store.Create(r.Context(), conv); err != nil {
+		log.Error().Err(err).Msg("Failed to create conversation")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, conv)
+}
+
+// handleList lists the caller's conversations, optionally filtered by ?q=
+// against titles and summaries
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	convs, err := h.store.List(r.Context(), identity.UserID(r), r.URL.Query().Get("q"))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list conversations")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"conversations": convs})
+}
+
+// handleGet returns the conversation with its active branch, or every
+// message of the tree when called with ?view=tree
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	conv, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("view") != "tree" {
+		conv.Messages = conv.ActiveBranch()
+	}
+	writeJSON(w, http.StatusOK, conv)
+}
+
+// handleBranch returns the linear history ending at a message
+func (h *Handler) handleBranch(w http.ResponseWriter, r *http.Request) {
+	conv, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	branch, err := conv.Branch(r.PathValue("messageID"))
+	if err != nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"messages": branch})
+}
+
+func (h *Handler) handleSetHead(w http.ResponseWriter, r *http.Request) {
+	conv, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	var req setHeadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.store.SetHead(r.Context(), conv.ID, req.MessageID)
+	switch {
+	case errors.Is(err, ErrMessageNotFound):
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Error().Err(err).Str("conversation_id", conv.ID).Msg("Failed to set conversation head")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	conv, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.Delete(r.Context(), conv.ID); err != nil && !errors.Is(err, ErrNotFound) {
+		log.Error().Err(err).Str("conversation_id", conv.ID).Msg("Failed to delete conversation")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleAppend(w http.ResponseWriter, r *http.Request) {
+	conv, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	var req appendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Messages) == 0 || !validMessages(req.Messages) {
+		http.Error(w, "Messages require a role and content", http.StatusBadRequest)
+		return
+	}
+
+	parentID := conv.HeadID
+	if req.ParentID != nil {
+		parentID = *req.ParentID
+	}
+
+	appended, err := h.store.AppendMessages(r.Context(), conv.ID, parentID, req.Messages...)
+	if errors.Is(err, ErrMessageNotFound) {
+		http.Error(w, "Parent message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("conversation_id", conv.ID).Msg("Failed to append messages")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"messages": appended})
+}
+
+// handleExport downloads a single conversation
+func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
+	conv, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeExport(w, r, "conversation-"+conv.ID, []*Conversation{conv})
+}
+
+// handleExportAll downloads every conversation of the requesting user
+func (h *Handler) handleExportAll(w http.ResponseWriter, r *http.Request) {
+	summaries, err := h.store.List(r.Context(), identity.UserID(r), "")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list conversations")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	convs := make([]*Conversation, 0, len(summaries))
+	for _, summary := range summaries {
+		conv, err := h.store.Get(r.Context(), summary.ID)
+		if errors.Is(err, ErrNotFound) {
+			continue // Deleted since listing
+		}
+		if err != nil {
+			log.Error().Err(err).Str("conversation_id", summary.ID).Msg("Failed to load conversation")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		convs = append(convs, conv)
+	}
+
+	h.writeExport(w, r, "conversations", convs)
+}
+
+// writeExport renders conversations in the format named by ?format= (JSON by default)
+func (h *Handler) writeExport(w http.ResponseWriter, r *http.Request, filename string, convs []*Conversation) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatJSON
+	}
+	contentType, ext, err := ContentType(format)
+	if err != nil {
+		http.Error(w, "Unsupported format, expected json, markdown, html or jsonl", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, ext))
+	if err := Export(w, format, convs); err != nil {
+		log.Error().Err(err).Str("format", format).Msg("Failed to export conversations")
+	}
+}
+
+// handleImport stores conversations uploaded in the JSON or JSONL format.
+// The format comes from ?format= or else the Content-Type.
+func (h *Handler) handleImport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatJSON
+		if strings.Contains(r.Header.Get("Content-Type"), "jsonl") ||
+			strings.Contains(r.Header.Get("Content-Type"), "ndjson") {
+			format = FormatJSONL
+		}
+	}
+
+	convs, err := Parse(http.MaxBytesReader(w, r.Body, maxImportBytes), format)
+	if errors.Is(err, ErrUnsupportedFormat) {
+		http.Error(w, "Unsupported format, expected json or jsonl", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid import: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	imported, err := Import(r.Context(), h.store, identity.UserID(r), convs)
+	if errors.Is(err, ErrInvalidTree) {
+		http.Error(w, "Invalid import: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Int("conversations", len(convs)).Msg("Failed to import conversations")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"conversations": imported})
+}
+
+// load fetches the conversation named in the path and checks that the caller
+// owns it. It writes the error response and returns false on failure.
+func (h *Handler) load(w http.ResponseWriter, r *http.Request) (*Conversation, bool) {
+	conv, err := LoadForUser(r, h.store, r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return nil, false
+	case err != nil:
+		log.Error().Err(err).Msg("Failed to load conversation")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return conv, true
+}
+
+// LoadForUser fetches a conversation on behalf of the request's user.
+// Conversations owned by someone else are reported as ErrNotFound so their
+// existence is not leaked.
+func LoadForUser(r *http.Request, store Store, id string) (*Conversation, error) {
+	conv, err := store.Get(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if conv.UserID != identity.UserID(r) {
+		return nil, ErrNotFound
+	}
+	return conv, nil
+}
+
+// validMessages reports whether every message has a supported role and content
+func validMessages(msgs []Message) bool {
+	for _, msg := range msgs {
+		switch msg.Role {
+		case "system", "user", "assistant":
+		default:
+			return false
+		}
+		if msg.Content == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("Failed to encode response")
+	}
+}
@@ -0,0 +1,180 @@
+package conversation
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps conversations in process memory. Contents are lost on restart.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	conversations map[string]*Conversation
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		conversations: make(map[string]*Conversation),
+	}
+}
+
+// Create stores a new conversation
+func (s *MemoryStore) Create(ctx context.Context, conv *Conversation) error {
+	now := time.Now().UTC()
+	conv.ID = newID()
+	conv.CreatedAt = now
+	conv.UpdatedAt = now
+	conv.Messages = stampMessages(conv.Messages, "", now)
+	conv.MessageCount = len(conv.Messages)
+	conv.HeadID = lastID(conv.Messages)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conversations[conv.ID] = copyConversation(conv)
+	return nil
+}
+
+// List returns the conversations owned by a user
+func (s *MemoryStore) List(ctx context.Context, userID, query string) ([]Conversation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	convs := make([]Conversation, 0)
+	for _, conv := range s.conversations {
+		if conv.UserID != userID {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(conv.Title), query) &&
+			!strings.Contains(strings.ToLower(conv.Summary), query) {
+			continue
+		}
+		summary := *conv
+		summary.Messages = nil
+		convs = append(convs, summary)
+	}
+
+	sort.Slice(convs, func(i, j int) bool {
+		return convs[i].UpdatedAt.After(convs[j].UpdatedAt)
+	})
+	return convs, nil
+}
+
+// Get returns a conversation with its messages
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Conversation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conv, ok := s.conversations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyConversation(conv), nil
+}
+
+// Delete removes a conversation
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conversations[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.conversations, id)
+	return nil
+}
+
+// AppendMessages chains messages below parentID and moves the head to the last one
+func (s *MemoryStore) AppendMessages(ctx context.Context, id, parentID string, msgs ...Message) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if _, ok := conv.Message(parentID); parentID != "" && !ok {
+		return nil, ErrMessageNotFound
+	}
+
+	now := time.Now().UTC()
+	stamped := stampMessages(msgs, parentID, now)
+	conv.Messages = append(conv.Messages, stamped...)
+	conv.MessageCount = len(conv.Messages)
+	conv.UpdatedAt = now
+	if len(stamped) > 0 {
+		conv.HeadID = lastID(stamped)
+	}
+	return stamped, nil
+}
+
+// SetHead switches the active branch
+func (s *MemoryStore) SetHead(ctx context.Context, id, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, ok := conv.Message(messageID); !ok {
+		return ErrMessageNotFound
+	}
+
+	conv.HeadID = messageID
+	conv.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// UpdateSummary stores a generated title and summary
+func (s *MemoryStore) UpdateSummary(ctx context.Context, id, title, summary, throughID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if title != "" {
+		conv.Title = title
+	}
+	conv.Summary = summary
+	conv.SummarizedThrough = throughID
+	return nil
+}
+
+// Import stores complete conversations
+func (s *MemoryStore) Import(ctx context.Context, convs []*Conversation) error {
+	now := time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conv := range convs {
+		conv.ID = newID()
+		conv.CreatedAt = now
+		conv.UpdatedAt = now
+		conv.MessageCount = len(conv.Messages)
+		s.conversations[conv.ID] = copyConversation(conv)
+	}
+	return nil
+}
+
+// Ping always succeeds for the in-memory store
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op for the in-memory store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// copyConversation returns a deep copy so callers cannot mutate stored state
+func copyConversation(conv *Conversation) *Conversation {
+	c := *conv
+	c.Messages = append([]Message(nil), conv.Messages...)
+	return &c
+}
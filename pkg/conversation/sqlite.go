@@ -0,0 +1,370 @@
+package conversation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go driver, works with CGO_ENABLED=0
+)
+
+// migrations are applied in order and tracked with PRAGMA user_version
+var migrations = []string{
+	`CREATE TABLE conversations (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL DEFAULT '',
+		title      TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX idx_conversations_user ON conversations (user_id, updated_at);
+	CREATE TABLE messages (
+		id              TEXT PRIMARY KEY,
+		conversation_id TEXT NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+		seq             INTEGER NOT NULL,
+		role            TEXT NOT NULL,
+		content         TEXT NOT NULL,
+		created_at      INTEGER NOT NULL
+	);
+	CREATE INDEX idx_messages_conversation ON messages (conversation_id, seq);`,
+	// Conversation trees: link each existing message to its predecessor and
+	// point the head at the last message
+	`ALTER TABLE messages ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+	UPDATE messages SET parent_id = COALESCE((
+		SELECT p.id FROM messages p
+		WHERE p.conversation_id = messages.conversation_id AND p.seq = messages.seq - 1
+	), '');
+	ALTER TABLE conversations ADD COLUMN head_id TEXT NOT NULL DEFAULT '';
+	UPDATE conversations SET head_id = COALESCE((
+		SELECT m.id FROM messages m
+		WHERE m.conversation_id = conversations.id ORDER BY m.seq DESC LIMIT 1
+	), '');`,
+	// Background summaries
+	`ALTER TABLE conversations ADD COLUMN summary TEXT NOT NULL DEFAULT '';
+	ALTER TABLE conversations ADD COLUMN summarized_through TEXT NOT NULL DEFAULT '';`,
+}
+
+// SQLiteStore persists conversations in a SQLite database file
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the database at path and applies migrations
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create database directory: %w", err)
+		}
+	}
+
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	// SQLite allows a single writer, so serialize access through one connection
+	db.SetMaxOpenConns(1)
+
+	store := &SQLiteStore{db: db}
+	if err := store.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// migrate applies any migrations newer than the database's user_version
+func (s *SQLiteStore) migrate(ctx context.Context) error {
+	var version int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create stores a new conversation
+func (s *SQLiteStore) Create(ctx context.Context, conv *Conversation) error {
+	now := time.Now().UTC()
+	conv.ID = newID()
+	conv.CreatedAt = now
+	conv.UpdatedAt = now
+	conv.Messages = stampMessages(conv.Messages, "", now)
+	conv.MessageCount = len(conv.Messages)
+	conv.HeadID = lastID(conv.Messages)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO conversations (id, user_id, title, head_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		conv.ID, conv.UserID, conv.Title, conv.HeadID, now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("insert conversation: %w", err)
+	}
+	if err := insertMessages(ctx, tx, conv.ID, 0, conv.Messages); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// List returns the conversations owned by a user
+func (s *SQLiteStore) List(ctx context.Context, userID, query string) ([]Conversation, error) {
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT c.id, c.user_id, c.title, c.head_id, c.summary, c.summarized_through, c.created_at, c.updated_at,
+			(SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id)
+		FROM conversations c
+		WHERE c.user_id = ? AND (? = '' OR c.title LIKE ? ESCAPE '\' OR c.summary LIKE ? ESCAPE '\')
+		ORDER BY c.updated_at DESC`, userID, query, pattern, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	convs := make([]Conversation, 0)
+	for rows.Next() {
+		var conv Conversation
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.HeadID, &conv.Summary, &conv.SummarizedThrough,
+			&createdAt, &updatedAt, &conv.MessageCount); err != nil {
+			return nil, err
+		}
+		conv.CreatedAt = time.UnixMilli(createdAt).UTC()
+		conv.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+		convs = append(convs, conv)
+	}
+	return convs, rows.Err()
+}
+
+// Get returns a conversation with its messages
+func (s *SQLiteStore) Get(ctx context.Context, id string) (*Conversation, error) {
+	var conv Conversation
+	var createdAt, updatedAt int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, title, head_id, summary, summarized_through, created_at, updated_at
+		FROM conversations WHERE id = ?`, id).
+		Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.HeadID, &conv.Summary, &conv.SummarizedThrough, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get conversation: %w", err)
+	}
+	conv.CreatedAt = time.UnixMilli(createdAt).UTC()
+	conv.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, parent_id, role, content, created_at FROM messages WHERE conversation_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return nil, fmt.Errorf("get messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg Message
+		var msgCreatedAt int64
+		if err := rows.Scan(&msg.ID, &msg.ParentID, &msg.Role, &msg.Content, &msgCreatedAt); err != nil {
+			return nil, err
+		}
+		msg.CreatedAt = time.UnixMilli(msgCreatedAt).UTC()
+		conv.Messages = append(conv.Messages, msg)
+	}
+	conv.MessageCount = len(conv.Messages)
+	return &conv, rows.Err()
+}
+
+// Delete removes a conversation and, through the foreign key cascade, its messages
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM conversations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete conversation: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AppendMessages chains messages below parentID and moves the head to the last one
+func (s *SQLiteStore) AppendMessages(ctx context.Context, id, parentID string, msgs ...Message) ([]Message, error) {
+	now := time.Now().UTC()
+	stamped := stampMessages(msgs, parentID, now)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var headID string
+	if err := tx.QueryRowContext(ctx, `SELECT head_id FROM conversations WHERE id = ?`, id).Scan(&headID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get conversation: %w", err)
+	}
+	if parentID != "" {
+		if err := checkMessage(ctx, tx, id, parentID); err != nil {
+			return nil, err
+		}
+	}
+	if len(stamped) > 0 {
+		headID = lastID(stamped)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE conversations SET head_id = ?, updated_at = ? WHERE id = ?`,
+		headID, now.UnixMilli(), id)
+	if err != nil {
+		return nil, fmt.Errorf("update conversation: %w", err)
+	}
+
+	var seq int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(seq), -1) + 1 FROM messages WHERE conversation_id = ?`, id).Scan(&seq); err != nil {
+		return nil, err
+	}
+	if err := insertMessages(ctx, tx, id, seq, stamped); err != nil {
+		return nil, err
+	}
+	return stamped, tx.Commit()
+}
+
+// SetHead switches the active branch
+func (s *SQLiteStore) SetHead(ctx context.Context, id, messageID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkMessage(ctx, tx, id, messageID); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `UPDATE conversations SET head_id = ?, updated_at = ? WHERE id = ?`,
+		messageID, time.Now().UTC().UnixMilli(), id)
+	if err != nil {
+		return fmt.Errorf("update conversation: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// UpdateSummary stores a generated title and summary. It does not bump
+// updated_at, so background work never reorders the listing.
+func (s *SQLiteStore) UpdateSummary(ctx context.Context, id, title, summary, throughID string) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE conversations SET title = CASE WHEN ? = '' THEN title ELSE ? END,
+			summary = ?, summarized_through = ? WHERE id = ?`,
+		title, title, summary, throughID, id)
+	if err != nil {
+		return fmt.Errorf("update summary: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Import stores complete conversations in a single transaction
+func (s *SQLiteStore) Import(ctx context.Context, convs []*Conversation) error {
+	now := time.Now().UTC()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := make([]string, len(convs))
+	for i, conv := range convs {
+		ids[i] = newID()
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO conversations (id, user_id, title, head_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			ids[i], conv.UserID, conv.Title, conv.HeadID, now.UnixMilli(), now.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("insert conversation: %w", err)
+		}
+		if err := insertMessages(ctx, tx, ids[i], 0, conv.Messages); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for i, conv := range convs {
+		conv.ID = ids[i]
+		conv.CreatedAt = now
+		conv.UpdatedAt = now
+		conv.MessageCount = len(conv.Messages)
+	}
+	return nil
+}
+
+// Ping checks that the database answers
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the underlying database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// likeEscaper escapes LIKE wildcards so search terms match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// checkMessage returns ErrMessageNotFound unless messageID belongs to the conversation
+func checkMessage(ctx context.Context, tx *sql.Tx, conversationID, messageID string) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM messages WHERE id = ? AND conversation_id = ?)`,
+		messageID, conversationID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check message: %w", err)
+	}
+	if !exists {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// insertMessages writes messages with consecutive sequence numbers starting at seq
+func insertMessages(ctx context.Context, tx *sql.Tx, conversationID string, seq int, msgs []Message) error {
+	for i, msg := range msgs {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO messages (id, conversation_id, parent_id, seq, role, content, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			msg.ID, conversationID, msg.ParentID, seq+i, msg.Role, msg.Content, msg.CreatedAt.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("insert message: %w", err)
+		}
+	}
+	return nil
+}
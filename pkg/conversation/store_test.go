@@ -0,0 +1,195 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// forEachStore runs a test against every store backend, so they behave alike
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStore())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "conversations.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		test(t, store)
+	})
+}
+
+func TestStoreConversations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		first := &Conversation{UserID: "alice", Title: "Go generics", Messages: []Message{
+			{Role: "user", Content: "What are type parameters?"},
+			{Role: "assistant", Content: "Functions and types over a set of types."},
+		}}
+		if err := store.Create(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+		if first.ID == "" || first.HeadID != first.Messages[1].ID || first.Messages[1].ParentID != first.Messages[0].ID {
+			t.Fatalf("created conversation = %+v, want an ID and a chained branch", first)
+		}
+		second := &Conversation{UserID: "alice", Title: "Kubernetes"}
+		if err := store.Create(ctx, second); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Create(ctx, &Conversation{UserID: "bob", Title: "Go modules"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// SQLite stores times in milliseconds, so make sure the update comes later
+		time.Sleep(2 * time.Millisecond)
+		appended, err := store.AppendMessages(ctx, first.ID, first.HeadID,
+			Message{Role: "user", Content: "And constraints?"},
+			Message{Role: "assistant", Content: "Interfaces listing the allowed types."})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if appended[0].ParentID != first.HeadID || appended[1].ParentID != appended[0].ID {
+			t.Fatalf("appended = %+v, want them chained below the head", appended)
+		}
+
+		convs, err := store.List(ctx, "alice", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(convs) != 2 || convs[0].ID != first.ID || convs[0].MessageCount != 4 || convs[0].Messages != nil {
+			t.Fatalf("List = %+v, want alice's two conversations, the updated one first without messages", convs)
+		}
+		convs, _ = store.List(ctx, "alice", "GO")
+		if len(convs) != 1 || convs[0].ID != first.ID {
+			t.Fatalf("List matching go = %+v, want only alice's Go conversation", convs)
+		}
+		convs, _ = store.List(ctx, "alice", "%")
+		if len(convs) != 0 {
+			t.Fatalf("List matching %% = %+v, want none", convs)
+		}
+
+		got, err := store.Get(ctx, first.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UserID != "alice" || got.HeadID != appended[1].ID || len(got.ActiveBranch()) != 4 {
+			t.Fatalf("Get = %+v, want 4 messages with the last appended as head", got)
+		}
+
+		if err := store.Delete(ctx, first.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Get(ctx, first.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get after Delete: err = %v, want ErrNotFound", err)
+		}
+		if err := store.Delete(ctx, first.ID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("second Delete: err = %v, want ErrNotFound", err)
+		}
+		if _, err := store.AppendMessages(ctx, first.ID, "", Message{Role: "user", Content: "hi"}); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("AppendMessages to a deleted conversation: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestSQLiteStoreReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv := &Conversation{UserID: "alice", Messages: []Message{{Role: "user", Content: "Hello"}}}
+	if err := store.Create(context.Background(), conv); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	got, err := store.Get(context.Background(), conv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Content != "Hello" {
+		t.Fatalf("reopened conversation = %+v", got)
+	}
+}
+
+func TestStoreBranches(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		conv := &Conversation{UserID: "alice", Messages: []Message{
+			{Role: "user", Content: "Name a color"},
+			{Role: "assistant", Content: "Blue"},
+		}}
+		if err := store.Create(ctx, conv); err != nil {
+			t.Fatal(err)
+		}
+		question, original := conv.Messages[0], conv.Messages[1]
+
+		// Regenerating stores a sibling of the original reply and makes it the head
+		regenerated, err := store.AppendMessages(ctx, conv.ID, question.ID, Message{Role: "assistant", Content: "Green"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Editing the question stores a sibling of it, starting another branch from the root
+		edited, err := store.AppendMessages(ctx, conv.ID, "",
+			Message{Role: "user", Content: "Name a fruit"},
+			Message{Role: "assistant", Content: "Apple"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Get(ctx, conv.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Messages) != 5 || got.HeadID != edited[1].ID {
+			t.Fatalf("conversation has %d messages with head %s, want 5 with the edited reply as head", len(got.Messages), got.HeadID)
+		}
+		assertBranch(t, got.ActiveBranch(), "Name a fruit", "Apple")
+		branch, err := got.Branch(regenerated[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertBranch(t, branch, "Name a color", "Green")
+
+		// Switching back to the original reply keeps every branch
+		if err := store.SetHead(ctx, conv.ID, original.ID); err != nil {
+			t.Fatal(err)
+		}
+		got, _ = store.Get(ctx, conv.ID)
+		assertBranch(t, got.ActiveBranch(), "Name a color", "Blue")
+		if len(got.Messages) != 5 {
+			t.Fatalf("SetHead left %d messages, want 5", len(got.Messages))
+		}
+
+		if err := store.SetHead(ctx, conv.ID, "missing"); !errors.Is(err, ErrMessageNotFound) {
+			t.Fatalf("SetHead to a missing message: err = %v, want ErrMessageNotFound", err)
+		}
+		if _, err := store.AppendMessages(ctx, conv.ID, "missing", Message{Role: "user", Content: "hi"}); !errors.Is(err, ErrMessageNotFound) {
+			t.Fatalf("AppendMessages below a missing message: err = %v, want ErrMessageNotFound", err)
+		}
+		if _, err := got.Branch("missing"); !errors.Is(err, ErrMessageNotFound) {
+			t.Fatalf("Branch to a missing message: err = %v, want ErrMessageNotFound", err)
+		}
+	})
+}
+
+func assertBranch(t *testing.T, branch []Message, contents ...string) {
+	t.Helper()
+	if len(branch) != len(contents) {
+		t.Fatalf("branch has %d messages, want %d", len(branch), len(contents))
+	}
+	for i, msg := range branch {
+		if msg.Content != contents[i] {
+			t.Fatalf("branch message %d = %q, want %q", i, msg.Content, contents[i])
+		}
+	}
+}
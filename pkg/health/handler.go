@@ -0,0 +1,102 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// version is reported by /healthz
+var version = "1.0.0" // Should be set during build
+
+// Statuses reported by the endpoints
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded" // Only non-critical checks fail
+	StatusFailing  = "failing"  // A critical check fails
+)
+
+// Report is the body of the health endpoints. Checks are only listed by
+// verbose requests.
+type Report struct {
+	Status    string    `json:"status"`
+	Failing   []string  `json:"failing,omitempty"`
+	Checks    []Result  `json:"checks,omitempty"`
+	Uptime    string    `json:"uptime,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	GoVersion string    `json:"go_version,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Register adds the health routes to the mux:
+//
+//   - /livez: the process is serving requests; no dependency is checked
+//   - /readyz: every critical check passes
+//   - /healthz: every check, with ?verbose listing each result
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /livez", h.handleLive)
+	mux.HandleFunc("GET /readyz", h.handleReady)
+	mux.HandleFunc("GET /healthz", h.handleHealth)
+}
+
+func (h *Health) handleLive(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{
+		Status:    StatusOK,
+		Uptime:    time.Since(h.started).Round(time.Second).String(),
+		Timestamp: time.Now(),
+	})
+}
+
+func (h *Health) handleReady(w http.ResponseWriter, r *http.Request) {
+	report := summarize(h.Run(r.Context(), true), r.URL.Query().Has("verbose"))
+	writeReport(w, statusCode(report), report)
+}
+
+func (h *Health) handleHealth(w http.ResponseWriter, r *http.Request) {
+	report := summarize(h.Run(r.Context(), false), r.URL.Query().Has("verbose"))
+	report.Uptime = time.Since(h.started).Round(time.Second).String()
+	report.Version = version
+	report.GoVersion = runtime.Version()
+	writeReport(w, statusCode(report), report)
+}
+
+// summarize reduces check results to an overall status
+func summarize(results []Result, verbose bool) Report {
+	report := Report{Status: StatusOK, Timestamp: time.Now()}
+	for _, result := range results {
+		if result.Healthy {
+			continue
+		}
+		report.Failing = append(report.Failing, result.Name)
+		if result.Critical {
+			report.Status = StatusFailing
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	if verbose {
+		report.Checks = results
+	}
+	return report
+}
+
+// statusCode is 503 when a critical check fails; a degraded application
+// still serves requests
+func statusCode(report Report) int {
+	if report.Status == StatusFailing {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Error().Err(err).Msg("Failed to encode health report")
+	}
+}
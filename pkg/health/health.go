@@ -1,73 +1,192 @@
+// Package health runs pluggable dependency checks and serves them as
+// liveness, readiness and detailed health endpoints.
 package health
 
 import (
-	"encoding/json"
-	"net/http"
-	"runtime"
+	"context"
+	"fmt"
+	"sync"
 	"time"
 
-	"github.com/ajeetraina/genai-app-demo/pkg/metrics"
-	"github.com/rs/zerolog/log"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-// Status represents the health status of the application
-type Status struct {
-	Status    string            `json:"status"`
-	Uptime    string            `json:"uptime"`
-	Timestamp time.Time         `json:"timestamp"`
-	Version   string            `json:"version"`
-	GoVersion string            `json:"go_version"`
-	MemStats  runtime.MemStats  `json:"mem_stats"`
-	Metrics   map[string]string `json:"metrics,omitempty"`
+// Defaults for checks that leave them unset
+const (
+	DefaultTimeout  = 2 * time.Second
+	DefaultCacheTTL = 5 * time.Second
+)
+
+// Checker checks one dependency, returning nil when it is healthy
+type Checker interface {
+	Check(ctx context.Context) error
 }
 
-// Variables to track application state
-var (
-	startTime = time.Now()
-	version   = "1.0.0" // Should be set during build
-)
+// CheckerFunc adapts a function to a Checker
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Check is a registered checker
+type Check struct {
+	Name     string
+	Checker  Checker
+	Critical bool          // The application is not ready while a critical check fails
+	Timeout  time.Duration // Deadline for one run of the checker
+	CacheTTL time.Duration // A result is reused this long before the checker runs again
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	Duration  float64   `json:"duration_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Options configures the metrics health state is exported as
+type Options struct {
+	Status   *prometheus.GaugeVec     // Labelled by check: 1 healthy, 0 failing
+	Duration *prometheus.HistogramVec // Labelled by check
+}
+
+// Health runs the registered checks
+type Health struct {
+	opts    Options
+	started time.Time
+
+	mu     sync.RWMutex
+	checks []*check
+}
+
+// check is a registered check and its cached result
+type check struct {
+	Check
+
+	mu   sync.Mutex // Held while the checker runs, so concurrent callers share a run
+	last Result
+}
+
+// New creates a health subsystem without checks
+func New(opts Options) *Health {
+	return &Health{opts: opts, started: time.Now()}
+}
 
-// HandleHealth returns a simple health check handler
-func HandleHealth() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Create health status
-		status := &Status{
-			Status:    "ok",
-			Uptime:    time.Since(startTime).String(),
-			Timestamp: time.Now(),
-			Version:   version,
-			GoVersion: runtime.Version(),
-			Metrics:   make(map[string]string),
+// Add registers a check
+func (h *Health) Add(c Check) {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = DefaultCacheTTL
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, &check{Check: c})
+}
+
+// Run returns the result of every check, or only of the critical ones, in
+// registration order. Checks run concurrently; cached results that have not
+// expired are reused.
+func (h *Health) Run(ctx context.Context, criticalOnly bool) []Result {
+	h.mu.RLock()
+	checks := make([]*check, 0, len(h.checks))
+	for _, c := range h.checks {
+		if c.Critical || !criticalOnly {
+			checks = append(checks, c)
 		}
+	}
+	h.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = h.run(ctx, c)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// run returns the cached result of a check, running it when it has expired
+func (h *Health) run(ctx context.Context, c *check) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.last.CheckedAt.IsZero() && time.Since(c.last.CheckedAt) < c.CacheTTL {
+		return c.last
+	}
 
-		// Get memory statistics
-		var memStats runtime.MemStats
-		runtime.ReadMemStats(&memStats)
-		status.MemStats = memStats
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := runChecker(ctx, c.Checker)
+	duration := time.Since(start)
 
-		// Include some basic metrics
-		status.Metrics["active_requests"] = fmt.Sprintf("%v", metrics.ActiveRequests)
+	result := Result{
+		Name:      c.Name,
+		Healthy:   err == nil,
+		Critical:  c.Critical,
+		Duration:  float64(duration.Microseconds()) / 1000,
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	c.last = result
 
-		// Send response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(status); err != nil {
-			log.Error().Err(err).Msg("Failed to encode health status")
+	if h.opts.Status != nil {
+		status := 0.0
+		if result.Healthy {
+			status = 1
 		}
+		h.opts.Status.WithLabelValues(c.Name).Set(status)
 	}
+	if h.opts.Duration != nil {
+		h.opts.Duration.WithLabelValues(c.Name).Observe(duration.Seconds())
+	}
+	return result
 }
 
-// HandleReadiness returns a readiness check handler
-func HandleReadiness() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// You can add more sophisticated checks here, such as:
-		// - Database connectivity
-		// - Model availability
-		// - External service dependencies
-
-		// For now, just return a basic OK response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+// runChecker runs a checker, giving up when the context ends even if the
+// checker ignores it
+func runChecker(ctx context.Context, checker Checker) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		done <- checker.Check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+}
+
+// Watch runs every check at the given interval until the context ends, so
+// the exported metrics stay current without anyone polling the endpoints
+func (h *Health) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.Run(ctx, false)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
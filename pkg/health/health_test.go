@@ -0,0 +1,152 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countingChecker counts its runs and returns err
+type countingChecker struct {
+	runs atomic.Int32
+	err  error
+}
+
+func (c *countingChecker) Check(ctx context.Context) error {
+	c.runs.Add(1)
+	return c.err
+}
+
+func TestRunTimeout(t *testing.T) {
+	h := New(Options{})
+	release := make(chan struct{})
+	defer close(release)
+	// A checker that ignores its context still times out
+	h.Add(Check{Name: "stuck", Timeout: 20 * time.Millisecond, Checker: CheckerFunc(func(ctx context.Context) error {
+		<-release
+		return nil
+	})})
+	h.Add(Check{Name: "panics", Checker: CheckerFunc(func(ctx context.Context) error {
+		panic("boom")
+	})})
+
+	start := time.Now()
+	results := h.Run(context.Background(), false)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Run took %s, want it bounded by the check timeout", elapsed)
+	}
+	if len(results) != 2 || results[0].Name != "stuck" || results[1].Name != "panics" {
+		t.Fatalf("results = %+v, want both checks in registration order", results)
+	}
+	if results[0].Healthy || !strings.Contains(results[0].Error, "timed out") {
+		t.Fatalf("stuck check = %+v, want a timeout", results[0])
+	}
+	if results[1].Healthy || !strings.Contains(results[1].Error, "panicked: boom") {
+		t.Fatalf("panicking check = %+v, want the panic as its error", results[1])
+	}
+}
+
+func TestRunCaching(t *testing.T) {
+	status := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "health_check_status"}, []string{"check"})
+	h := New(Options{Status: status})
+	cached := &countingChecker{}
+	fresh := &countingChecker{err: errors.New("down")}
+	h.Add(Check{Name: "cached", Checker: cached, CacheTTL: time.Hour})
+	h.Add(Check{Name: "fresh", Checker: fresh, CacheTTL: time.Nanosecond})
+
+	first := h.Run(context.Background(), false)
+	time.Sleep(time.Millisecond)
+	second := h.Run(context.Background(), false)
+	if got := cached.runs.Load(); got != 1 {
+		t.Fatalf("cached check ran %d times, want 1", got)
+	}
+	if got := fresh.runs.Load(); got != 2 {
+		t.Fatalf("expired check ran %d times, want 2", got)
+	}
+	if !second[0].CheckedAt.Equal(first[0].CheckedAt) {
+		t.Fatal("cached result was not reused")
+	}
+	if got := testutil.ToFloat64(status.WithLabelValues("cached")); got != 1 {
+		t.Fatalf("cached status = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(status.WithLabelValues("fresh")); got != 0 {
+		t.Fatalf("fresh status = %v, want 0", got)
+	}
+}
+
+func TestRunSharesConcurrentRuns(t *testing.T) {
+	h := New(Options{})
+	var runs atomic.Int32
+	h.Add(Check{Name: "slow", Checker: CheckerFunc(func(ctx context.Context) error {
+		runs.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})})
+
+	done := make(chan struct{})
+	for range 5 {
+		go func() {
+			h.Run(context.Background(), false)
+			done <- struct{}{}
+		}()
+	}
+	for range 5 {
+		<-done
+	}
+	if got := runs.Load(); got != 1 {
+		t.Fatalf("concurrent callers ran the check %d times, want 1", got)
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	readiness := NewReadiness()
+	cache := &countingChecker{err: errors.New("unreachable")}
+	h := New(Options{})
+	h.Add(Check{Name: "model", Checker: readiness, Critical: true, CacheTTL: time.Nanosecond})
+	h.Add(Check{Name: "cache", Checker: cache, CacheTTL: time.Nanosecond})
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	get := func(path string) (int, Report) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var report Report
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, report
+	}
+
+	if code, report := get("/livez"); code != http.StatusOK || report.Status != StatusOK {
+		t.Fatalf("/livez = %d %+v, want ok while starting", code, report)
+	}
+	readiness.SetPhase("warming up")
+	readiness.SetFailed(errors.New("model not loaded"))
+	code, report := get("/readyz?verbose")
+	if code != http.StatusServiceUnavailable || report.Status != StatusFailing || len(report.Checks) != 1 {
+		t.Fatalf("/readyz while starting = %d %+v, want failing with only the critical check", code, report)
+	}
+	if report.Checks[0].Error != "warming up: model not loaded" {
+		t.Fatalf("model check error = %q", report.Checks[0].Error)
+	}
+
+	readiness.SetReady()
+	time.Sleep(time.Millisecond)
+	if code, report := get("/readyz"); code != http.StatusOK || report.Status != StatusOK || report.Checks != nil {
+		t.Fatalf("/readyz when ready = %d %+v, want ok without checks", code, report)
+	}
+	code, report = get("/healthz")
+	if code != http.StatusOK || report.Status != StatusDegraded || len(report.Failing) != 1 || report.Failing[0] != "cache" {
+		t.Fatalf("/healthz = %d %+v, want degraded by the cache", code, report)
+	}
+}
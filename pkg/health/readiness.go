@@ -0,0 +1,68 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Readiness tracks a startup step, such as warming up the model, that must
+// finish before the application is ready. It starts out not ready, in the
+// "starting" phase, and is a Checker.
+type Readiness struct {
+	mu    sync.RWMutex
+	ready bool
+	phase string
+	err   error
+	since time.Time
+}
+
+// NewReadiness creates a readiness tracker that is not ready yet
+func NewReadiness() *Readiness {
+	return &Readiness{phase: "starting", since: time.Now()}
+}
+
+// SetPhase records the startup step in progress
+func (r *Readiness) SetPhase(phase string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.phase, r.err, r.since = phase, nil, time.Now()
+}
+
+// SetReady marks the application ready
+func (r *Readiness) SetReady() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ready, r.phase, r.err, r.since = true, "ready", nil, time.Now()
+}
+
+// SetFailed records why the application is not ready. It stays in the
+// current phase so a retry can still succeed.
+func (r *Readiness) SetFailed(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ready, r.err = false, err
+}
+
+// Ready reports whether the application is ready
+func (r *Readiness) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ready
+}
+
+// Check fails with the current phase and error until the tracker is ready
+func (r *Readiness) Check(ctx context.Context) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	switch {
+	case r.ready:
+		return nil
+	case r.err != nil:
+		return fmt.Errorf("%s: %w", r.phase, r.err)
+	default:
+		return errors.New(r.phase + " for " + time.Since(r.since).Round(time.Millisecond).String())
+	}
+}
@@ -0,0 +1,20 @@
+package identity
+
+import "net/http"
+
+// UserHeader carries the caller's user ID. The app sits behind a trusted
+// gateway that authenticates users and sets this header.
+const UserHeader = "X-User-ID"
+
+// TenantHeader carries the caller's tenant, set by the same gateway
+const TenantHeader = "X-Tenant-ID"
+
+// UserID returns the user ID of the request, or "" for anonymous callers
+func UserID(r *http.Request) string {
+	return r.Header.Get(UserHeader)
+}
+
+// TenantID returns the tenant of the request, or "" when none is set
+func TenantID(r *http.Request) string {
+	return r.Header.Get(TenantHeader)
+}
@@ -0,0 +1,168 @@
+package ingest
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Chunking strategies
+const (
+	StrategyTokens   = "tokens"   // Fixed-size windows with overlap
+	StrategyHeadings = "headings" // One chunk per Markdown section, split further when too long
+)
+
+// ChunkOptions controls how extracted text is split before embedding. Sizes
+// are measured in tokens, approximated as whitespace-separated words since the
+// backend tokenizer is not available to the app.
+type ChunkOptions struct {
+	Strategy string `json:"strategy"`
+	Size     int    `json:"chunk_size"`
+	Overlap  int    `json:"chunk_overlap"`
+}
+
+// DefaultChunkOptions are used when an upload does not specify chunking
+var DefaultChunkOptions = ChunkOptions{Strategy: StrategyTokens, Size: 256, Overlap: 32}
+
+// Validate fills in defaults and checks the options are usable
+func (o *ChunkOptions) Validate() error {
+	if o.Strategy == "" {
+		o.Strategy = DefaultChunkOptions.Strategy
+	}
+	if o.Size == 0 {
+		o.Size = DefaultChunkOptions.Size
+		if o.Overlap == 0 {
+			o.Overlap = DefaultChunkOptions.Overlap
+		}
+	}
+	switch {
+	case o.Strategy != StrategyTokens && o.Strategy != StrategyHeadings:
+		return errors.New("strategy must be tokens or headings")
+	case o.Size < 16 || o.Size > 8192:
+		return errors.New("chunk_size must be between 16 and 8192")
+	case o.Overlap < 0 || o.Overlap >= o.Size:
+		return errors.New("chunk_overlap must be at least 0 and smaller than chunk_size")
+	}
+	return nil
+}
+
+// Chunk is a piece of a document. Start and End are byte offsets into the
+// extracted document text.
+type Chunk struct {
+	Index   int    `json:"index"`
+	Text    string `json:"text"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Heading string `json:"heading,omitempty"` // Nearest Markdown heading, with the headings strategy
+}
+
+// Split divides text into chunks using the given options
+func Split(text string, opts ChunkOptions) []Chunk {
+	var chunks []Chunk
+	if opts.Strategy == StrategyHeadings {
+		for _, s := range sections(text) {
+			chunks = append(chunks, splitTokens(text, s.start, s.end, s.heading, opts)...)
+		}
+	} else {
+		chunks = splitTokens(text, 0, len(text), "", opts)
+	}
+
+	for i := range chunks {
+		chunks[i].Index = i
+	}
+	return chunks
+}
+
+// span is a byte range within the document text
+type span struct {
+	start, end int
+}
+
+// splitTokens cuts text[start:end] into windows of opts.Size tokens, each
+// sharing opts.Overlap tokens with the previous one
+func splitTokens(text string, start, end int, heading string, opts ChunkOptions) []Chunk {
+	words := wordSpans(text, start, end)
+	if len(words) == 0 {
+		return nil
+	}
+
+	var chunks []Chunk
+	step := opts.Size - opts.Overlap
+	for i := 0; i < len(words); i += step {
+		j := min(i+opts.Size, len(words))
+		from, to := words[i].start, words[j-1].end
+		chunks = append(chunks, Chunk{Text: text[from:to], Start: from, End: to, Heading: heading})
+		if j == len(words) {
+			break
+		}
+	}
+	return chunks
+}
+
+// wordSpans returns the byte ranges of the whitespace-separated words in text[start:end]
+func wordSpans(text string, start, end int) []span {
+	var words []span
+	inWord := false
+	wordStart := 0
+	for i, r := range text[start:end] {
+		switch {
+		case unicode.IsSpace(r) && inWord:
+			words = append(words, span{start + wordStart, start + i})
+			inWord = false
+		case !unicode.IsSpace(r) && !inWord:
+			wordStart = i
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, span{start + wordStart, end})
+	}
+	return words
+}
+
+// section is a run of text under a single Markdown heading
+type section struct {
+	span
+	heading string
+}
+
+// sections splits Markdown text at ATX headings, ignoring lines inside fenced
+// code blocks. Text before the first heading forms its own section.
+func sections(text string) []section {
+	var result []section
+	current := section{}
+	inFence := false
+
+	for offset := 0; offset < len(text); {
+		lineEnd := strings.IndexByte(text[offset:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += offset
+		}
+		line := strings.TrimSpace(text[offset:lineEnd])
+
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			inFence = !inFence
+		} else if !inFence && isHeading(line) {
+			if offset > current.start {
+				current.end = offset
+				result = append(result, current)
+			}
+			current = section{span: span{start: offset}, heading: strings.TrimSpace(strings.TrimLeft(line, "#"))}
+		}
+		offset = lineEnd + 1
+	}
+
+	current.end = len(text)
+	if current.end > current.start {
+		result = append(result, current)
+	}
+	return result
+}
+
+// isHeading reports whether a trimmed line is a Markdown ATX heading
+func isHeading(line string) bool {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	return level >= 1 && level <= 6 && (len(line) == level || line[level] == ' ')
+}
@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Embedder turns texts into embedding vectors
+type Embedder interface {
+	Embed(ctx context.Context, model string, texts []string) ([][]float32, error)
+}
+
+// OpenAIEmbedder calls an OpenAI-compatible /v1/embeddings endpoint, such as
+// the one exposed by Docker Model Runner
+type OpenAIEmbedder struct {
+	client    func() *openai.Client
+	batchSize int
+	duration  *prometheus.HistogramVec // Labelled by model
+}
+
+// NewOpenAIEmbedder creates an embedder that sends at most batchSize texts per
+// request. client is called on every Embed, so the server can be switched at
+// runtime.
+func NewOpenAIEmbedder(client func() *openai.Client, batchSize int, duration *prometheus.HistogramVec) *OpenAIEmbedder {
+	if batchSize <= 0 {
+		batchSize = 32
+	}
+	return &OpenAIEmbedder{client: client, batchSize: batchSize, duration: duration}
+}
+
+// Embed returns one vector per text, in order
+func (e *OpenAIEmbedder) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	client := e.client()
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += e.batchSize {
+		batch := texts[start:min(start+e.batchSize, len(texts))]
+
+		began := time.Now()
+		resp, err := client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+			Input: openai.F[openai.EmbeddingNewParamsInputUnion](openai.EmbeddingNewParamsInputArrayOfStrings(batch)),
+			Model: openai.F(openai.EmbeddingModel(model)),
+		})
+		if e.duration != nil {
+			e.duration.WithLabelValues(model).Observe(time.Since(began).Seconds())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("embed batch at %d: %w", start, err)
+		}
+		if len(resp.Data) != len(batch) {
+			return nil, fmt.Errorf("embed batch at %d: expected %d embeddings, got %d", start, len(batch), len(resp.Data))
+		}
+
+		// The API may return embeddings out of order; Index refers to the input
+		batchVectors := make([][]float32, len(batch))
+		for _, item := range resp.Data {
+			if item.Index < 0 || int(item.Index) >= len(batch) {
+				return nil, fmt.Errorf("embed batch at %d: embedding index %d out of range", start, item.Index)
+			}
+			vector := make([]float32, len(item.Embedding))
+			for i, v := range item.Embedding {
+				vector[i] = float32(v)
+			}
+			batchVectors[item.Index] = vector
+		}
+		vectors = append(vectors, batchVectors...)
+	}
+	return vectors, nil
+}
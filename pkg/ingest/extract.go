@@ -0,0 +1,189 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/net/html"
+)
+
+// Supported document formats
+const (
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+	FormatHTML     = "html"
+	FormatPDF      = "pdf"
+)
+
+// ErrUnsupportedFormat is returned for files that cannot be extracted
+var ErrUnsupportedFormat = errors.New("unsupported document format")
+
+// DetectFormat picks a document format from the file extension, falling back
+// to the declared content type
+func DetectFormat(filename, contentType string) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".md", ".markdown":
+		return FormatMarkdown, nil
+	case ".txt", ".text":
+		return FormatText, nil
+	case ".html", ".htm":
+		return FormatHTML, nil
+	case ".pdf":
+		return FormatPDF, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/markdown", "text/x-markdown":
+		return FormatMarkdown, nil
+	case "text/plain":
+		return FormatText, nil
+	case "text/html", "application/xhtml+xml":
+		return FormatHTML, nil
+	case "application/pdf":
+		return FormatPDF, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Extract converts a document into plain text. HTML headings are rendered as
+// Markdown headings so heading-based chunking works for both formats.
+func Extract(format string, data []byte) (string, error) {
+	switch format {
+	case FormatMarkdown, FormatText:
+		if !utf8.Valid(data) {
+			return "", errors.New("document is not valid UTF-8 text")
+		}
+		return normalizeText(string(data)), nil
+	case FormatHTML:
+		return extractHTML(data)
+	case FormatPDF:
+		return extractPDF(data)
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// blockElements start a new line when rendered as text
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "section": true,
+	"article": true, "header": true, "footer": true, "blockquote": true, "pre": true,
+	"table": true, "ul": true, "ol": true, "hr": true,
+}
+
+// headingLevels maps heading elements to Markdown heading prefixes
+var headingLevels = map[string]string{
+	"h1": "# ", "h2": "## ", "h3": "### ", "h4": "#### ", "h5": "##### ", "h6": "###### ",
+}
+
+func extractHTML(data []byte) (string, error) {
+	var b strings.Builder
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	skipDepth := 0
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); !errors.Is(err, io.EOF) {
+				return "", fmt.Errorf("parse HTML: %w", err)
+			}
+			// Text tokens leave stray spaces at line starts; HTML indentation is not meaningful
+			lines := strings.Split(b.String(), "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimSpace(line)
+			}
+			return normalizeText(strings.Join(lines, "\n")), nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			switch {
+			case tag == "script" || tag == "style" || tag == "noscript" || tag == "head":
+				skipDepth++
+			case headingLevels[tag] != "":
+				b.WriteString("\n\n" + headingLevels[tag])
+			case blockElements[tag]:
+				b.WriteString("\n")
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			switch {
+			case tag == "script" || tag == "style" || tag == "noscript" || tag == "head":
+				if skipDepth > 0 {
+					skipDepth--
+				}
+			case headingLevels[tag] != "" || blockElements[tag]:
+				b.WriteString("\n")
+			}
+		case html.TextToken:
+			if skipDepth == 0 {
+				b.WriteString(strings.Join(strings.Fields(string(tokenizer.Text())), " "))
+				b.WriteString(" ")
+			}
+		}
+	}
+}
+
+// extractPDF extracts the text of every page. The PDF library panics on some
+// malformed files, which is reported as an error like any other bad upload.
+func extractPDF(data []byte) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("read PDF: malformed file: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("open PDF: %w", err)
+	}
+
+	var b strings.Builder
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return "", fmt.Errorf("read PDF page %d: %w", i, err)
+		}
+		b.WriteString(text)
+		b.WriteString("\n\n")
+	}
+	return normalizeText(b.String()), nil
+}
+
+// normalizeText unifies line endings, trims trailing spaces and collapses runs
+// of blank lines into a single paragraph break
+func normalizeText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+
+	var b strings.Builder
+	blank := 0
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if strings.TrimSpace(line) == "" {
+			blank++
+			continue
+		}
+		if b.Len() > 0 {
+			if blank > 0 {
+				b.WriteString("\n\n")
+			} else {
+				b.WriteString("\n")
+			}
+		}
+		blank = 0
+		b.WriteString(line)
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// minimalPDF builds a one-page PDF showing text. With misplaced set, the
+// cross-reference entry of the page tree points at the page object instead.
+func minimalPDF(text string, misplaced bool) []byte {
+	content := fmt.Sprintf("BT /F1 12 Tf (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	if misplaced {
+		offsets[1] = offsets[2]
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestExtractPDF(t *testing.T) {
+	text, err := Extract(FormatPDF, minimalPDF("Hello PDF", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "Hello PDF") {
+		t.Fatalf("extracted %q, want the page text", text)
+	}
+}
+
+func TestExtractMalformedPDF(t *testing.T) {
+	// The PDF library panics on a cross-reference entry pointing at the wrong object
+	if _, err := Extract(FormatPDF, minimalPDF("Hello PDF", true)); err == nil {
+		t.Fatal("expected an error for a malformed PDF")
+	}
+}
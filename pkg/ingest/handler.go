@@ -0,0 +1,252 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Handler serves the collection and document REST API
+type Handler struct {
+	ingester       *Ingester
+	embeddingModel string // Default for new collections
+	maxUploadBytes int64
+}
+
+// NewHandler creates a handler. Collections created without an explicit
+// embedding model use embeddingModel.
+func NewHandler(ingester *Ingester, embeddingModel string, maxUploadBytes int64) *Handler {
+	if maxUploadBytes <= 0 {
+		maxUploadBytes = 20 << 20
+	}
+	return &Handler{ingester: ingester, embeddingModel: embeddingModel, maxUploadBytes: maxUploadBytes}
+}
+
+// Register adds the collection routes to the mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /collections", h.handleCreateCollection)
+	mux.HandleFunc("GET /collections", h.handleListCollections)
+	mux.HandleFunc("GET /collections/{name}", h.handleGetCollection)
+	mux.HandleFunc("DELETE /collections/{name}", h.handleDeleteCollection)
+	mux.HandleFunc("POST /collections/{name}/documents", h.handleUpload)
+	mux.HandleFunc("GET /collections/{name}/documents", h.handleListDocuments)
+	mux.HandleFunc("GET /collections/{name}/documents/{id}", h.handleGetDocument)
+	mux.HandleFunc("DELETE /collections/{name}/documents/{id}", h.handleDeleteDocument)
+	mux.HandleFunc("POST /collections/{name}/documents/{id}/reindex", h.handleReindex)
+}
+
+// createCollectionRequest is the body accepted when creating a collection
+type createCollectionRequest struct {
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	EmbeddingModel string `json:"embedding_model"`
+}
+
+func (h *Handler) handleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	var req createCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.EmbeddingModel == "" {
+		req.EmbeddingModel = h.embeddingModel
+	}
+
+	coll, err := h.ingester.Store().CreateCollection(Collection{
+		Name:           req.Name,
+		Description:    req.Description,
+		EmbeddingModel: req.EmbeddingModel,
+	})
+	switch {
+	case errors.Is(err, ErrInvalidName):
+		http.Error(w, "Invalid collection name: "+err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrCollectionExists):
+		http.Error(w, "Collection already exists", http.StatusConflict)
+		return
+	case err != nil:
+		log.Error().Err(err).Str("collection", req.Name).Msg("Failed to create collection")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, coll)
+}
+
+func (h *Handler) handleListCollections(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"collections": h.ingester.Store().ListCollections()})
+}
+
+func (h *Handler) handleGetCollection(w http.ResponseWriter, r *http.Request) {
+	coll, err := h.ingester.Store().GetCollection(r.PathValue("name"))
+	if err != nil {
+		h.writeError(w, err, "Failed to load collection")
+		return
+	}
+	writeJSON(w, http.StatusOK, coll)
+}
+
+func (h *Handler) handleDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	if err := h.ingester.Store().DeleteCollection(r.PathValue("name")); err != nil {
+		h.writeError(w, err, "Failed to delete collection")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUpload ingests a multipart upload. The file goes in the "file" field;
+// optional fields are "metadata" (a JSON object of strings), "strategy",
+// "chunk_size" and "chunk_overlap".
+func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadBytes)
+	if err := r.ParseMultipartForm(h.maxUploadBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Upload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Expected a multipart form with a file field", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Expected a multipart form with a file field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read upload", http.StatusBadRequest)
+		return
+	}
+
+	upload := Upload{
+		Filename:    header.Filename,
+		ContentType: header.Header.Get("Content-Type"),
+		Data:        data,
+		Chunking:    ChunkOptions{Strategy: r.FormValue("strategy")},
+	}
+	if raw := r.FormValue("metadata"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &upload.Metadata); err != nil {
+			http.Error(w, "Metadata must be a JSON object of strings", http.StatusBadRequest)
+			return
+		}
+	}
+	if upload.Chunking.Size, err = formInt(r, "chunk_size"); err != nil {
+		http.Error(w, "chunk_size must be an integer", http.StatusBadRequest)
+		return
+	}
+	if upload.Chunking.Overlap, err = formInt(r, "chunk_overlap"); err != nil {
+		http.Error(w, "chunk_overlap must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := h.ingester.Ingest(r.Context(), r.PathValue("name"), upload)
+	if err != nil {
+		h.writeError(w, err, "Failed to ingest document")
+		return
+	}
+	writeJSON(w, http.StatusCreated, doc)
+}
+
+func (h *Handler) handleListDocuments(w http.ResponseWriter, r *http.Request) {
+	docs, err := h.ingester.Store().ListDocuments(r.PathValue("name"))
+	if err != nil {
+		h.writeError(w, err, "Failed to list documents")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"documents": docs})
+}
+
+// handleGetDocument returns a document. With ?chunks=true the response also
+// contains its chunks, without embeddings.
+func (h *Handler) handleGetDocument(w http.ResponseWriter, r *http.Request) {
+	doc, chunks, err := h.ingester.Store().GetDocument(r.PathValue("name"), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err, "Failed to load document")
+		return
+	}
+
+	if r.URL.Query().Get("chunks") != "true" {
+		writeJSON(w, http.StatusOK, doc)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Document
+		Chunks []EmbeddedChunk `json:"chunks"`
+	}{doc, chunks})
+}
+
+func (h *Handler) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	if err := h.ingester.Delete(r.PathValue("name"), r.PathValue("id")); err != nil {
+		h.writeError(w, err, "Failed to delete document")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleReindex re-embeds a document. An optional JSON body with strategy,
+// chunk_size and chunk_overlap changes how it is chunked.
+func (h *Handler) handleReindex(w http.ResponseWriter, r *http.Request) {
+	chunking := &ChunkOptions{}
+	switch err := json.NewDecoder(r.Body).Decode(chunking); {
+	case errors.Is(err, io.EOF):
+		chunking = nil // Keep the document's current chunking
+	case err != nil:
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := h.ingester.Reindex(r.Context(), r.PathValue("name"), r.PathValue("id"), chunking)
+	if err != nil {
+		h.writeError(w, err, "Failed to reindex document")
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// writeError maps pipeline errors to HTTP responses
+func (h *Handler) writeError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, ErrCollectionNotFound):
+		http.Error(w, "Collection not found", http.StatusNotFound)
+	case errors.Is(err, ErrDocumentNotFound):
+		http.Error(w, "Document not found", http.StatusNotFound)
+	case errors.Is(err, ErrUnsupportedFormat):
+		http.Error(w, "Unsupported document format, expected Markdown, text, HTML or PDF", http.StatusUnsupportedMediaType)
+	case errors.Is(err, ErrEmptyDocument), errors.Is(err, ErrInvalidDocument):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrDimensionMismatch):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrEmbedding):
+		log.Error().Err(err).Msg(msg)
+		http.Error(w, "Embedding backend error", http.StatusBadGateway)
+	default:
+		log.Error().Err(err).Msg(msg)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// formInt parses an optional integer form field
+func formInt(r *http.Request, key string) (int, error) {
+	value := r.FormValue(key)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("Failed to encode response")
+	}
+}
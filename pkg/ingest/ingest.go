@@ -0,0 +1,178 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrEmptyDocument is returned when no text could be extracted from an upload
+	ErrEmptyDocument = errors.New("document contains no text")
+	// ErrInvalidDocument wraps extraction and chunking option errors caused by the upload
+	ErrInvalidDocument = errors.New("invalid document")
+	// ErrEmbedding wraps failures of the embeddings backend
+	ErrEmbedding = errors.New("embedding failed")
+)
+
+// Options configures the ingestion pipeline
+type Options struct {
+	DocumentsCounter *prometheus.CounterVec // Labelled by format and result
+	ChunksCounter    prometheus.Counter
+}
+
+// Ingester extracts, chunks and embeds documents into collections
+type Ingester struct {
+	store    *Store
+	embedder Embedder
+	opts     Options
+}
+
+// NewIngester creates an ingestion pipeline
+func NewIngester(store *Store, embedder Embedder, opts Options) *Ingester {
+	return &Ingester{store: store, embedder: embedder, opts: opts}
+}
+
+// Store returns the store the pipeline writes to
+func (in *Ingester) Store() *Store {
+	return in.store
+}
+
+// Upload is a file submitted for ingestion
+type Upload struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+	Metadata    map[string]string
+	Chunking    ChunkOptions
+}
+
+// Ingest adds an uploaded file to a collection
+func (in *Ingester) Ingest(ctx context.Context, collection string, upload Upload) (Document, error) {
+	format, err := DetectFormat(upload.Filename, upload.ContentType)
+	if err != nil {
+		in.record("unknown", "unsupported")
+		return Document{}, err
+	}
+
+	doc, err := in.ingest(ctx, collection, format, upload)
+	if err != nil {
+		in.record(format, "error")
+		return Document{}, err
+	}
+	in.record(format, "success")
+	log.Info().
+		Str("collection", collection).
+		Str("document_id", doc.ID).
+		Str("format", format).
+		Int("chunks", doc.ChunkCount).
+		Msg("Ingested document")
+	return doc, nil
+}
+
+func (in *Ingester) ingest(ctx context.Context, collection, format string, upload Upload) (Document, error) {
+	if err := upload.Chunking.Validate(); err != nil {
+		return Document{}, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	coll, err := in.store.GetCollection(collection)
+	if err != nil {
+		return Document{}, err
+	}
+
+	text, err := Extract(format, upload.Data)
+	if err != nil {
+		return Document{}, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	if text == "" {
+		return Document{}, ErrEmptyDocument
+	}
+
+	chunks, err := in.embed(ctx, coll.EmbeddingModel, text, upload.Chunking)
+	if err != nil {
+		return Document{}, err
+	}
+
+	return in.store.PutDocument(Document{
+		Collection: collection,
+		Filename:   upload.Filename,
+		Format:     format,
+		Metadata:   upload.Metadata,
+		Chunking:   upload.Chunking,
+		Size:       len(upload.Data),
+		Text:       text,
+	}, chunks)
+}
+
+// Reindex re-chunks and re-embeds a stored document, optionally with new
+// chunking options. The previous chunks stay in place if anything fails.
+func (in *Ingester) Reindex(ctx context.Context, collection, id string, chunking *ChunkOptions) (Document, error) {
+	coll, err := in.store.GetCollection(collection)
+	if err != nil {
+		return Document{}, err
+	}
+	doc, _, err := in.store.GetDocument(collection, id)
+	if err != nil {
+		return Document{}, err
+	}
+
+	if chunking != nil {
+		if err := chunking.Validate(); err != nil {
+			return Document{}, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+		}
+		doc.Chunking = *chunking
+	}
+
+	chunks, err := in.embed(ctx, coll.EmbeddingModel, doc.Text, doc.Chunking)
+	if err != nil {
+		in.record(doc.Format, "error")
+		return Document{}, err
+	}
+	updated, err := in.store.PutDocument(doc, chunks)
+	if err != nil {
+		in.record(doc.Format, "error")
+		return Document{}, err
+	}
+	in.record(doc.Format, "reindexed")
+	return updated, nil
+}
+
+// Delete removes a document and its chunks from a collection
+func (in *Ingester) Delete(collection, id string) error {
+	return in.store.DeleteDocument(collection, id)
+}
+
+// embed splits text and embeds every chunk
+func (in *Ingester) embed(ctx context.Context, model, text string, opts ChunkOptions) ([]EmbeddedChunk, error) {
+	chunks := Split(text, opts)
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+
+	vectors, err := in.embedder.Embed(ctx, model, texts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEmbedding, err)
+	}
+	if len(vectors) != len(chunks) {
+		return nil, fmt.Errorf("%w: expected %d vectors, got %d", ErrEmbedding, len(chunks), len(vectors))
+	}
+
+	embedded := make([]EmbeddedChunk, len(chunks))
+	for i, chunk := range chunks {
+		embedded[i] = EmbeddedChunk{Chunk: chunk, Embedding: vectors[i]}
+	}
+	if in.opts.ChunksCounter != nil {
+		in.opts.ChunksCounter.Add(float64(len(chunks)))
+	}
+	return embedded, nil
+}
+
+// record counts a processed document by format and result
+func (in *Ingester) record(format, result string) {
+	if in.opts.DocumentsCounter != nil {
+		in.opts.DocumentsCounter.WithLabelValues(format, result).Inc()
+	}
+}
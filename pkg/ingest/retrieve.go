@@ -0,0 +1,106 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RetrieverOptions configures retrieval metrics
+type RetrieverOptions struct {
+	Latency *prometheus.HistogramVec // Labelled by collection
+	Hits    *prometheus.CounterVec   // Labelled by collection
+}
+
+// Retriever finds the chunks most relevant to a query across collections
+type Retriever struct {
+	store    *Store
+	embedder Embedder
+	opts     RetrieverOptions
+}
+
+// NewRetriever creates a retriever over the store's collections
+func NewRetriever(store *Store, embedder Embedder, opts RetrieverOptions) *Retriever {
+	return &Retriever{store: store, embedder: embedder, opts: opts}
+}
+
+// Retrieve embeds the query once per embedding model and runs a hybrid search
+// in each collection, returning the k best hits overall. Unknown collections
+// fail with ErrCollectionNotFound before anything is embedded.
+func (r *Retriever) Retrieve(ctx context.Context, collections []string, query string, k int) ([]Hit, error) {
+	ctx, span := tracing.StartSpan(ctx, "retrieval")
+	defer span.End()
+	span.SetAttributes(
+		attribute.StringSlice("retrieval.collections", collections),
+		attribute.Int("retrieval.top_k", k),
+	)
+
+	models := make(map[string]string, len(collections))
+	for _, name := range collections {
+		coll, err := r.store.GetCollection(name)
+		if err != nil {
+			tracing.RecordError(ctx, err, "Unknown collection")
+			return nil, fmt.Errorf("%w: %s", err, name)
+		}
+		models[name] = coll.EmbeddingModel
+	}
+
+	vectors := make(map[string][]float32)
+	var hits []Hit
+	for _, name := range collections {
+		start := time.Now()
+		vector, ok := vectors[models[name]]
+		if !ok {
+			embedded, err := r.embedder.Embed(ctx, models[name], []string{query})
+			if err != nil || len(embedded) != 1 {
+				if err == nil {
+					err = fmt.Errorf("expected 1 vector, got %d", len(embedded))
+				}
+				tracing.RecordError(ctx, err, "Query embedding failed")
+				return nil, fmt.Errorf("%w: %v", ErrEmbedding, err)
+			}
+			vector = embedded[0]
+			vectors[models[name]] = vector
+		}
+
+		found, err := r.search(ctx, name, vector, query, k)
+		if err != nil {
+			return nil, err
+		}
+		if r.opts.Latency != nil {
+			r.opts.Latency.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		}
+		if r.opts.Hits != nil {
+			r.opts.Hits.WithLabelValues(name).Add(float64(len(found)))
+		}
+		hits = append(hits, found...)
+	}
+
+	// Fused scores share a scale, so hits from different collections can be merged directly
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	span.SetAttributes(attribute.Int("retrieval.hits", len(hits)))
+	return hits, nil
+}
+
+// search queries one collection inside its own span
+func (r *Retriever) search(ctx context.Context, collection string, vector []float32, query string, k int) ([]Hit, error) {
+	ctx, span := tracing.StartChildSpan(ctx, "retrieval.search")
+	defer span.End()
+	span.SetAttributes(attribute.String("retrieval.collection", collection))
+
+	hits, err := r.store.Search(collection, vector, query, k, nil)
+	if err != nil {
+		tracing.RecordError(ctx, err, "Collection search failed")
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("retrieval.hits", len(hits)))
+	return hits, nil
+}
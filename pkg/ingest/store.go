@@ -0,0 +1,796 @@
+package ingest
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/vectorindex"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrCollectionNotFound is returned when a collection does not exist
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrCollectionExists is returned when creating a collection whose name is taken
+	ErrCollectionExists = errors.New("collection already exists")
+	// ErrDocumentNotFound is returned when a document does not exist in its collection
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrInvalidName is returned for collection names that are not safe file names
+	ErrInvalidName = errors.New("collection names may only contain letters, digits, '-' and '_' (at most 64)")
+	// ErrDimensionMismatch is returned when embeddings do not match the collection's dimensions
+	ErrDimensionMismatch = errors.New("embedding dimensions do not match the collection")
+)
+
+var collectionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Collection groups documents embedded with the same model
+type Collection struct {
+	Name           string    `json:"name"`
+	Description    string    `json:"description,omitempty"`
+	EmbeddingModel string    `json:"embedding_model"`
+	Dimensions     int       `json:"dimensions"` // Set by the first embedded chunk
+	DocumentCount  int       `json:"document_count"`
+	ChunkCount     int       `json:"chunk_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Document is an uploaded file. The extracted text is kept so the document
+// can be re-chunked and re-embedded without uploading it again.
+type Document struct {
+	ID         string            `json:"id"`
+	Collection string            `json:"collection"`
+	Filename   string            `json:"filename"`
+	Format     string            `json:"format"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Chunking   ChunkOptions      `json:"chunking"`
+	Size       int               `json:"size"` // Bytes uploaded
+	ChunkCount int               `json:"chunk_count"`
+	Text       string            `json:"-"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// EmbeddedChunk is a chunk stored with its embedding vector
+type EmbeddedChunk struct {
+	Chunk
+	DocumentID string    `json:"document_id"`
+	Embedding  []float32 `json:"-"`
+}
+
+// Hit is a chunk returned by a search, with its source document
+type Hit struct {
+	Collection string            `json:"collection"`
+	DocumentID string            `json:"document_id"`
+	Filename   string            `json:"filename"`
+	ChunkIndex int               `json:"chunk_index"`
+	Start      int               `json:"start"`
+	End        int               `json:"end"`
+	Heading    string            `json:"heading,omitempty"`
+	Text       string            `json:"text"`
+	Score      float32           `json:"score"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// collectionData is everything stored for one collection. On disk the
+// collection file holds only the Collection, each document is written to its
+// own file with its chunks and embeddings, and the vector index is saved
+// without the vectors, which it takes from the documents when loaded.
+// Collection files written before documents had their own files hold the
+// Documents and Chunks too, and are migrated on load.
+//
+// mu guards the documents, chunks and index, and is held for the whole of a
+// change, so indexing and writing a large document only holds up its own
+// collection. Collection and removed are changed holding Store.mu as well,
+// taken after mu, so either lock is enough to read them.
+type collectionData struct {
+	Collection Collection
+	Documents  map[string]*Document
+	Chunks     map[string][]EmbeddedChunk // By document ID
+
+	mu      sync.RWMutex
+	index   *vectorindex.Index
+	version int  // Bumped by every change to the index
+	removed bool // Set when the collection is deleted
+
+	saveMu       sync.Mutex // Serializes index saves
+	savedVersion int        // Version of the last saved index; guarded by saveMu
+}
+
+// collectionFile is the persisted form of a collection
+type collectionFile struct {
+	Collection Collection
+}
+
+// documentFile is the persisted form of a document
+type documentFile struct {
+	Document Document
+	Chunks   []EmbeddedChunk
+}
+
+// Store keeps collections in memory. When created with a directory, every
+// change is written there document by document and loaded again on startup.
+// Every collection has a vector index over its chunks for hybrid search,
+// saved in the background after changes.
+type Store struct {
+	dir string
+
+	mu          sync.RWMutex // Guards collections; see collectionData for the rest
+	collections map[string]*collectionData
+}
+
+// NewStore creates a store persisted under dir, or an in-memory store when dir is empty
+func NewStore(dir string) (*Store, error) {
+	s := &Store{dir: dir, collections: make(map[string]*collectionData)}
+	if dir == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create collection directory: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.gob"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := s.readCollection(file)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", filepath.Base(file), err)
+		}
+		if err := s.loadIndex(data); err != nil {
+			return nil, fmt.Errorf("load index of %s: %w", data.Collection.Name, err)
+		}
+		s.collections[data.Collection.Name] = data
+	}
+	return s, nil
+}
+
+// Ping checks that the collection directory is writable and that every
+// vector index holds all the chunks of its collection
+func (s *Store) Ping(ctx context.Context) error {
+	if s.dir != "" {
+		probe, err := os.CreateTemp(s.dir, ".ping.*.tmp")
+		if err != nil {
+			return fmt.Errorf("collection directory is not writable: %w", err)
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+	}
+
+	s.mu.RLock()
+	collections := make([]*collectionData, 0, len(s.collections))
+	for _, data := range s.collections {
+		collections = append(collections, data)
+	}
+	s.mu.RUnlock()
+	for _, data := range collections {
+		data.mu.RLock()
+		n, chunks := data.index.Len(), data.Collection.ChunkCount
+		data.mu.RUnlock()
+		if n != chunks {
+			return fmt.Errorf("vector index of collection %q has %d of %d chunks", data.Collection.Name, n, chunks)
+		}
+	}
+	return ctx.Err()
+}
+
+// CreateCollection adds an empty collection
+func (s *Store) CreateCollection(c Collection) (Collection, error) {
+	if !collectionNamePattern.MatchString(c.Name) {
+		return Collection{}, ErrInvalidName
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.collections[c.Name]; ok {
+		return Collection{}, ErrCollectionExists
+	}
+	now := time.Now().UTC()
+	c.CreatedAt, c.UpdatedAt = now, now
+	c.Dimensions, c.DocumentCount, c.ChunkCount = 0, 0, 0
+
+	data := &collectionData{
+		Collection: c,
+		Documents:  make(map[string]*Document),
+		Chunks:     make(map[string][]EmbeddedChunk),
+		index:      newIndex(),
+	}
+	if s.dir != "" {
+		// Clear anything left behind by a deleted collection of the same name
+		if err := s.removeFiles(c.Name); err != nil {
+			return Collection{}, err
+		}
+		if err := writeGob(s.path(c.Name), collectionFile{Collection: c}); err != nil {
+			return Collection{}, fmt.Errorf("write collection %q: %w", c.Name, err)
+		}
+	}
+	s.collections[c.Name] = data
+	return c, nil
+}
+
+// ListCollections returns all collections sorted by name
+func (s *Store) ListCollections() []Collection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	collections := make([]Collection, 0, len(s.collections))
+	for _, data := range s.collections {
+		collections = append(collections, data.Collection)
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Name < collections[j].Name })
+	return collections
+}
+
+// GetCollection returns a collection by name
+func (s *Store) GetCollection(name string) (Collection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.collections[name]
+	if !ok {
+		return Collection{}, ErrCollectionNotFound
+	}
+	return data.Collection, nil
+}
+
+// collection returns the data of a collection by name
+func (s *Store) collection(name string) (*collectionData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.collections[name]
+	if !ok {
+		return nil, ErrCollectionNotFound
+	}
+	return data, nil
+}
+
+// DeleteCollection removes a collection with all of its documents
+func (s *Store) DeleteCollection(name string) error {
+	data, err := s.collection(name)
+	if err != nil {
+		return err
+	}
+	// Changes in progress finish first, so none writes a file after the
+	// collection's files are removed
+	data.mu.Lock()
+	defer data.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if data.removed {
+		return ErrCollectionNotFound
+	}
+	if s.dir != "" {
+		// The collection file goes first: without it nothing else is loaded
+		if err := os.Remove(s.path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := s.removeFiles(name); err != nil {
+			log.Warn().Err(err).Str("collection", name).Msg("Failed to remove the files of a deleted collection")
+		}
+	}
+	data.removed = true
+	delete(s.collections, name)
+	return nil
+}
+
+// ListDocuments returns the documents of a collection, oldest first
+func (s *Store) ListDocuments(collection string) ([]Document, error) {
+	data, err := s.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	data.mu.RLock()
+	defer data.mu.RUnlock()
+
+	docs := make([]Document, 0, len(data.Documents))
+	for _, doc := range data.Documents {
+		docs = append(docs, *doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].CreatedAt.Before(docs[j].CreatedAt) })
+	return docs, nil
+}
+
+// GetDocument returns a document and its chunks
+func (s *Store) GetDocument(collection, id string) (Document, []EmbeddedChunk, error) {
+	data, err := s.collection(collection)
+	if err != nil {
+		return Document{}, nil, err
+	}
+	data.mu.RLock()
+	defer data.mu.RUnlock()
+
+	doc, ok := data.Documents[id]
+	if !ok {
+		return Document{}, nil, ErrDocumentNotFound
+	}
+	return *doc, append([]EmbeddedChunk(nil), data.Chunks[id]...), nil
+}
+
+// PutDocument stores a document and replaces any chunks it had before. New
+// documents get an ID assigned. The first stored chunk fixes the embedding
+// dimensions of the collection; later chunks must match them. If anything
+// fails, the document keeps its previous chunks.
+func (s *Store) PutDocument(doc Document, chunks []EmbeddedChunk) (Document, error) {
+	data, doc, err := s.putDocument(doc, chunks)
+	if err != nil {
+		return Document{}, err
+	}
+	s.saveIndex(data)
+	return doc, nil
+}
+
+func (s *Store) putDocument(doc Document, chunks []EmbeddedChunk) (*collectionData, Document, error) {
+	data, err := s.collection(doc.Collection)
+	if err != nil {
+		return nil, Document{}, err
+	}
+	data.mu.Lock()
+	defer data.mu.Unlock()
+	if data.removed {
+		return nil, Document{}, ErrCollectionNotFound
+	}
+
+	dimensions := data.Collection.Dimensions
+	if len(data.Chunks) == 0 || (len(data.Chunks) == 1 && data.Chunks[doc.ID] != nil) {
+		dimensions = 0 // Only this document's vectors are stored, so they may be replaced freely
+	}
+	for _, chunk := range chunks {
+		if dimensions == 0 {
+			dimensions = len(chunk.Embedding)
+		}
+		if len(chunk.Embedding) != dimensions {
+			return nil, Document{}, fmt.Errorf("%w: got %d, collection %q uses %d", ErrDimensionMismatch, len(chunk.Embedding), doc.Collection, dimensions)
+		}
+	}
+
+	now := time.Now().UTC()
+	previous, previousChunks := (*Document)(nil), data.Chunks[doc.ID]
+	if doc.ID == "" {
+		doc.ID = uuid.New().String()
+		doc.CreatedAt = now
+	} else if existing, ok := data.Documents[doc.ID]; ok {
+		previous = existing
+		doc.CreatedAt = existing.CreatedAt
+	} else {
+		return nil, Document{}, ErrDocumentNotFound
+	}
+	doc.UpdatedAt = now
+	doc.ChunkCount = len(chunks)
+	for i := range chunks {
+		chunks[i].DocumentID = doc.ID
+	}
+
+	// Index the new chunks before anything else changes. A change of
+	// dimensions starts a new index, which only replaces the current one
+	// once the document is stored.
+	index := data.index
+	if index.Dimensions() != 0 && index.Dimensions() != dimensions {
+		index = newIndex()
+	}
+	if err := index.Add(indexItems(&doc, chunks)...); err != nil {
+		return nil, Document{}, err
+	}
+	stale := staleChunkIDs(doc.ID, previousChunks, chunks)
+	index.Delete(stale...)
+
+	stored := doc
+	if err := s.writeDocument(&stored, chunks); err != nil {
+		// Put the previous chunks back in the live index
+		if index == data.index {
+			index.Delete(chunkIDs(doc.ID, chunks)...)
+			if previous != nil {
+				index.Add(indexItems(previous, previousChunks)...)
+			}
+		}
+		return nil, Document{}, fmt.Errorf("write document %s: %w", doc.ID, err)
+	}
+
+	data.index = index
+	data.Documents[doc.ID] = &stored
+	if len(chunks) > 0 {
+		data.Chunks[doc.ID] = chunks
+	} else {
+		delete(data.Chunks, doc.ID)
+	}
+	data.compact()
+	data.version++
+
+	s.mu.Lock()
+	data.Collection.Dimensions = dimensions
+	data.Collection.UpdatedAt = now
+	data.refreshCounts()
+	s.mu.Unlock()
+	return data, doc, nil
+}
+
+// DeleteDocument removes a document and its chunks
+func (s *Store) DeleteDocument(collection, id string) error {
+	data, err := s.deleteDocument(collection, id)
+	if err != nil {
+		return err
+	}
+	s.saveIndex(data)
+	return nil
+}
+
+func (s *Store) deleteDocument(collection, id string) (*collectionData, error) {
+	data, err := s.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	data.mu.Lock()
+	defer data.mu.Unlock()
+	if data.removed {
+		return nil, ErrCollectionNotFound
+	}
+	if _, ok := data.Documents[id]; !ok {
+		return nil, ErrDocumentNotFound
+	}
+	if s.dir != "" {
+		if err := os.Remove(s.documentPath(collection, id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	data.index.Delete(chunkIDs(id, data.Chunks[id])...)
+	delete(data.Documents, id)
+	delete(data.Chunks, id)
+	if len(data.Chunks) == 0 {
+		data.index = newIndex()
+	}
+	data.compact()
+	data.version++
+
+	s.mu.Lock()
+	if len(data.Chunks) == 0 {
+		data.Collection.Dimensions = 0
+	}
+	data.Collection.UpdatedAt = time.Now().UTC()
+	data.refreshCounts()
+	s.mu.Unlock()
+	return data, nil
+}
+
+// Chunks returns every embedded chunk of a collection
+func (s *Store) Chunks(collection string) ([]EmbeddedChunk, error) {
+	data, err := s.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	data.mu.RLock()
+	defer data.mu.RUnlock()
+
+	var chunks []EmbeddedChunk
+	for _, docChunks := range data.Chunks {
+		chunks = append(chunks, docChunks...)
+	}
+	return chunks, nil
+}
+
+// Search returns the k chunks of a collection that best match a query, fusing
+// vector similarity with BM25 keyword scores. The filter matches document
+// metadata, plus the document_id and filename keys.
+func (s *Store) Search(collection string, vector []float32, query string, k int, filter vectorindex.Filter) ([]Hit, error) {
+	data, err := s.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	data.mu.RLock()
+	defer data.mu.RUnlock()
+
+	results, err := data.index.HybridSearch(vector, query, k, filter, vectorindex.HybridOptions{})
+	if errors.Is(err, vectorindex.ErrDimensionMismatch) {
+		return nil, fmt.Errorf("%w: %v", ErrDimensionMismatch, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(results))
+	for _, r := range results {
+		docID, index, ok := parseChunkID(r.ID)
+		if !ok || index >= len(data.Chunks[docID]) {
+			continue
+		}
+		doc, chunk := data.Documents[docID], data.Chunks[docID][index]
+		hits = append(hits, Hit{
+			Collection: collection,
+			DocumentID: docID,
+			Filename:   doc.Filename,
+			ChunkIndex: chunk.Index,
+			Start:      chunk.Start,
+			End:        chunk.End,
+			Heading:    chunk.Heading,
+			Text:       chunk.Text,
+			Score:      r.Score,
+			Metadata:   doc.Metadata,
+		})
+	}
+	return hits, nil
+}
+
+// newIndex creates an empty vector index for a collection
+func newIndex() *vectorindex.Index {
+	idx, _ := vectorindex.New(0, vectorindex.DefaultOptions)
+	return idx
+}
+
+// chunkID identifies a chunk in the vector index
+func chunkID(documentID string, index int) string {
+	return documentID + "/" + strconv.Itoa(index)
+}
+
+func parseChunkID(id string) (string, int, bool) {
+	documentID, index, found := strings.Cut(id, "/")
+	if !found {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(index)
+	return documentID, n, err == nil
+}
+
+// chunkIDs returns the index IDs of a document's chunks
+func chunkIDs(documentID string, chunks []EmbeddedChunk) []string {
+	ids := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		ids[i] = chunkID(documentID, chunk.Index)
+	}
+	return ids
+}
+
+// staleChunkIDs returns the index IDs of a document's previous chunks that
+// its new chunks do not replace
+func staleChunkIDs(documentID string, previous, chunks []EmbeddedChunk) []string {
+	replaced := make(map[int]bool, len(chunks))
+	for _, chunk := range chunks {
+		replaced[chunk.Index] = true
+	}
+	var ids []string
+	for _, chunk := range previous {
+		if !replaced[chunk.Index] {
+			ids = append(ids, chunkID(documentID, chunk.Index))
+		}
+	}
+	return ids
+}
+
+// indexItems converts a document's chunks into vector index items. Document
+// metadata is copied onto every item so searches can filter on it.
+func indexItems(doc *Document, chunks []EmbeddedChunk) []vectorindex.Item {
+	metadata := map[string]string{"document_id": doc.ID, "filename": doc.Filename}
+	for key, value := range doc.Metadata {
+		if _, reserved := metadata[key]; !reserved {
+			metadata[key] = value
+		}
+	}
+
+	items := make([]vectorindex.Item, len(chunks))
+	for i, chunk := range chunks {
+		items[i] = vectorindex.Item{
+			ID:       chunkID(doc.ID, chunk.Index),
+			Vector:   chunk.Embedding,
+			Text:     chunk.Text,
+			Metadata: metadata,
+		}
+	}
+	return items
+}
+
+// loadIndex reads the saved vector index of a collection, taking the vectors
+// from the chunks, and rebuilds it when it is missing or out of date
+func (s *Store) loadIndex(data *collectionData) error {
+	vectors := make(map[string][]float32, data.Collection.ChunkCount)
+	for documentID, chunks := range data.Chunks {
+		for _, chunk := range chunks {
+			vectors[chunkID(documentID, chunk.Index)] = chunk.Embedding
+		}
+	}
+	idx, err := vectorindex.LoadGraphFile(s.indexPath(data.Collection.Name), func(id string) ([]float32, bool) {
+		vector, ok := vectors[id]
+		return vector, ok
+	})
+	if err == nil && idx.Len() == data.Collection.ChunkCount {
+		data.index = idx
+		data.compact()
+		return nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Err(err).Str("collection", data.Collection.Name).Msg("Rebuilding unreadable vector index")
+	}
+
+	data.index = newIndex()
+	for _, doc := range data.Documents {
+		if err := data.index.Add(indexItems(doc, data.Chunks[doc.ID])...); err != nil {
+			return err
+		}
+	}
+	return data.index.SaveGraphFile(s.indexPath(data.Collection.Name))
+}
+
+// saveIndex writes the vector index of a collection after a change. It runs
+// without the collection's lock, so searches need not wait for a large index.
+// Saves of a collection are serialized, and a save is skipped when an
+// earlier one already included the change. A failed save is rebuilt from
+// the documents on the next start.
+func (s *Store) saveIndex(data *collectionData) {
+	if s.dir == "" {
+		return
+	}
+	data.saveMu.Lock()
+	defer data.saveMu.Unlock()
+
+	data.mu.RLock()
+	index, version, removed := data.index, data.version, data.removed
+	data.mu.RUnlock()
+	if removed || version == data.savedVersion {
+		return
+	}
+	if err := index.SaveGraphFile(s.indexPath(data.Collection.Name)); err != nil {
+		log.Warn().Err(err).Str("collection", data.Collection.Name).Msg("Failed to save vector index")
+		return
+	}
+	data.savedVersion = version
+}
+
+// compact rebuilds the vector index once deleted chunks outnumber the live
+// ones, since the index keeps them as tombstones; callers hold d.mu
+func (d *collectionData) compact() {
+	if d.index.Tombstones() > d.index.Len() {
+		d.index = d.index.Compact()
+	}
+}
+
+// refreshCounts recomputes the document and chunk totals of a collection;
+// callers hold d.mu and Store.mu
+func (d *collectionData) refreshCounts() {
+	d.Collection.DocumentCount = len(d.Documents)
+	d.Collection.ChunkCount = 0
+	for _, chunks := range d.Chunks {
+		d.Collection.ChunkCount += len(chunks)
+	}
+}
+
+// writeDocument writes a document and its chunks to the document's file;
+// callers hold the collection's lock
+func (s *Store) writeDocument(doc *Document, chunks []EmbeddedChunk) error {
+	if s.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(s.documentDir(doc.Collection), 0o755); err != nil {
+		return err
+	}
+	return writeGob(s.documentPath(doc.Collection, doc.ID), documentFile{Document: *doc, Chunks: chunks})
+}
+
+// removeFiles removes the documents and index of a collection
+func (s *Store) removeFiles(name string) error {
+	if err := os.RemoveAll(s.documentDir(name)); err != nil {
+		return err
+	}
+	if err := os.Remove(s.indexPath(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path returns the file a collection is persisted to
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".gob")
+}
+
+// documentDir returns the directory the documents of a collection are persisted to
+func (s *Store) documentDir(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// documentPath returns the file a document is persisted to
+func (s *Store) documentPath(collection, id string) string {
+	return filepath.Join(s.documentDir(collection), id+".gob")
+}
+
+// indexPath returns the file the vector index of a collection is persisted to
+func (s *Store) indexPath(name string) string {
+	return filepath.Join(s.dir, name+".index")
+}
+
+// readCollection loads a collection file and its documents, migrating
+// collection files that still hold the documents
+func (s *Store) readCollection(path string) (*collectionData, error) {
+	var data collectionData
+	if err := readGob(path, &data); err != nil {
+		return nil, err
+	}
+	name := data.Collection.Name
+	legacy := len(data.Documents) > 0
+	if data.Documents == nil {
+		data.Documents = make(map[string]*Document)
+	}
+	if data.Chunks == nil {
+		data.Chunks = make(map[string][]EmbeddedChunk)
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.documentDir(name), "*.gob"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		var f documentFile
+		if err := readGob(file, &f); err != nil {
+			return nil, fmt.Errorf("load document %s: %w", filepath.Base(file), err)
+		}
+		doc := f.Document
+		data.Documents[doc.ID] = &doc
+		if len(f.Chunks) > 0 {
+			data.Chunks[doc.ID] = f.Chunks
+		}
+	}
+
+	if legacy {
+		for id, doc := range data.Documents {
+			if err := s.writeDocument(doc, data.Chunks[id]); err != nil {
+				return nil, fmt.Errorf("migrate document %s: %w", id, err)
+			}
+		}
+		if err := writeGob(path, collectionFile{Collection: data.Collection}); err != nil {
+			return nil, fmt.Errorf("migrate collection: %w", err)
+		}
+		log.Info().Str("collection", name).Int("documents", len(data.Documents)).Msg("Migrated collection to one file per document")
+	}
+
+	// Totals are derived from the documents rather than stored
+	data.refreshCounts()
+	data.Collection.Dimensions = 0
+	for _, chunks := range data.Chunks {
+		data.Collection.Dimensions = len(chunks[0].Embedding)
+		break
+	}
+	for _, doc := range data.Documents {
+		if doc.UpdatedAt.After(data.Collection.UpdatedAt) {
+			data.Collection.UpdatedAt = doc.UpdatedAt
+		}
+	}
+	return &data, nil
+}
+
+// writeGob encodes v to path atomically, through a temporary file in the
+// same directory, so a crash never leaves a truncated file
+func writeGob(path string, v interface{}) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readGob(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewDecoder(f).Decode(v)
+}
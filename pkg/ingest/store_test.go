@@ -0,0 +1,186 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// embedded returns chunks with one-hot vectors, so each chunk is its own nearest neighbour
+func embedded(texts ...string) []EmbeddedChunk {
+	chunks := make([]EmbeddedChunk, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, 8)
+		vector[i%8] = 1
+		chunks[i] = EmbeddedChunk{Chunk: Chunk{Index: i, Text: text}, Embedding: vector}
+	}
+	return chunks
+}
+
+func newTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStorePersistsPerDocument(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+	if _, err := store.CreateCollection(Collection{Name: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := store.PutDocument(Document{Collection: "docs", Filename: "a.md", Text: "alpha"}, embedded("alpha one", "alpha two", "alpha three"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := store.PutDocument(Document{Collection: "docs", Filename: "b.md", Text: "beta"}, embedded("beta one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reindexing with fewer chunks drops the old ones from the index
+	if _, err := store.PutDocument(Document{ID: a.ID, Collection: "docs", Filename: "a.md", Text: "alpha"}, embedded("alpha again")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteDocument("docs", b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs", b.ID+".gob")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("deleted document file still exists: %v", err)
+	}
+
+	reloaded := newTestStore(t, dir)
+	coll, err := reloaded.GetCollection("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coll.DocumentCount != 1 || coll.ChunkCount != 1 || coll.Dimensions != 8 {
+		t.Fatalf("reloaded collection = %+v, want 1 document with 1 chunk of 8 dimensions", coll)
+	}
+	if err := reloaded.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	hits, err := reloaded.Search("docs", embedded("x")[0].Embedding, "alpha", 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Text != "alpha again" {
+		t.Fatalf("hits = %+v, want only the reindexed chunk", hits)
+	}
+}
+
+func TestStoreKeepsPreviousChunksOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+	store.CreateCollection(Collection{Name: "docs"})
+	doc, _ := store.PutDocument(Document{Collection: "docs", Filename: "a.md"}, embedded("one", "two"))
+	store.PutDocument(Document{Collection: "docs", Filename: "b.md"}, embedded("three"))
+
+	// Make the document file unwritable by putting a directory in its place
+	path := filepath.Join(dir, "docs", doc.ID+".gob")
+	os.Remove(path)
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.PutDocument(Document{ID: doc.ID, Collection: "docs", Filename: "a.md"}, embedded("replacement")); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+
+	_, chunks, err := store.GetDocument("docs", doc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 || chunks[0].Text != "one" {
+		t.Fatalf("chunks after a failed put = %+v, want the previous ones", chunks)
+	}
+	hits, _ := store.Search("docs", embedded("x")[0].Embedding, "", 10, nil)
+	if len(hits) != 3 {
+		t.Fatalf("index has %d chunks after a failed put, want 3", len(hits))
+	}
+	for _, hit := range hits {
+		if hit.Text == "replacement" {
+			t.Fatal("failed put left its chunk in the index")
+		}
+	}
+
+	// A mismatched embedding is rejected before anything changes
+	bad := embedded("wide")
+	bad[0].Embedding = make([]float32, 4)
+	if _, err := store.PutDocument(Document{ID: doc.ID, Collection: "docs"}, bad); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("err = %v, want ErrDimensionMismatch", err)
+	}
+}
+
+func TestStoreCompactsIndex(t *testing.T) {
+	store := newTestStore(t, "")
+	store.CreateCollection(Collection{Name: "docs"})
+	doc, _ := store.PutDocument(Document{Collection: "docs"}, embedded("one", "two", "three"))
+	for i := 0; i < 10; i++ {
+		if _, err := store.PutDocument(Document{ID: doc.ID, Collection: "docs"}, embedded("one", "two", "three")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data := store.collections["docs"]
+	if tombstones := data.index.Tombstones(); tombstones > data.index.Len() {
+		t.Fatalf("index keeps %d tombstones for %d live chunks", tombstones, data.index.Len())
+	}
+}
+
+func TestStoreChangesOnlyHoldUpTheirCollection(t *testing.T) {
+	store := newTestStore(t, t.TempDir())
+	store.CreateCollection(Collection{Name: "busy"})
+	store.CreateCollection(Collection{Name: "docs"})
+	store.PutDocument(Document{Collection: "docs"}, embedded("one"))
+
+	// Hold the busy collection as a long upload would
+	busy := store.collections["busy"]
+	busy.mu.Lock()
+	done := make(chan error)
+	go func() {
+		if _, err := store.Search("docs", embedded("x")[0].Embedding, "one", 5, nil); err != nil {
+			done <- err
+			return
+		}
+		if _, err := store.PutDocument(Document{Collection: "docs"}, embedded("two")); err != nil {
+			done <- err
+			return
+		}
+		if len(store.ListCollections()) != 2 {
+			done <- errors.New("collections missing from the list")
+			return
+		}
+		_, err := store.GetCollection("busy")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a change to one collection held up the others")
+	}
+
+	// Deleting the busy collection waits for the change to finish
+	deleted := make(chan error)
+	go func() { deleted <- store.DeleteCollection("busy") }()
+	select {
+	case <-deleted:
+		t.Fatal("collection deleted during a change")
+	case <-time.After(20 * time.Millisecond):
+	}
+	busy.mu.Unlock()
+	if err := <-deleted; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.PutDocument(Document{Collection: "busy"}, embedded("late")); !errors.Is(err, ErrCollectionNotFound) {
+		t.Fatalf("put into a deleted collection: err = %v, want ErrCollectionNotFound", err)
+	}
+}
@@ -0,0 +1,294 @@
+package jsonschema
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrUnsupported is returned by Grammar for schemas it cannot express
+var ErrUnsupported = errors.New("unsupported schema")
+
+// primitives are the shared GBNF rules, following llama.cpp's own JSON
+// grammar, with the rules each one refers to
+var primitives = map[string]struct {
+	body string
+	deps []string
+}{
+	"space":   {`| " " | "\n" [ \t]{0,20}`, nil},
+	"char":    {`[^"\\\x7F\x00-\x1F] | [\\] (["\\/bfnrt] | "u" [0-9a-fA-F]{4})`, nil},
+	"string":  {`"\"" char* "\"" space`, []string{"char", "space"}},
+	"number":  {`("-"? ([0-9] | [1-9] [0-9]{0,15})) ("." [0-9]+)? ([eE] [-+]? [0-9]{1,15})? space`, []string{"space"}},
+	"integer": {`("-"? ([0-9] | [1-9] [0-9]{0,15})) space`, []string{"space"}},
+	"boolean": {`("true" | "false") space`, []string{"space"}},
+	"null":    {`"null" space`, []string{"space"}},
+	"value":   {`object | array | string | number | boolean | null`, []string{"object", "array", "string", "number", "boolean", "null"}},
+	"object":  {`"{" space ( string ":" space value ("," space string ":" space value)* )? "}" space`, []string{"string", "value", "space"}},
+	"array":   {`"[" space ( value ("," space value)* )? "]" space`, []string{"value", "space"}},
+}
+
+// Grammar converts a schema to a llama.cpp GBNF grammar that only accepts
+// matching JSON. Objects are generated with their declared properties only,
+// required ones first; numeric bounds are not expressible and are left to
+// validation. A nil schema accepts any JSON object.
+func Grammar(schema Schema) (string, error) {
+	g := &grammar{rules: make(map[string]string)}
+	if schema == nil {
+		schema = Schema{"type": "object"}
+	}
+	root, err := g.visit(schema, "root")
+	if err != nil {
+		return "", err
+	}
+	if root != "root" {
+		g.add("root", root)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "root ::= %s\n", g.rules["root"])
+	for _, name := range g.order {
+		if name != "root" {
+			fmt.Fprintf(&b, "%s ::= %s\n", name, g.rules[name])
+		}
+	}
+	return b.String(), nil
+}
+
+type grammar struct {
+	rules map[string]string
+	order []string
+}
+
+// add defines a rule and returns its name, renaming it if the name is taken
+// by a different rule
+func (g *grammar) add(name, body string) string {
+	name = invalidRuleChars.ReplaceAllString(name, "-")
+	unique := name
+	for i := 1; ; i++ {
+		existing, taken := g.rules[unique]
+		if !taken {
+			break
+		}
+		if existing == body {
+			return unique
+		}
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	g.rules[unique] = body
+	g.order = append(g.order, unique)
+	return unique
+}
+
+var invalidRuleChars = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+// primitive adds a shared rule and the rules it depends on
+func (g *grammar) primitive(name string) string {
+	if _, ok := g.rules[name]; ok {
+		return name
+	}
+	p := primitives[name]
+	g.rules[name] = p.body
+	g.order = append(g.order, name)
+	for _, dep := range p.deps {
+		g.primitive(dep)
+	}
+	return name
+}
+
+// visit returns a rule name or inline expression matching the schema
+func (g *grammar) visit(schema Schema, name string) (string, error) {
+	if _, ok := schema["$ref"]; ok {
+		return "", fmt.Errorf("%w: $ref at %s", ErrUnsupported, name)
+	}
+
+	if want, ok := schema["const"]; ok {
+		return literal(marshal(want)) + " " + g.primitive("space"), nil
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		options := make([]string, len(enum))
+		for i, want := range enum {
+			options[i] = literal(marshal(want))
+		}
+		return g.add(name, "("+strings.Join(options, " | ")+") "+g.primitive("space")), nil
+	}
+
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		if subs, ok := schema[keyword].([]interface{}); ok {
+			options := make([]string, 0, len(subs))
+			for i, sub := range subs {
+				subSchema, ok := sub.(map[string]interface{})
+				if !ok {
+					return "", fmt.Errorf("%w: %s at %s", ErrUnsupported, keyword, name)
+				}
+				option, err := g.visit(subSchema, fmt.Sprintf("%s-%d", name, i))
+				if err != nil {
+					return "", err
+				}
+				options = append(options, option)
+			}
+			return g.add(name, strings.Join(options, " | ")), nil
+		}
+	}
+
+	types := schemaTypes(schema["type"])
+	if len(types) > 1 {
+		options := make([]string, len(types))
+		for i, t := range types {
+			single := make(Schema, len(schema))
+			for k, v := range schema {
+				single[k] = v
+			}
+			single["type"] = t
+			option, err := g.visit(single, name+"-"+t)
+			if err != nil {
+				return "", err
+			}
+			options[i] = option
+		}
+		return g.add(name, strings.Join(options, " | ")), nil
+	}
+
+	t := ""
+	if len(types) == 1 {
+		t = types[0]
+	} else if _, ok := schema["properties"]; ok {
+		t = "object"
+	}
+
+	switch t {
+	case "object":
+		return g.object(schema, name)
+	case "array":
+		return g.array(schema, name)
+	case "string":
+		min, hasMin := number(schema["minLength"])
+		max, hasMax := number(schema["maxLength"])
+		if !hasMin && !hasMax {
+			return g.primitive("string"), nil
+		}
+		return g.add(name, `"\"" `+g.primitive("char")+repeat(min, max, hasMax)+` "\"" `+g.primitive("space")), nil
+	case "number", "integer", "boolean", "null":
+		return g.primitive(t), nil
+	case "":
+		return g.primitive("value"), nil
+	}
+	return "", fmt.Errorf("%w: type %q at %s", ErrUnsupported, t, name)
+}
+
+// object emits the declared properties, required ones first in the order
+// listed, then the optional ones sorted by name
+func (g *grammar) object(schema Schema, name string) (string, error) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	if len(properties) == 0 {
+		return g.primitive("object"), nil
+	}
+
+	isRequired := make(map[string]bool)
+	var keys []string
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if key, ok := r.(string); ok && properties[key] != nil && !isRequired[key] {
+				isRequired[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	var optional []string
+	for key := range properties {
+		if !isRequired[key] {
+			optional = append(optional, key)
+		}
+	}
+	sort.Strings(optional)
+
+	pairs := make(map[string]string, len(properties))
+	for key, sub := range properties {
+		subSchema, ok := sub.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("%w: property %q at %s", ErrUnsupported, key, name)
+		}
+		value, err := g.visit(subSchema, name+"-"+key)
+		if err != nil {
+			return "", err
+		}
+		pairs[key] = g.add(name+"-"+key+"-kv", literal(marshal(key))+` space ":" space `+value)
+	}
+	g.primitive("space")
+
+	var body strings.Builder
+	body.WriteString(`"{" space `)
+	for i, key := range keys {
+		if i > 0 {
+			body.WriteString(`"," space `)
+		}
+		body.WriteString(pairs[key] + " ")
+	}
+	if len(keys) > 0 {
+		for _, key := range optional {
+			body.WriteString(`( "," space ` + pairs[key] + ` )? `)
+		}
+	} else if len(optional) > 0 {
+		// With nothing required, any optional property may come first; the
+		// ones after it keep their order
+		alternatives := make([]string, len(optional))
+		for i, key := range optional {
+			alternative := pairs[key]
+			for _, rest := range optional[i+1:] {
+				alternative += ` ( "," space ` + pairs[rest] + ` )?`
+			}
+			alternatives[i] = alternative
+		}
+		body.WriteString("( " + strings.Join(alternatives, " | ") + " )? ")
+	}
+	body.WriteString(`"}" space`)
+	return g.add(name, body.String()), nil
+}
+
+func (g *grammar) array(schema Schema, name string) (string, error) {
+	item := g.primitive("value")
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		var err error
+		if item, err = g.visit(items, name+"-item"); err != nil {
+			return "", err
+		}
+	}
+	g.primitive("space")
+
+	min, _ := number(schema["minItems"])
+	max, hasMax := number(schema["maxItems"])
+	if hasMax && max == 0 {
+		return g.add(name, `"[" space "]" space`), nil
+	}
+
+	// The first item, then the rest separated by commas
+	restMin := min - 1
+	if restMin < 0 {
+		restMin = 0
+	}
+	list := item + ` ( "," space ` + item + ` )` + repeat(restMin, max-1, hasMax)
+	if min == 0 {
+		list = "( " + list + " )?"
+	}
+	return g.add(name, `"[" space `+list+` "]" space`), nil
+}
+
+// repeat renders a GBNF repetition of min to max items, unbounded without max
+func repeat(min, max float64, hasMax bool) string {
+	switch {
+	case !hasMax && min == 0:
+		return "*"
+	case !hasMax && min == 1:
+		return "+"
+	case !hasMax:
+		return fmt.Sprintf("{%d,}", int(min))
+	}
+	return fmt.Sprintf("{%d,%d}", int(min), int(max))
+}
+
+// literal quotes text as a GBNF string literal
+func literal(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(text) + `"`
+}
@@ -0,0 +1,113 @@
+package jsonschema
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGrammar(t *testing.T) {
+	grammar, err := Grammar(weatherSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := parseRules(t, grammar)
+
+	// Required properties come first, then the optional ones sorted by name
+	want := map[string]string{
+		"root":         `"{" space root-city-kv ( "," space root-days-kv )? ( "," space root-tags-kv )? ( "," space root-units-kv )? "}" space`,
+		"root-city":    `"\"" char+ "\"" space`,
+		"root-city-kv": `"\"city\"" space ":" space root-city`,
+		"root-days-kv": `"\"days\"" space ":" space integer`,
+		"root-units":   `("\"metric\"" | "\"imperial\"") space`,
+		"root-tags":    `"[" space ( string ( "," space string ){0,1} )? "]" space`,
+	}
+	for name, body := range want {
+		if rules[name] != body {
+			t.Errorf("%s ::= %s\nwant %s ::= %s", name, rules[name], name, body)
+		}
+	}
+	if !strings.HasPrefix(grammar, "root ::= ") {
+		t.Errorf("grammar does not start with the root rule:\n%s", grammar)
+	}
+	assertRulesDefined(t, rules)
+}
+
+func TestGrammarOptionalProperties(t *testing.T) {
+	grammar, err := Grammar(Schema{"properties": map[string]interface{}{
+		"a": map[string]interface{}{"type": "boolean"},
+		"b": map[string]interface{}{"type": "null"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := parseRules(t, grammar)
+	// With nothing required, either property may come first
+	if want := `"{" space ( root-a-kv ( "," space root-b-kv )? | root-b-kv )? "}" space`; rules["root"] != want {
+		t.Errorf("root ::= %s\nwant root ::= %s", rules["root"], want)
+	}
+	assertRulesDefined(t, rules)
+}
+
+func TestGrammarAnyObject(t *testing.T) {
+	grammar, err := Grammar(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := parseRules(t, grammar)
+	if rules["root"] != "object" {
+		t.Fatalf("root ::= %s, want object", rules["root"])
+	}
+	assertRulesDefined(t, rules)
+}
+
+func TestGrammarUnsupported(t *testing.T) {
+	for _, schema := range []Schema{
+		{"$ref": "#/definitions/city"},
+		{"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{"$ref": "#/city"}}},
+		{"type": "date"},
+	} {
+		if _, err := Grammar(schema); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Grammar(%v): err = %v, want ErrUnsupported", schema, err)
+		}
+	}
+}
+
+// parseRules splits a grammar into rule bodies by name, failing on duplicates
+func parseRules(t *testing.T, grammar string) map[string]string {
+	t.Helper()
+	rules := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(grammar, "\n"), "\n") {
+		name, body, ok := strings.Cut(line, " ::= ")
+		if !ok {
+			t.Fatalf("malformed rule %q", line)
+		}
+		if _, dup := rules[name]; dup {
+			t.Fatalf("rule %s is defined twice", name)
+		}
+		rules[name] = body
+	}
+	return rules
+}
+
+var (
+	stringLiteral = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+	charClass     = regexp.MustCompile(`\[(?:[^\]\\]|\\.)*\]`)
+	ruleName      = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9-]*`)
+)
+
+// assertRulesDefined checks that every rule a body refers to is defined
+func assertRulesDefined(t *testing.T, rules map[string]string) {
+	t.Helper()
+	for name, body := range rules {
+		// Drop literals and character classes, leaving rule names and operators
+		body = stringLiteral.ReplaceAllString(body, " ")
+		body = charClass.ReplaceAllString(body, " ")
+		for _, word := range ruleName.FindAllString(body, -1) {
+			if _, ok := rules[word]; !ok {
+				t.Errorf("rule %s refers to undefined rule %s", name, word)
+			}
+		}
+	}
+}
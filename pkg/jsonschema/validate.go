@@ -0,0 +1,216 @@
+// Package jsonschema validates decoded JSON values against the subset of JSON
+// Schema that models are commonly asked to follow: type, properties,
+// required, additionalProperties, items, enum, const and numeric and length
+// bounds. Unsupported keywords are ignored. Schemas can also be converted to
+// llama.cpp grammars that constrain generation to matching JSON.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema document decoded into generic maps
+type Schema = map[string]interface{}
+
+// ValidationError describes the first place a value breaks the schema
+type ValidationError struct {
+	Path    string // JSON pointer to the offending value, "" for the root
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidateJSON decodes data and validates it against the schema
+func ValidateJSON(schema Schema, data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return &ValidationError{Message: fmt.Sprintf("invalid JSON: %v", err)}
+	}
+	return Validate(schema, value)
+}
+
+// Validate checks a value decoded with encoding/json against the schema
+func Validate(schema Schema, value interface{}) error {
+	return validate(schema, value, "")
+}
+
+func validate(schema Schema, value interface{}, path string) error {
+	fail := func(format string, args ...interface{}) error {
+		return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fail("expected %s, got %s", strings.Join(types, " or "), typeOf(value))
+		}
+	}
+
+	if want, ok := schema["const"]; ok && !equal(want, value) {
+		return fail("must be %s", marshal(want))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, want := range enum {
+			if equal(want, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail("must be one of %s", marshal(enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if min, ok := number(schema["minLength"]); ok && length < min {
+			return fail("must be at least %v characters", min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && length > max {
+			return fail("must be at most %v characters", max)
+		}
+	case float64:
+		if min, ok := number(schema["minimum"]); ok && v < min {
+			return fail("must be at least %v", min)
+		}
+		if max, ok := number(schema["maximum"]); ok && v > max {
+			return fail("must be at most %v", max)
+		}
+	case []interface{}:
+		if min, ok := number(schema["minItems"]); ok && float64(len(v)) < min {
+			return fail("must have at least %v items", min)
+		}
+		if max, ok := number(schema["maxItems"]); ok && float64(len(v)) > max {
+			return fail("must have at most %v items", max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validate(items, item, fmt.Sprintf("%s/%d", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, present := v[key]; !present {
+						return fail("missing required property %q", key)
+					}
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := path + "/" + escape(key)
+			if sub, ok := properties[key].(map[string]interface{}); ok {
+				if err := validate(sub, v[key], childPath); err != nil {
+					return err
+				}
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fail("unexpected property %q", key)
+				}
+			case map[string]interface{}:
+				if err := validate(extra, v[key], childPath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// schemaTypes normalizes "type" to a list
+func schemaTypes(t interface{}) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func hasType(value interface{}, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return typeOf(value) == t
+	}
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func number(v interface{}) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
+
+func equal(a, b interface{}) bool {
+	return marshal(a) == marshal(b)
+}
+
+// marshal renders a value for comparison and messages; map keys are sorted
+func marshal(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// escape encodes a property name as a JSON pointer segment
+func escape(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
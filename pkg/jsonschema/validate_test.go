@@ -0,0 +1,87 @@
+package jsonschema
+
+import (
+	"errors"
+	"testing"
+)
+
+var weatherSchema = Schema{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"city":  map[string]interface{}{"type": "string", "minLength": 1.0},
+		"days":  map[string]interface{}{"type": "integer", "minimum": 1.0, "maximum": 7.0},
+		"units": map[string]interface{}{"enum": []interface{}{"metric", "imperial"}},
+		"tags":  map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "maxItems": 2.0},
+	},
+	"required":             []interface{}{"city"},
+	"additionalProperties": false,
+}
+
+func TestValidateJSON(t *testing.T) {
+	tests := []struct {
+		data    string
+		path    string
+		message string
+	}{
+		{`{"city":"Paris"}`, "", ""},
+		{`{"city":"Paris","days":3,"units":"metric","tags":["a","b"]}`, "", ""},
+		{`{"days":3}`, "", `missing required property "city"`},
+		{`{"city":""}`, "/city", "must be at least 1 characters"},
+		{`{"city":"Paris","days":2.5}`, "/days", "expected integer, got number"},
+		{`{"city":"Paris","days":8}`, "/days", "must be at most 7"},
+		{`{"city":"Paris","units":"kelvin"}`, "/units", `must be one of ["metric","imperial"]`},
+		{`{"city":"Paris","tags":["a",1]}`, "/tags/1", "expected string, got number"},
+		{`{"city":"Paris","tags":["a","b","c"]}`, "/tags", "must have at most 2 items"},
+		{`{"city":"Paris","country":"FR"}`, "", `unexpected property "country"`},
+		{`["Paris"]`, "", "expected object, got array"},
+	}
+	for _, tt := range tests {
+		err := ValidateJSON(weatherSchema, []byte(tt.data))
+		if tt.message == "" {
+			if err != nil {
+				t.Errorf("ValidateJSON(%s): %v", tt.data, err)
+			}
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("ValidateJSON(%s): err = %v, want a ValidationError", tt.data, err)
+			continue
+		}
+		if verr.Path != tt.path || verr.Message != tt.message {
+			t.Errorf("ValidateJSON(%s): err = %q at %q, want %q at %q", tt.data, verr.Message, verr.Path, tt.message, tt.path)
+		}
+	}
+
+	if err := ValidateJSON(weatherSchema, []byte(`{"city":`)); err == nil {
+		t.Error("ValidateJSON accepted invalid JSON")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		schema Schema
+		value  interface{}
+		valid  bool
+	}{
+		{Schema{"type": []interface{}{"string", "null"}}, nil, true},
+		{Schema{"type": []interface{}{"string", "null"}}, 1.0, false},
+		{Schema{"const": map[string]interface{}{"a": 1.0}}, map[string]interface{}{"a": 1.0}, true},
+		{Schema{"const": "x"}, "y", false},
+		{Schema{"type": "number", "minimum": 0.0}, -1.0, false},
+		{Schema{"type": "array", "minItems": 1.0}, []interface{}{}, false},
+		{Schema{"additionalProperties": Schema{"type": "boolean"}}, map[string]interface{}{"a/b": "yes"}, false},
+		{Schema{"minLength": 2.0}, "é", false},
+		{Schema{"format": "email"}, "not an email", true}, // Unsupported keywords are ignored
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.schema, tt.value); (err == nil) != tt.valid {
+			t.Errorf("Validate(%v, %v) = %v, want valid %t", tt.schema, tt.value, err, tt.valid)
+		}
+	}
+
+	err := Validate(Schema{"additionalProperties": Schema{"type": "boolean"}}, map[string]interface{}{"a/b": "yes"})
+	if verr, ok := err.(*ValidationError); !ok || verr.Path != "/a~1b" {
+		t.Fatalf("err = %v, want it at the escaped pointer /a~1b", err)
+	}
+}
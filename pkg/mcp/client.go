@@ -0,0 +1,356 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Options configures MCP request metrics
+type Options struct {
+	Calls    *prometheus.CounterVec   // Labelled by server, method and result
+	Duration *prometheus.HistogramVec // Labelled by server and method
+}
+
+// Client is a connection to one MCP server
+type Client struct {
+	name      string
+	transport transport
+	opts      Options
+
+	// Set by initialize
+	Server       Implementation
+	Instructions string
+	capabilities map[string]json.RawMessage
+
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[string]chan *message
+	done    chan struct{}
+	err     error // Why the connection closed
+}
+
+// clientInfo identifies this application to servers
+var clientInfo = Implementation{Name: "genai-app", Version: "1.0.0"}
+
+// Connect starts a connection to the server and runs the initialize handshake
+func Connect(ctx context.Context, name string, cfg ServerConfig, opts Options) (*Client, error) {
+	c := &Client{
+		name:    name,
+		opts:    opts,
+		pending: make(map[string]chan *message),
+		done:    make(chan struct{}),
+	}
+
+	switch {
+	case cfg.URL != "":
+		c.transport = newHTTPTransport(cfg, c.receive)
+	case cfg.Command != "":
+		t, err := newStdioTransport(name, cfg, c.receive, c.closed)
+		if err != nil {
+			return nil, err
+		}
+		c.transport = t
+	default:
+		return nil, fmt.Errorf("server %s needs a command or a url", name)
+	}
+
+	var result initializeResult
+	err := c.call(ctx, "initialize", initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      clientInfo,
+	}, &result)
+	if err == nil {
+		err = c.notify(ctx, "notifications/initialized", nil)
+	}
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to initialize %s: %w", name, err)
+	}
+
+	c.Server = result.ServerInfo
+	c.Instructions = result.Instructions
+	c.capabilities = result.Capabilities
+	return c, nil
+}
+
+// Name returns the configured server name
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Supports reports whether the server declared a capability such as "tools"
+func (c *Client) Supports(capability string) bool {
+	_, ok := c.capabilities[capability]
+	return ok
+}
+
+// ListTools returns every tool of the server, following pagination
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var all []Tool
+	err := c.paginate(ctx, "tools/list", func(data json.RawMessage) (string, error) {
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		err := json.Unmarshal(data, &page)
+		all = append(all, page.Tools...)
+		return page.NextCursor, err
+	})
+	return all, err
+}
+
+// ListResources returns every resource of the server
+func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
+	var all []Resource
+	err := c.paginate(ctx, "resources/list", func(data json.RawMessage) (string, error) {
+		var page struct {
+			Resources  []Resource `json:"resources"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		err := json.Unmarshal(data, &page)
+		all = append(all, page.Resources...)
+		return page.NextCursor, err
+	})
+	return all, err
+}
+
+// ListPrompts returns every prompt of the server
+func (c *Client) ListPrompts(ctx context.Context) ([]Prompt, error) {
+	var all []Prompt
+	err := c.paginate(ctx, "prompts/list", func(data json.RawMessage) (string, error) {
+		var page struct {
+			Prompts    []Prompt `json:"prompts"`
+			NextCursor string   `json:"nextCursor"`
+		}
+		err := json.Unmarshal(data, &page)
+		all = append(all, page.Prompts...)
+		return page.NextCursor, err
+	})
+	return all, err
+}
+
+// CallTool invokes a tool with JSON object arguments
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (*CallToolResult, error) {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	var result CallToolResult
+	err := c.call(ctx, "tools/call", struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}{name, args}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ReadResource returns the contents of a resource
+func (c *Client) ReadResource(ctx context.Context, uri string) ([]ResourceContent, error) {
+	var result struct {
+		Contents []ResourceContent `json:"contents"`
+	}
+	if err := c.call(ctx, "resources/read", map[string]string{"uri": uri}, &result); err != nil {
+		return nil, err
+	}
+	return result.Contents, nil
+}
+
+// GetPrompt renders a prompt with its arguments
+func (c *Client) GetPrompt(ctx context.Context, name string, args map[string]string) (*GetPromptResult, error) {
+	var result GetPromptResult
+	err := c.call(ctx, "prompts/get", struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments,omitempty"`
+	}{name, args}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close ends the connection
+func (c *Client) Close() error {
+	err := c.transport.close()
+	c.closed(ErrClosed)
+	return err
+}
+
+// paginate calls a list method until the server returns no cursor
+func (c *Client) paginate(ctx context.Context, method string, page func(json.RawMessage) (string, error)) error {
+	cursor := ""
+	for {
+		var params interface{}
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		var result json.RawMessage
+		if err := c.call(ctx, method, params, &result); err != nil {
+			return err
+		}
+		next, err := page(result)
+		if err != nil {
+			return err
+		}
+		if next == "" || next == cursor {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// call sends a request and waits for its response, inside a span and with
+// the call counted by method and result
+func (c *Client) call(ctx context.Context, method string, params, result interface{}) (err error) {
+	ctx, span := tracing.StartChildSpan(ctx, "mcp."+method)
+	defer span.End()
+	span.SetAttributes(attribute.String("mcp.server", c.name), attribute.String("mcp.method", method))
+
+	start := time.Now()
+	defer func() {
+		outcome := "success"
+		var rpcErr *RPCError
+		switch {
+		case errors.As(err, &rpcErr):
+			outcome = "rpc_error"
+		case errors.Is(err, context.DeadlineExceeded):
+			outcome = "timeout"
+		case err != nil:
+			outcome = "error"
+		}
+		if err != nil {
+			tracing.RecordError(ctx, err, "MCP request failed")
+		}
+		if c.opts.Calls != nil {
+			c.opts.Calls.WithLabelValues(c.name, method, outcome).Inc()
+		}
+		if c.opts.Duration != nil {
+			c.opts.Duration.WithLabelValues(c.name, method).Observe(time.Since(start).Seconds())
+		}
+	}()
+
+	msg, err := newMessage(method, params)
+	if err != nil {
+		return err
+	}
+	id := json.RawMessage(strconv.FormatInt(c.nextID.Add(1), 10))
+	msg.ID = &id
+
+	reply := make(chan *message, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.pending[string(id)] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, string(id))
+		c.mu.Unlock()
+	}()
+
+	if err := c.transport.send(ctx, msg); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-reply:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		c.cancel(id)
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification, which has no response
+func (c *Client) notify(ctx context.Context, method string, params interface{}) error {
+	msg, err := newMessage(method, params)
+	if err != nil {
+		return err
+	}
+	return c.transport.send(ctx, msg)
+}
+
+// cancel tells the server to stop working on an abandoned request
+func (c *Client) cancel(id json.RawMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.notify(ctx, "notifications/cancelled", map[string]interface{}{"requestId": id, "reason": "request timed out"})
+}
+
+func newMessage(method string, params interface{}) (*message, error) {
+	msg := &message{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		msg.Params = data
+	}
+	return msg, nil
+}
+
+// receive routes a message from the server: responses go to the waiting
+// call, pings are answered and other server requests are declined
+func (c *Client) receive(msg *message) {
+	switch {
+	case msg.isResponse():
+		c.mu.Lock()
+		reply, ok := c.pending[string(*msg.ID)]
+		c.mu.Unlock()
+		if ok {
+			reply <- msg
+		}
+	case msg.isRequest():
+		resp := &message{JSONRPC: "2.0", ID: msg.ID}
+		if msg.Method == "ping" {
+			resp.Result = json.RawMessage("{}")
+		} else {
+			resp.Error = &RPCError{Code: codeMethodNotFound, Message: "method not supported by client: " + msg.Method}
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := c.transport.send(ctx, resp); err != nil {
+				log.Warn().Err(err).Str("server", c.name).Msg("Failed to answer MCP server request")
+			}
+		}()
+	default:
+		log.Debug().Str("server", c.name).Str("method", msg.Method).Msg("MCP notification")
+	}
+}
+
+// closed fails pending and future calls once the connection has ended
+func (c *Client) closed(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = fmt.Errorf("%w: %v", ErrClosed, err)
+	if errors.Is(err, ErrClosed) {
+		c.err = ErrClosed
+	}
+	close(c.done)
+}
@@ -0,0 +1,154 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/mcp"
+	"github.com/ajeetraina/genai-app-demo/pkg/mcp/mcptest"
+	"github.com/ajeetraina/genai-app-demo/pkg/tools"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// buildStub compiles the stub server binary once per test
+func buildStub(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mcp-stub")
+	cmd := exec.Command("go", "build", "-o", path, "github.com/ajeetraina/genai-app-demo/cmd/mcp-stub")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build the stub server: %v\n%s", err, out)
+	}
+	return path
+}
+
+// servers returns a stdio and a streamable HTTP config for the stub server
+func servers(t *testing.T) map[string]mcp.ServerConfig {
+	t.Helper()
+	httpServer := httptest.NewServer(mcptest.NewServer())
+	t.Cleanup(httpServer.Close)
+
+	return map[string]mcp.ServerConfig{
+		"stdio": {Command: buildStub(t)},
+		"http":  {URL: httpServer.URL},
+	}
+}
+
+func TestClient(t *testing.T) {
+	for name, cfg := range servers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			client, err := mcp.Connect(ctx, name, cfg, mcp.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			if client.Server.Name != "mcp-stub" {
+				t.Fatalf("server name = %q, want mcp-stub", client.Server.Name)
+			}
+
+			list, err := client.ListTools(ctx)
+			if err != nil || len(list) != 3 {
+				t.Fatalf("ListTools() = %d tools, %v; want 3", len(list), err)
+			}
+
+			result, err := client.CallTool(ctx, "add", json.RawMessage(`{"a": 2, "b": 3}`))
+			if err != nil || result.IsError || result.Content[0].Text != "5" {
+				t.Fatalf("add = %+v, %v; want 5", result, err)
+			}
+			result, err = client.CallTool(ctx, "fail", nil)
+			if err != nil || !result.IsError {
+				t.Fatalf("fail = %+v, %v; want a tool error", result, err)
+			}
+
+			contents, err := client.ReadResource(ctx, "stub://readme")
+			if err != nil || len(contents) != 1 || !strings.Contains(contents[0].Text, "three tools") {
+				t.Fatalf("ReadResource() = %+v, %v", contents, err)
+			}
+			if _, err := client.ReadResource(ctx, "stub://missing"); err == nil {
+				t.Fatal("expected an error for a missing resource")
+			}
+
+			prompt, err := client.GetPrompt(ctx, "greet", map[string]string{"name": "Ada"})
+			if err != nil || len(prompt.Messages) != 1 || prompt.Messages[0].Content.Text != "Say hello to Ada" {
+				t.Fatalf("GetPrompt() = %+v, %v", prompt, err)
+			}
+		})
+	}
+}
+
+func TestManagerExposesTools(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	calls := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "mcp_calls"}, []string{"server", "method", "result"})
+	registry := tools.NewRegistry(tools.Options{})
+	manager := mcp.NewManager(registry, mcp.Options{Calls: calls})
+	defer manager.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cfg := servers(t)
+	cfg["broken"] = mcp.ServerConfig{Command: "/nonexistent/mcp-server"}
+	manager.Connect(ctx, mcp.Config{Servers: cfg})
+
+	for _, status := range manager.Status() {
+		if status.Name == "broken" {
+			if status.Connected || status.Error == "" {
+				t.Fatalf("broken server status = %+v, want an error", status)
+			}
+			continue
+		}
+		if !status.Connected || len(status.Tools) != 5 {
+			t.Fatalf("%s status = %+v, want 3 tools plus resource and prompt tools", status.Name, status)
+		}
+	}
+
+	for _, server := range []string{"stdio", "http"} {
+		out, err := registry.Call(ctx, server+"__add", json.RawMessage(`{"a": 1.5, "b": 2}`))
+		if err != nil || out != "3.5" {
+			t.Fatalf("%s__add = %q, %v; want 3.5", server, out, err)
+		}
+		if _, err := registry.Call(ctx, server+"__add", json.RawMessage(`{"a": 1}`)); err == nil {
+			t.Fatalf("%s__add accepted arguments missing b", server)
+		}
+		if _, err := registry.Call(ctx, server+"__fail", nil); err == nil || !strings.Contains(err.Error(), "stub tool failed") {
+			t.Fatalf("%s__fail error = %v, want the tool's message", server, err)
+		}
+		out, err = registry.Call(ctx, server+"__read_resource", json.RawMessage(`{"uri": "stub://readme"}`))
+		if err != nil || !strings.Contains(out, "three tools") {
+			t.Fatalf("%s__read_resource = %q, %v", server, out, err)
+		}
+		out, err = registry.Call(ctx, server+"__get_prompt", json.RawMessage(`{"name": "greet", "arguments": {"name": "Ada"}}`))
+		if err != nil || out != "user: Say hello to Ada" {
+			t.Fatalf("%s__get_prompt = %q, %v", server, out, err)
+		}
+
+		// Two successful tool calls per server: add and fail (a tool error is still a successful request)
+		if got := testutil.ToFloat64(calls.WithLabelValues(server, "tools/call", "success")); got != 2 {
+			t.Fatalf("%s tools/call count = %v, want 2", server, got)
+		}
+	}
+
+	traced := 0
+	for _, span := range recorder.Ended() {
+		if span.Name() == "mcp.tools/call" {
+			traced++
+		}
+	}
+	if traced != 4 {
+		t.Fatalf("traced %d tool calls, want 4", traced)
+	}
+}
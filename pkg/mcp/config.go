@@ -0,0 +1,78 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Config lists the MCP servers to connect to. The format matches the
+// "mcpServers" files used by desktop MCP clients, so existing entries can be
+// copied over.
+type Config struct {
+	Servers map[string]ServerConfig `json:"mcpServers"`
+}
+
+// ServerConfig describes one server: a command for stdio servers, or a URL
+// for streamable HTTP servers. Values in Env and Headers may reference
+// environment variables as $NAME or ${NAME}.
+type ServerConfig struct {
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout Duration          `json:"timeout,omitempty"` // Per tool call; defaults to 30s
+}
+
+// Transport names the transport the server uses
+func (c ServerConfig) Transport() string {
+	if c.URL != "" {
+		return "http"
+	}
+	return "stdio"
+}
+
+// Duration is a time.Duration written as a string such as "30s" in JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadConfig reads a config file. A missing file is an empty config.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid MCP config %s: %w", path, err)
+	}
+	for name, server := range cfg.Servers {
+		if server.Command == "" && server.URL == "" {
+			return cfg, fmt.Errorf("invalid MCP config %s: server %s needs a command or a url", path, name)
+		}
+	}
+	return cfg, nil
+}
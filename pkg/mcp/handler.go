@@ -0,0 +1,26 @@
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves the status of the configured MCP servers
+type Handler struct {
+	manager *Manager
+}
+
+// NewHandler creates an HTTP handler for the manager
+func NewHandler(manager *Manager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// Register adds the MCP routes to the mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /mcp/servers", h.listServers)
+}
+
+func (h *Handler) listServers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.manager.Status())
+}
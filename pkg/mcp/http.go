@@ -0,0 +1,182 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// httpTransport implements the streamable HTTP transport: every message is
+// POSTed to the server URL, which answers with JSON or with an SSE stream
+// carrying the response and any messages the server sends meanwhile
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	receive func(*message)
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+func newHTTPTransport(cfg ServerConfig, receive func(*message)) *httpTransport {
+	headers := make(map[string]string, len(cfg.Headers))
+	for key, value := range cfg.Headers {
+		headers[key] = os.ExpandEnv(value)
+	}
+	return &httpTransport{
+		url:     cfg.URL,
+		headers: headers,
+		// Responses may stream for as long as a tool runs, so only connection
+		// setup is bounded here; calls are bounded by their context
+		client:  &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 5 * time.Minute}},
+		receive: receive,
+	}
+}
+
+func (t *httpTransport) send(ctx context.Context, msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+
+	if resp.StatusCode == http.StatusAccepted {
+		resp.Body.Close()
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return fmt.Errorf("mcp server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		// The response arrives on the stream, possibly after server requests
+		go func() {
+			defer resp.Body.Close()
+			t.readEvents(resp.Body)
+		}()
+		return nil
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return t.deliver(body)
+}
+
+// readEvents delivers the data of each SSE event until the stream ends
+func (t *httpTransport) readEvents(body io.Reader) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() > 0 {
+				if err := t.deliver(data.Bytes()); err != nil {
+					log.Warn().Err(err).Str("url", t.url).Msg("Ignoring malformed MCP event")
+				}
+				data.Reset()
+			}
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if data.Len() > 0 {
+		t.deliver(data.Bytes())
+	}
+}
+
+// deliver decodes a message or a batch of messages
+func (t *httpTransport) deliver(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '[' {
+		var batch []*message
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return err
+		}
+		for _, msg := range batch {
+			t.receive(msg)
+		}
+		return nil
+	}
+
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	t.receive(&msg)
+	return nil
+}
+
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+}
+
+// close ends the session on the server, if it issued one
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+
+	if sessionID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+		if err == nil {
+			t.setHeaders(req)
+			if resp, err := t.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	t.client.CloseIdleConnections()
+	return nil
+}
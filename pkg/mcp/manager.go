@@ -0,0 +1,318 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/jsonschema"
+	"github.com/ajeetraina/genai-app-demo/pkg/tools"
+	"github.com/rs/zerolog/log"
+)
+
+// ServerStatus describes a configured server and what it offers
+type ServerStatus struct {
+	Name      string         `json:"name"`
+	Transport string         `json:"transport"`
+	Connected bool           `json:"connected"`
+	Error     string         `json:"error,omitempty"`
+	Server    Implementation `json:"server_info"`
+	Tools     []string       `json:"tools"` // Names registered with the tool registry
+	Resources []Resource     `json:"resources"`
+	Prompts   []Prompt       `json:"prompts"`
+}
+
+// Manager connects to the configured servers and registers their tools,
+// resources and prompts as tools the model can call. MCP tools are named
+// "<server>__<tool>"; each server with resources gets a
+// "<server>__read_resource" tool and each server with prompts a
+// "<server>__get_prompt" tool.
+type Manager struct {
+	registry *tools.Registry
+	opts     Options
+
+	mu      sync.Mutex
+	clients []*Client
+	status  []ServerStatus
+}
+
+// NewManager creates a manager that registers tools with the registry
+func NewManager(registry *tools.Registry, opts Options) *Manager {
+	return &Manager{registry: registry, opts: opts}
+}
+
+// Connect connects to every server in the config. A server that fails is
+// logged and reported in Status; the others are still connected.
+func (m *Manager) Connect(ctx context.Context, cfg Config) {
+	names := make([]string, 0, len(cfg.Servers))
+	for name := range cfg.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		status, err := m.connect(ctx, name, cfg.Servers[name])
+		if err != nil {
+			log.Error().Err(err).Str("server", name).Msg("Failed to connect to MCP server")
+			status.Error = err.Error()
+		} else {
+			log.Info().Str("server", name).Int("tools", len(status.Tools)).
+				Int("resources", len(status.Resources)).Int("prompts", len(status.Prompts)).
+				Msg("Connected to MCP server")
+		}
+
+		m.mu.Lock()
+		m.status = append(m.status, status)
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) connect(ctx context.Context, name string, cfg ServerConfig) (ServerStatus, error) {
+	status := ServerStatus{Name: name, Transport: cfg.Transport(), Tools: []string{}, Resources: []Resource{}, Prompts: []Prompt{}}
+
+	connectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	client, err := Connect(connectCtx, name, cfg, m.opts)
+	if err != nil {
+		return status, err
+	}
+	status.Server = client.Server
+
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	var registered []string
+	register := func(tool tools.Tool) error {
+		if err := m.registry.Register(tool); err != nil {
+			return err
+		}
+		registered = append(registered, tool.Name)
+		return nil
+	}
+	fail := func(err error) (ServerStatus, error) {
+		for _, toolName := range registered {
+			m.registry.Unregister(toolName)
+		}
+		client.Close()
+		return status, err
+	}
+
+	if client.Supports("tools") {
+		list, err := client.ListTools(connectCtx)
+		if err != nil {
+			return fail(fmt.Errorf("failed to list tools: %w", err))
+		}
+		for _, t := range list {
+			if err := register(m.toolFor(client, t, timeout)); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if client.Supports("resources") {
+		list, err := client.ListResources(connectCtx)
+		if err != nil {
+			return fail(fmt.Errorf("failed to list resources: %w", err))
+		}
+		if len(list) > 0 {
+			if err := register(resourceTool(client, list, timeout)); err != nil {
+				return fail(err)
+			}
+		}
+		status.Resources = list
+	}
+	if client.Supports("prompts") {
+		list, err := client.ListPrompts(connectCtx)
+		if err != nil {
+			return fail(fmt.Errorf("failed to list prompts: %w", err))
+		}
+		if len(list) > 0 {
+			if err := register(promptTool(client, list, timeout)); err != nil {
+				return fail(err)
+			}
+		}
+		status.Prompts = list
+	}
+
+	status.Connected = true
+	status.Tools = append(status.Tools, registered...)
+	m.mu.Lock()
+	m.clients = append(m.clients, client)
+	m.mu.Unlock()
+	return status, nil
+}
+
+// Status reports every configured server
+func (m *Manager) Status() []ServerStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ServerStatus{}, m.status...)
+}
+
+// Close disconnects from every server
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, client := range m.clients {
+		client.Close()
+	}
+	m.clients = nil
+}
+
+// invalidToolChars are characters the chat completions API does not accept in tool names
+var invalidToolChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// toolName builds a registry name from the server and tool names
+func toolName(server, name string) string {
+	full := invalidToolChars.ReplaceAllString(server+"__"+name, "_")
+	if len(full) > 64 {
+		full = full[:64]
+	}
+	return full
+}
+
+// toolFor wraps an MCP tool as a registry tool
+func (m *Manager) toolFor(client *Client, t Tool, timeout time.Duration) tools.Tool {
+	schema := t.InputSchema
+	if schema == nil {
+		schema = jsonschema.Schema{"type": "object"}
+	}
+	return tools.Tool{
+		Name:        toolName(client.Name(), t.Name),
+		Description: describe(client.Name(), t.Description),
+		Parameters:  schema,
+		Mutating:    !t.ReadOnly(),
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			result, err := client.CallTool(ctx, t.Name, args)
+			if err != nil {
+				return "", err
+			}
+			if result.IsError {
+				return "", errors.New(text(result.Content))
+			}
+			return text(result.Content), nil
+		},
+	}
+}
+
+// resourceTool lets the model read the server's resources by URI
+func resourceTool(client *Client, resources []Resource, timeout time.Duration) tools.Tool {
+	uris := make([]interface{}, len(resources))
+	var listing strings.Builder
+	for i, r := range resources {
+		uris[i] = r.URI
+		fmt.Fprintf(&listing, "\n- %s: %s", r.URI, r.Name)
+		if r.Description != "" {
+			fmt.Fprintf(&listing, " (%s)", r.Description)
+		}
+	}
+
+	return tools.Tool{
+		Name:        toolName(client.Name(), "read_resource"),
+		Description: describe(client.Name(), "Read one of these resources:"+listing.String()),
+		Parameters: jsonschema.Schema{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"uri": map[string]interface{}{"type": "string", "enum": uris},
+			},
+			"required": []interface{}{"uri"},
+		},
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var params struct {
+				URI string `json:"uri"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return "", err
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			contents, err := client.ReadResource(ctx, params.URI)
+			if err != nil {
+				return "", err
+			}
+			items := make([]Content, len(contents))
+			for i := range contents {
+				items[i] = Content{Type: "resource", Resource: &contents[i]}
+			}
+			return text(items), nil
+		},
+	}
+}
+
+// promptTool lets the model render the server's prompts
+func promptTool(client *Client, prompts []Prompt, timeout time.Duration) tools.Tool {
+	names := make([]interface{}, len(prompts))
+	var listing strings.Builder
+	for i, p := range prompts {
+		names[i] = p.Name
+		fmt.Fprintf(&listing, "\n- %s", p.Name)
+		if p.Description != "" {
+			fmt.Fprintf(&listing, ": %s", p.Description)
+		}
+		for _, arg := range p.Arguments {
+			fmt.Fprintf(&listing, " [%s", arg.Name)
+			if arg.Required {
+				listing.WriteString(", required")
+			}
+			listing.WriteString("]")
+		}
+	}
+
+	return tools.Tool{
+		Name:        toolName(client.Name(), "get_prompt"),
+		Description: describe(client.Name(), "Get one of these prompt templates, filled in with arguments:"+listing.String()),
+		Parameters: jsonschema.Schema{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{"type": "string", "enum": names},
+				"arguments": map[string]interface{}{
+					"type":                 "object",
+					"additionalProperties": map[string]interface{}{"type": "string"},
+				},
+			},
+			"required": []interface{}{"name"},
+		},
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var params struct {
+				Name      string            `json:"name"`
+				Arguments map[string]string `json:"arguments"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return "", err
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			result, err := client.GetPrompt(ctx, params.Name, params.Arguments)
+			if err != nil {
+				return "", err
+			}
+			var b strings.Builder
+			for i, msg := range result.Messages {
+				if i > 0 {
+					b.WriteString("\n\n")
+				}
+				fmt.Fprintf(&b, "%s: %s", msg.Role, text([]Content{msg.Content}))
+			}
+			return b.String(), nil
+		},
+	}
+}
+
+// describe prefixes a description with the server it comes from
+func describe(server, description string) string {
+	if description == "" {
+		return fmt.Sprintf("[%s]", server)
+	}
+	return fmt.Sprintf("[%s] %s", server, description)
+}
@@ -0,0 +1,273 @@
+// Package mcptest is a small MCP server for tests and local development. It
+// offers a few fixed tools, a resource and a prompt over stdio or streamable
+// HTTP.
+package mcptest
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Server answers MCP requests. Tools:
+//
+//   - echo: returns its "text" argument
+//   - add: returns the sum of "a" and "b"
+//   - fail: always reports a tool error
+//
+// It also serves the resource stub://readme and the prompt "greet".
+type Server struct {
+	mu       sync.Mutex
+	sessions map[string]bool
+	calls    map[string]int
+}
+
+// NewServer creates a stub server
+func NewServer() *Server {
+	return &Server{sessions: make(map[string]bool), calls: make(map[string]int)}
+}
+
+// Calls returns how often a tool has been called
+func (s *Server) Calls(tool string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[tool]
+}
+
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ServeStdio reads newline-delimited requests from r and writes responses to w
+// until r ends
+func (s *Server) ServeStdio(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			continue
+		}
+		resp := s.handle(req)
+		if resp == nil {
+			continue
+		}
+		data, _ := json.Marshal(resp)
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ServeHTTP implements the streamable HTTP transport. Tool calls are answered
+// as an SSE stream preceded by a progress notification; everything else as JSON.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session := r.Header.Get("Mcp-Session-Id")
+	switch r.Method {
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, session)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodPost:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON-RPC message", http.StatusBadRequest)
+		return
+	}
+
+	if req.Method == "initialize" {
+		id := make([]byte, 16)
+		rand.Read(id)
+		session = hex.EncodeToString(id)
+		s.mu.Lock()
+		s.sessions[session] = true
+		s.mu.Unlock()
+		w.Header().Set("Mcp-Session-Id", session)
+	} else {
+		s.mu.Lock()
+		known := s.sessions[session]
+		s.mu.Unlock()
+		if !known {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+	}
+
+	resp := s.handle(req)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	data, _ := json.Marshal(resp)
+
+	if req.Method == "tools/call" {
+		w.Header().Set("Content-Type", "text/event-stream")
+		progress, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "notifications/progress",
+			"params":  map[string]interface{}{"progressToken": 1, "progress": 1},
+		})
+		fmt.Fprintf(w, "data: %s\n\ndata: %s\n\n", progress, data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// handle returns the response to a request, or nil for notifications and responses
+func (s *Server) handle(req request) *response {
+	if req.ID == nil || req.Method == "" {
+		return nil
+	}
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	result, err := s.dispatch(req.Method, req.Params)
+	if err != nil {
+		resp.Error = err
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
+
+func (s *Server) dispatch(method string, params json.RawMessage) (interface{}, *rpcError) {
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": "2025-03-26",
+			"capabilities": map[string]interface{}{
+				"tools":     map[string]interface{}{},
+				"resources": map[string]interface{}{},
+				"prompts":   map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "mcp-stub", "version": "0.1.0"},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": []map[string]interface{}{
+			{
+				"name":        "echo",
+				"description": "Echo the text back",
+				"annotations": map[string]interface{}{"readOnlyHint": true},
+				"inputSchema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"text": map[string]string{"type": "string"}},
+					"required":   []string{"text"},
+				},
+			},
+			{
+				"name":        "add",
+				"description": "Add two numbers",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"a": map[string]string{"type": "number"},
+						"b": map[string]string{"type": "number"},
+					},
+					"required": []string{"a", "b"},
+				},
+			},
+			{
+				"name":        "fail",
+				"description": "Always fails",
+				"inputSchema": map[string]interface{}{"type": "object"},
+			},
+		}}, nil
+	case "tools/call":
+		var call struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				Text string  `json:"text"`
+				A    float64 `json:"a"`
+				B    float64 `json:"b"`
+			} `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &call); err != nil {
+			return nil, &rpcError{Code: -32602, Message: "invalid params"}
+		}
+		s.mu.Lock()
+		s.calls[call.Name]++
+		s.mu.Unlock()
+
+		switch call.Name {
+		case "echo":
+			return toolText(call.Arguments.Text, false), nil
+		case "add":
+			return toolText(fmt.Sprint(call.Arguments.A+call.Arguments.B), false), nil
+		case "fail":
+			return toolText("the stub tool failed", true), nil
+		}
+		return nil, &rpcError{Code: -32602, Message: "unknown tool " + call.Name}
+	case "resources/list":
+		return map[string]interface{}{"resources": []map[string]string{
+			{"uri": "stub://readme", "name": "README", "mimeType": "text/plain"},
+		}}, nil
+	case "resources/read":
+		var read struct {
+			URI string `json:"uri"`
+		}
+		json.Unmarshal(params, &read)
+		if read.URI != "stub://readme" {
+			return nil, &rpcError{Code: -32002, Message: "resource not found"}
+		}
+		return map[string]interface{}{"contents": []map[string]string{
+			{"uri": read.URI, "mimeType": "text/plain", "text": "The stub server has three tools."},
+		}}, nil
+	case "prompts/list":
+		return map[string]interface{}{"prompts": []map[string]interface{}{
+			{
+				"name":        "greet",
+				"description": "Greet someone",
+				"arguments":   []map[string]interface{}{{"name": "name", "required": true}},
+			},
+		}}, nil
+	case "prompts/get":
+		var get struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+		}
+		json.Unmarshal(params, &get)
+		if get.Name != "greet" {
+			return nil, &rpcError{Code: -32602, Message: "unknown prompt " + get.Name}
+		}
+		return map[string]interface{}{"messages": []map[string]interface{}{
+			{"role": "user", "content": map[string]string{"type": "text", "text": "Say hello to " + get.Arguments["name"]}},
+		}}, nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "method not found"}
+}
+
+func toolText(text string, isError bool) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
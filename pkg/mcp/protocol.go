@@ -0,0 +1,164 @@
+// Package mcp is a Model Context Protocol client. It connects to MCP servers
+// over stdio or streamable HTTP, discovers their tools, resources and prompts,
+// and exposes them to the model through the tool registry.
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ProtocolVersion is the MCP revision the client speaks
+const ProtocolVersion = "2025-03-26"
+
+// JSON-RPC error codes used by MCP
+const (
+	codeMethodNotFound = -32601
+)
+
+// message is a JSON-RPC 2.0 request, notification or response. Requests have
+// an ID and a method, notifications only a method, responses an ID and either
+// a result or an error.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *RPCError        `json:"error,omitempty"`
+}
+
+func (m *message) isResponse() bool { return m.ID != nil && m.Method == "" }
+func (m *message) isRequest() bool  { return m.ID != nil && m.Method != "" }
+
+// RPCError is an error returned by the server
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+// Implementation names a client or server
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type initializeParams struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ClientInfo      Implementation         `json:"clientInfo"`
+}
+
+type initializeResult struct {
+	ProtocolVersion string                     `json:"protocolVersion"`
+	Capabilities    map[string]json.RawMessage `json:"capabilities"`
+	ServerInfo      Implementation             `json:"serverInfo"`
+	Instructions    string                     `json:"instructions,omitempty"`
+}
+
+// Tool is a tool offered by a server
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	Annotations *ToolAnnotations       `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations are hints about a tool's behaviour. They come from the
+// server and are not guaranteed to be accurate.
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    *bool  `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"`
+}
+
+// ReadOnly reports whether the server declared that the tool does not modify
+// its environment. Tools without the hint are assumed to mutate state.
+func (t Tool) ReadOnly() bool {
+	return t.Annotations != nil && t.Annotations.ReadOnlyHint != nil && *t.Annotations.ReadOnlyHint
+}
+
+// Resource is a piece of context a server can provide
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// Prompt is a prompt template offered by a server
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// PromptArgument is a parameter of a prompt template
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Content is an item of tool output or a prompt message. Only text is
+// passed on to the model; other types are summarized.
+type Content struct {
+	Type     string           `json:"type"`
+	Text     string           `json:"text,omitempty"`
+	MimeType string           `json:"mimeType,omitempty"`
+	Resource *ResourceContent `json:"resource,omitempty"`
+}
+
+// ResourceContent is the body of a resource
+type ResourceContent struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// CallToolResult is the outcome of a tool call. Tool failures are reported
+// with IsError rather than as protocol errors.
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// PromptMessage is a message of a rendered prompt
+type PromptMessage struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// GetPromptResult is a rendered prompt
+type GetPromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// text flattens content items into the text given to the model
+func text(items []Content) string {
+	var b strings.Builder
+	for i, item := range items {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		switch {
+		case item.Type == "text":
+			b.WriteString(item.Text)
+		case item.Resource != nil && item.Resource.Text != "":
+			b.WriteString(item.Resource.Text)
+		case item.Resource != nil:
+			fmt.Fprintf(&b, "[binary resource %s]", item.Resource.URI)
+		default:
+			fmt.Fprintf(&b, "[%s content %s]", item.Type, item.MimeType)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,129 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrClosed is returned for calls on a closed connection
+var ErrClosed = errors.New("mcp connection closed")
+
+// transport carries JSON-RPC messages to a server. Messages from the server
+// are passed to the receive callback given when the transport is created;
+// when the connection ends, closed is called once with the reason.
+type transport interface {
+	send(ctx context.Context, msg *message) error
+	close() error
+}
+
+// maxLineSize bounds a single stdio message
+const maxLineSize = 16 << 20
+
+// stdioTransport runs the server as a subprocess and exchanges
+// newline-delimited JSON over its stdin and stdout
+type stdioTransport struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	mu   sync.Mutex // Serializes writes
+	done chan struct{}
+}
+
+func newStdioTransport(name string, cfg ServerConfig, receive func(*message), closed func(error)) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for key, value := range cfg.Env {
+		cmd.Env = append(cmd.Env, key+"="+os.ExpandEnv(value))
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", cfg.Command, err)
+	}
+
+	t := &stdioTransport{cmd: cmd, stdin: stdin, done: make(chan struct{})}
+
+	// Servers log to stderr
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Debug().Str("server", name).Msg(scanner.Text())
+		}
+	}()
+
+	go func() {
+		defer close(t.done)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+		for scanner.Scan() {
+			var msg message
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				log.Warn().Err(err).Str("server", name).Msg("Ignoring malformed MCP message")
+				continue
+			}
+			receive(&msg)
+		}
+		err := scanner.Err()
+		if err == nil {
+			err = ErrClosed
+		}
+		closed(err)
+	}()
+
+	return t, nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.done:
+		return ErrClosed
+	default:
+	}
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// close ends the server by closing its stdin, killing it if it does not exit
+func (t *stdioTransport) close() error {
+	t.mu.Lock()
+	t.stdin.Close()
+	t.mu.Unlock()
+
+	exited := make(chan error, 1)
+	go func() { exited <- t.cmd.Wait() }()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.cmd.Process.Kill()
+		<-exited
+	}
+	return nil
+}
@@ -93,7 +93,6 @@ func CleanupOldMetrics() {
 func HandleMetricsSummary() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 
 		CleanupOldMetrics()
 
@@ -144,21 +143,11 @@ func HandleMetricsSummary() http.HandlerFunc {
 // HandleLogMetrics handles metric logging from the frontend
 func HandleLogMetrics() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
 		var metric MessageMetrics
 		if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
 			log.Error().Err(err).Msg("Failed to decode metrics payload")
@@ -189,21 +178,11 @@ func HandleLogMetrics() http.HandlerFunc {
 // HandleLogError handles error logging from the frontend
 func HandleLogError() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
 		var errorEntry ErrorLogEntry
 		if err := json.NewDecoder(r.Body).Decode(&errorEntry); err != nil {
 			log.Error().Err(err).Msg("Failed to decode error payload")
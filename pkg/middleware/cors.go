@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CORSConfig holds the cross-origin policy applied to every route
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int // Preflight cache lifetime in seconds, 0 disables the header
+}
+
+// AllowsOrigin reports whether the origin matches the configured allowlist.
+// Entries may be "*", an exact origin, or a wildcard subdomain such as
+// "https://*.example.com".
+func (c CORSConfig) AllowsOrigin(origin string) bool {
+	return c.allowsOrigin(origin, true)
+}
+
+// ListsOrigin reports whether the origin matches an exact or wildcard
+// subdomain entry of the allowlist, ignoring "*". It is for checks that must
+// not trust every site, such as WebSocket upgrades, which browsers make with
+// the user's cookies whatever the CORS policy.
+func (c CORSConfig) ListsOrigin(origin string) bool {
+	return c.allowsOrigin(origin, false)
+}
+
+func (c CORSConfig) allowsOrigin(origin string, anyOrigin bool) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			if anyOrigin {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok {
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowsAnyOrigin reports whether the allowlist is the "*" wildcard
+func (c CORSConfig) allowsAnyOrigin() bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsMethod reports whether the method is in the allowlist
+func (c CORSConfig) allowsMethod(method string) bool {
+	// Simple methods are always allowed by the CORS spec
+	if method == http.MethodGet || method == http.MethodHead || method == http.MethodPost {
+		return true
+	}
+	for _, allowed := range c.AllowedMethods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders reports whether every requested header is in the allowlist
+func (c CORSConfig) allowsHeaders(requested string) bool {
+	if requested == "" {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		found := false
+		for _, allowed := range c.AllowedHeaders {
+			if allowed == "*" || strings.EqualFold(allowed, header) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// CORSMiddleware applies the CORS policy to all requests and answers
+// preflight requests directly. Rejected requests are counted by reason.
+func CORSMiddleware(cfg CORSConfig, rejectedCounter *prometheus.CounterVec) func(http.Handler) http.Handler {
+	allowedMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(cfg.MaxAge)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			// Same-origin and non-browser requests carry no Origin header
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if !cfg.AllowsOrigin(origin) {
+				rejectedCounter.WithLabelValues("origin").Inc()
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				// Serve the request without CORS headers so the browser blocks the response
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Credentials are only allowed for listed origins: with "*", any
+			// site could otherwise act as the user and read the response
+			switch {
+			case cfg.AllowCredentials && cfg.ListsOrigin(origin):
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			case cfg.allowsAnyOrigin():
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			default:
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if !preflight {
+				if exposedHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !cfg.allowsMethod(r.Header.Get("Access-Control-Request-Method")) {
+				rejectedCounter.WithLabelValues("method").Inc()
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if !cfg.allowsHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+				rejectedCounter.WithLabelValues("headers").Inc()
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
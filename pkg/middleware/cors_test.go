@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newCORSHandler(cfg CORSConfig) (http.Handler, *prometheus.CounterVec) {
+	rejected := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "cors_rejected_total"}, []string{"reason"})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return CORSMiddleware(cfg, rejected)(next), rejected
+}
+
+func preflight(origin, method, headers string) *http.Request {
+	r := httptest.NewRequest(http.MethodOptions, "/chat", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return r
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	cfg := CORSConfig{AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"}}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"https://other.example.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"http://a.example.org", false},
+		{"https://a.example.org.evil.com", false},
+	}
+	for _, tt := range tests {
+		if got := cfg.AllowsOrigin(tt.origin); got != tt.want {
+			t.Errorf("AllowsOrigin(%q) = %t, want %t", tt.origin, got, tt.want)
+		}
+	}
+
+	anyOrigin := CORSConfig{AllowedOrigins: []string{"*"}}
+	if !anyOrigin.AllowsOrigin("https://anywhere.test") {
+		t.Error(`"*" does not allow every origin`)
+	}
+	if anyOrigin.ListsOrigin("https://anywhere.test") {
+		t.Error(`ListsOrigin trusts "*"`)
+	}
+	if !cfg.ListsOrigin("https://a.example.org") {
+		t.Error("ListsOrigin ignores wildcard subdomain entries")
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	handler, rejected := newCORSHandler(CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "X-User-ID"},
+		MaxAge:         600,
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, preflight("https://app.example.com", "DELETE", "content-type, x-user-id"))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want 204", w.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST, DELETE",
+		"Access-Control-Allow-Headers": "Content-Type, X-User-ID",
+		"Access-Control-Max-Age":       "600",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		reason  string
+	}{
+		{"origin", preflight("https://evil.test", "POST", ""), "origin"},
+		{"method", preflight("https://app.example.com", "PUT", ""), "method"},
+		{"headers", preflight("https://app.example.com", "POST", "X-Tenant-ID"), "headers"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, tt.request)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", tt.name, w.Code)
+		}
+		if got := testutil.ToFloat64(rejected.WithLabelValues(tt.reason)); got != 1 {
+			t.Errorf("%s: rejections counted = %v, want 1", tt.name, got)
+		}
+	}
+}
+
+func TestCORSSimpleRequests(t *testing.T) {
+	handler, _ := newCORSHandler(CORSConfig{
+		AllowedOrigins: []string{"*"},
+		ExposedHeaders: []string{"X-Generation-ID"},
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/chat", nil)
+	r.Header.Set("Origin", "https://anywhere.test")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Generation-ID" {
+		t.Fatalf("Access-Control-Expose-Headers = %q", got)
+	}
+
+	// Credentials are only allowed for listed origins, never through the wildcard
+	handler, _ = newCORSHandler(CORSConfig{
+		AllowedOrigins:   []string{"*", "https://*.example.com"},
+		AllowCredentials: true,
+	})
+	tests := []struct {
+		origin      string
+		allowOrigin string
+		credentials string
+	}{
+		{"https://anywhere.test", "*", ""},
+		{"https://app.example.com", "https://app.example.com", "true"},
+	}
+	for _, tt := range tests {
+		r.Header.Set("Origin", tt.origin)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+			t.Fatalf("%s: Access-Control-Allow-Origin with credentials = %q, want %q", tt.origin, got, tt.allowOrigin)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+			t.Fatalf("%s: Access-Control-Allow-Credentials = %q, want %q", tt.origin, got, tt.credentials)
+		}
+	}
+
+	// Disallowed origins are served without CORS headers, and the browser blocks the response
+	handler, _ = newCORSHandler(CORSConfig{AllowedOrigins: []string{"https://app.example.com"}})
+	r.Header.Set("Origin", "https://evil.test")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("disallowed origin: status %d, Access-Control-Allow-Origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
@@ -3,18 +3,24 @@ package middleware
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-// MetricsMiddleware adds Prometheus metrics to HTTP requests
+// MetricsMiddleware adds Prometheus metrics to HTTP requests. Connection
+// upgrades are only counted: they last as long as the connection, so they
+// would skew request latency and the active requests gauge.
 func MetricsMiddleware(requestCounter *prometheus.CounterVec, requestDuration *prometheus.HistogramVec, activeRequests prometheus.Gauge) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			activeRequests.Inc()
-			defer activeRequests.Dec()
+			upgrade := isUpgrade(r)
+			if !upgrade {
+				activeRequests.Inc()
+				defer activeRequests.Dec()
+			}
 
 			// Wrap the response writer to capture status code
 			rww := &responseWriterWrapper{w: w, statusCode: http.StatusOK}
@@ -23,9 +29,24 @@ func MetricsMiddleware(requestCounter *prometheus.CounterVec, requestDuration *p
 			next.ServeHTTP(rww, r)
 
 			// Record metrics
-			duration := time.Since(start).Seconds()
-			requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+			if !upgrade {
+				duration := time.Since(start).Seconds()
+				requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+			}
 			requestCounter.WithLabelValues(r.Method, r.URL.Path, strconv.Itoa(rww.statusCode)).Inc()
 		})
 	}
 }
+
+// isUpgrade reports whether the request asks to switch protocols, such as to
+// a WebSocket
+func isUpgrade(r *http.Request) bool {
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return r.Header.Get("Upgrade") != ""
+			}
+		}
+	}
+	return false
+}
@@ -1,6 +1,10 @@
 package middleware
 
-import "net/http"
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
 
 // responseWriterWrapper wraps an http.ResponseWriter to capture the status code
 type responseWriterWrapper struct {
@@ -30,3 +34,18 @@ func (rww *responseWriterWrapper) Flush() {
 		f.Flush()
 	}
 }
+
+// Hijack implements the http.Hijacker interface so connections can be
+// upgraded, such as to WebSockets
+func (rww *responseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rww.w).Hijack()
+	if err == nil {
+		rww.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped response writer for http.ResponseController
+func (rww *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return rww.w
+}
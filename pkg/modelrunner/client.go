@@ -0,0 +1,191 @@
+// Package modelrunner is a client for the Docker Model Runner management API,
+// which lists, pulls, inspects and deletes the models the runner serves.
+package modelrunner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrNotFound is returned for a model the runner does not have, or cannot
+// find in the registry when pulling
+var ErrNotFound = errors.New("model not found")
+
+// Model is a model stored by the runner
+type Model struct {
+	ID      string   `json:"id"`
+	Tags    []string `json:"tags"`
+	Created int64    `json:"created"`
+	Config  Config   `json:"config"`
+}
+
+// Config describes the model file
+type Config struct {
+	Format       string `json:"format,omitempty"`
+	Quantization string `json:"quantization,omitempty"`
+	Parameters   string `json:"parameters,omitempty"`
+	Architecture string `json:"architecture,omitempty"`
+	Size         string `json:"size,omitempty"`
+}
+
+// Progress is an update streamed while a model is pulled
+type Progress struct {
+	Type    string `json:"type"` // "progress", "success" or "error"
+	Message string `json:"message"`
+	Total   uint64 `json:"total,omitempty"`  // Bytes to download
+	Pulled  uint64 `json:"pulled,omitempty"` // Bytes downloaded so far
+}
+
+// Progress types
+const (
+	ProgressUpdate  = "progress"
+	ProgressSuccess = "success"
+	ProgressError   = "error"
+)
+
+// Client calls the management API of a Model Runner
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// New creates a client for the runner at baseURL, such as
+// http://model-runner.docker.internal. A nil httpClient uses the default one.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+}
+
+// BaseURL returns the runner root of an OpenAI-compatible base URL served by
+// the runner, such as http://model-runner.docker.internal/engines/llama.cpp/v1/
+func BaseURL(openAIBaseURL string) (string, bool) {
+	root, _, found := strings.Cut(openAIBaseURL, "/engines/")
+	return root, found
+}
+
+// List returns the models stored by the runner
+func (c *Client) List(ctx context.Context) ([]Model, error) {
+	var models []Model
+	if err := c.do(ctx, http.MethodGet, "/models", nil, &models); err != nil {
+		return nil, fmt.Errorf("list models: %w", err)
+	}
+	return models, nil
+}
+
+// Inspect returns a model by tag, such as ai/smollm2 or ai/smollm2:360M-Q4_K_M
+func (c *Client) Inspect(ctx context.Context, name string) (Model, error) {
+	var model Model
+	if err := c.do(ctx, http.MethodGet, modelPath(name), nil, &model); err != nil {
+		return Model{}, fmt.Errorf("inspect model %s: %w", name, err)
+	}
+	return model, nil
+}
+
+// Delete removes a model from the runner
+func (c *Client) Delete(ctx context.Context, name string) error {
+	if err := c.do(ctx, http.MethodDelete, modelPath(name), nil, nil); err != nil {
+		return fmt.Errorf("delete model %s: %w", name, err)
+	}
+	return nil
+}
+
+// Pull downloads a model from the registry, calling progress with every
+// update the runner streams. It returns once the pull has finished.
+func (c *Client) Pull(ctx context.Context, name string, progress func(Progress)) error {
+	body, _ := json.Marshal(map[string]string{"from": name})
+	resp, err := c.send(ctx, http.MethodPost, "/models/create", body)
+	if err != nil {
+		return fmt.Errorf("pull model %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	// Updates are JSON lines; older runners send plain text lines
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var update Progress
+		if err := json.Unmarshal(line, &update); err != nil || update.Type == "" {
+			update = Progress{Type: ProgressUpdate, Message: string(line)}
+		}
+		if update.Type == ProgressError {
+			return fmt.Errorf("pull model %s: %s", name, update.Message)
+		}
+		if progress != nil {
+			progress(update)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("pull model %s: %w", name, err)
+	}
+	return nil
+}
+
+// do sends a request and decodes the JSON response into out, unless it is nil
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// send sends a request and turns error statuses into errors
+func (c *Client) send(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, bytes.TrimSpace(message))
+	}
+	return nil, fmt.Errorf("model runner returned %s: %s", resp.Status, bytes.TrimSpace(message))
+}
+
+// modelPath escapes each segment of a model name, keeping the namespace
+// separator
+func modelPath(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/models/" + strings.Join(segments, "/")
+}
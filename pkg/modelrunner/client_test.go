@@ -0,0 +1,191 @@
+package modelrunner_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/modelrunner"
+	"github.com/ajeetraina/genai-app-demo/pkg/modelrunner/modelrunnertest"
+)
+
+func setup(t *testing.T, models ...string) (*modelrunner.Client, *modelrunnertest.Server, context.Context) {
+	t.Helper()
+	fake := modelrunnertest.NewServer(models...)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return modelrunner.New(server.URL, nil), fake, ctx
+}
+
+func TestBaseURL(t *testing.T) {
+	root, ok := modelrunner.BaseURL("http://model-runner.docker.internal/engines/llama.cpp/v1/")
+	if !ok || root != "http://model-runner.docker.internal" {
+		t.Fatalf("BaseURL = %q, %t", root, ok)
+	}
+	if _, ok := modelrunner.BaseURL("http://localhost:11434/v1/"); ok {
+		t.Fatal("BaseURL accepted a URL not served by Model Runner")
+	}
+}
+
+func TestClient(t *testing.T) {
+	client, fake, ctx := setup(t, "ai/llama3.2:1B-Q8_0")
+
+	models, err := client.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 1 || models[0].Tags[0] != "ai/llama3.2:1B-Q8_0" {
+		t.Fatalf("List = %+v", models)
+	}
+
+	var updates []modelrunner.Progress
+	if err := client.Pull(ctx, "ai/smollm2", func(p modelrunner.Progress) {
+		updates = append(updates, p)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) < 2 || updates[0].Type != modelrunner.ProgressUpdate || updates[0].Total == 0 {
+		t.Fatalf("progress updates = %+v", updates)
+	}
+	if last := updates[len(updates)-1]; last.Type != modelrunner.ProgressSuccess {
+		t.Fatalf("last update = %+v, want success", last)
+	}
+	if !fake.Has("ai/smollm2") {
+		t.Fatal("pulled model is not stored")
+	}
+
+	model, err := client.Inspect(ctx, "ai/smollm2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Tags[0] != "ai/smollm2:latest" || model.Config.Format != "gguf" {
+		t.Fatalf("Inspect = %+v", model)
+	}
+
+	if err := client.Delete(ctx, "ai/smollm2"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Has("ai/smollm2") {
+		t.Fatal("deleted model is still stored")
+	}
+}
+
+func TestClientNotFound(t *testing.T) {
+	client, _, ctx := setup(t)
+
+	if _, err := client.Inspect(ctx, "ai/unknown"); !errors.Is(err, modelrunner.ErrNotFound) {
+		t.Fatalf("Inspect error = %v, want ErrNotFound", err)
+	}
+	if err := client.Delete(ctx, "ai/unknown"); !errors.Is(err, modelrunner.ErrNotFound) {
+		t.Fatalf("Delete error = %v, want ErrNotFound", err)
+	}
+	if err := client.Pull(ctx, "missing/model", nil); !errors.Is(err, modelrunner.ErrNotFound) {
+		t.Fatalf("Pull error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPullErrorLine(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"type":"progress","message":"Downloaded: 1 MB"}` + "\n"))
+		w.Write([]byte(`{"type":"error","message":"disk full"}` + "\n"))
+	}))
+	defer server.Close()
+
+	var updates int
+	err := modelrunner.New(server.URL, nil).Pull(context.Background(), "ai/smollm2", func(modelrunner.Progress) { updates++ })
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Pull error = %v, want the streamed error", err)
+	}
+	if updates != 1 {
+		t.Fatalf("progress updates = %d, want 1", updates)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	client, _, _ := setup(t)
+	mux := http.NewServeMux()
+	modelrunner.NewHandler(client).Register(mux)
+	app := httptest.NewServer(mux)
+	defer app.Close()
+
+	resp, err := http.Post(app.URL+"/admin/models", "application/json", strings.NewReader(`{"model":"ai/smollm2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var last modelrunner.Progress
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if last.Type != modelrunner.ProgressSuccess {
+		t.Fatalf("last line = %+v, want success", last)
+	}
+
+	resp, err = http.Get(app.URL + "/admin/models/ai/smollm2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("inspect status = %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(app.URL+"/admin/models", "application/json", strings.NewReader(`{"model":"missing/model"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("pull of a missing model status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestHandlerPullOutlastsWriteTimeout(t *testing.T) {
+	runner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			w.Write([]byte(`{"type":"progress","message":"Downloaded: 1 MB"}` + "\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Write([]byte(`{"type":"success","message":"Model pulled"}` + "\n"))
+	}))
+	defer runner.Close()
+
+	mux := http.NewServeMux()
+	modelrunner.NewHandler(modelrunner.New(runner.URL, nil)).Register(mux)
+	app := httptest.NewUnstartedServer(mux)
+	app.Config.WriteTimeout = 150 * time.Millisecond
+	app.Start()
+	defer app.Close()
+
+	resp, err := http.Post(app.URL+"/admin/models", "application/json", strings.NewReader(`{"model":"ai/smollm2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var last modelrunner.Progress
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if last.Type != modelrunner.ProgressSuccess {
+		t.Fatalf("last line = %+v, want success after the write timeout", last)
+	}
+}
@@ -0,0 +1,124 @@
+package modelrunner
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/identity"
+	"github.com/rs/zerolog/log"
+)
+
+// Handler lets operators manage the runner's models
+type Handler struct {
+	client *Client
+}
+
+// NewHandler creates an HTTP handler for the client
+func NewHandler(client *Client) *Handler {
+	return &Handler{client: client}
+}
+
+// Register adds the model management routes to the mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/models", h.handleList)
+	mux.HandleFunc("POST /admin/models", h.handlePull)
+	mux.HandleFunc("GET /admin/models/{name...}", h.handleInspect)
+	mux.HandleFunc("DELETE /admin/models/{name...}", h.handleDelete)
+}
+
+// handleList lists the models stored by the runner
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	models, err := h.client.List(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"models": models})
+}
+
+// handlePull pulls {"model": "ai/smollm2"} and streams the progress as JSON
+// lines. A failure after the stream has started is sent as an error line.
+func (h *Handler) handlePull(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model == "" {
+		http.Error(w, `Request body must name a "model"`, http.StatusBadRequest)
+		return
+	}
+
+	// Pulls of large models outlast the server's write timeout; the pull
+	// still stops when the client goes away
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Warn().Err(err).Msg("Failed to clear the write deadline of a model pull")
+	}
+
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	started := false
+	err := h.client.Pull(r.Context(), req.Model, func(p Progress) {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		encoder.Encode(p)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+
+	logEvent := log.Info()
+	if err != nil {
+		logEvent = log.Error().Err(err)
+	}
+	logEvent.Str("model", req.Model).Str("user", identity.UserID(r)).Msg("Model pull finished")
+
+	switch {
+	case err != nil && !started:
+		writeError(w, err)
+	case err != nil:
+		encoder.Encode(Progress{Type: ProgressError, Message: err.Error()})
+	case !started:
+		writeJSON(w, http.StatusOK, Progress{Type: ProgressSuccess, Message: "Model pulled"})
+	}
+}
+
+// handleInspect returns a model
+func (h *Handler) handleInspect(w http.ResponseWriter, r *http.Request) {
+	model, err := h.client.Inspect(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, model)
+}
+
+// handleDelete removes a model
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := h.client.Delete(r.Context(), name); err != nil {
+		writeError(w, err)
+		return
+	}
+	log.Info().Str("model", name).Str("user", identity.UserID(r)).Msg("Model deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeError reports a runner failure: unknown models are a 404, anything
+// else a 502
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,171 @@
+// Package modelrunnertest is a fake Docker Model Runner for tests and local
+// development. It serves the model management API and the OpenAI-compatible
+// model list from memory.
+package modelrunnertest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/modelrunner"
+)
+
+// Server stores models in memory. Any model can be pulled, except those in
+// the "missing" namespace, which the registry does not have.
+type Server struct {
+	mu     sync.Mutex
+	models map[string]modelrunner.Model // By tag
+	mux    *http.ServeMux
+}
+
+// NewServer creates a fake runner that already has the given models
+func NewServer(models ...string) *Server {
+	s := &Server{models: make(map[string]modelrunner.Model)}
+	for _, name := range models {
+		s.add(name)
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /models", s.handleList)
+	s.mux.HandleFunc("POST /models/create", s.handleCreate)
+	s.mux.HandleFunc("GET /models/{name...}", s.handleInspect)
+	s.mux.HandleFunc("DELETE /models/{name...}", s.handleDelete)
+	s.mux.HandleFunc("GET /engines/llama.cpp/v1/models", s.handleOpenAIList)
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Has reports whether the runner stores a model
+func (s *Server) Has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.models[tag(name)]
+	return ok
+}
+
+func (s *Server) add(name string) modelrunner.Model {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sum := sha256.Sum256([]byte(tag(name)))
+	model := modelrunner.Model{
+		ID:      "sha256:" + hex.EncodeToString(sum[:]),
+		Tags:    []string{tag(name)},
+		Created: time.Now().Unix(),
+		Config: modelrunner.Config{
+			Format:       "gguf",
+			Quantization: "Q4_K_M",
+			Parameters:   "1.24 B",
+			Architecture: "llama",
+			Size:         "770.28 MiB",
+		},
+	}
+	s.models[tag(name)] = model
+	return model
+}
+
+func (s *Server) list() []modelrunner.Model {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	models := make([]modelrunner.Model, 0, len(s.models))
+	for _, model := range s.models {
+		models = append(models, model)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Tags[0] < models[j].Tags[0] })
+	return models
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.list())
+}
+
+// handleCreate pulls a model, streaming a few progress lines before success
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From string `json:"from"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if strings.HasPrefix(req.From, "missing/") {
+		http.Error(w, "model not found in registry", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	const total = 3 << 20
+	for pulled := uint64(1 << 20); pulled <= total; pulled += 1 << 20 {
+		encoder.Encode(modelrunner.Progress{
+			Type:    modelrunner.ProgressUpdate,
+			Message: fmt.Sprintf("Downloaded: %d MB", pulled>>20),
+			Total:   total,
+			Pulled:  pulled,
+		})
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	s.add(req.From)
+	encoder.Encode(modelrunner.Progress{Type: modelrunner.ProgressSuccess, Message: "Model pulled successfully"})
+}
+
+func (s *Server) handleInspect(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	model, ok := s.models[tag(r.PathValue("name"))]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "model not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, model)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := tag(r.PathValue("name"))
+	if _, ok := s.models[name]; !ok {
+		http.Error(w, "model not found", http.StatusNotFound)
+		return
+	}
+	delete(s.models, name)
+}
+
+// handleOpenAIList is the list the chat endpoints see
+func (s *Server) handleOpenAIList(w http.ResponseWriter, r *http.Request) {
+	type entry struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+	}
+	data := []entry{}
+	for _, model := range s.list() {
+		data = append(data, entry{ID: model.Tags[0], Object: "model", Created: model.Created})
+	}
+	writeJSON(w, map[string]interface{}{"object": "list", "data": data})
+}
+
+// tag adds the default tag to a model name without one
+func tag(name string) string {
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		return name
+	}
+	return name + ":latest"
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
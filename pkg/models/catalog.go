@@ -0,0 +1,245 @@
+// Package models is the allowlist of models chat requests may select. Each
+// model can have aliases and default generation parameters, and tenants can
+// be limited to some of the models.
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Errors returned when resolving a requested model
+var (
+	ErrUnknownModel = errors.New("unknown model")
+	ErrNotPermitted = errors.New("model not permitted")
+)
+
+// Defaults are generation parameters applied to every request for a model
+type Defaults struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   int64    `json:"max_tokens,omitempty"`
+}
+
+// Model is an allowlisted model
+type Model struct {
+	Name     string   `json:"name"` // Name sent to the inference server
+	Aliases  []string `json:"aliases,omitempty"`
+	Defaults Defaults `json:"defaults"`
+	Default  bool     `json:"default,omitempty"` // Used when a request names no model
+}
+
+// Config is the model allowlist file
+//
+//	{
+//	  "default": "fast",
+//	  "models": {
+//	    "ai/llama3.2:1B-Q8_0": {"aliases": ["fast"], "defaults": {"temperature": 0.7}},
+//	    "ai/qwen2.5:7B-Q4_K_M": {"aliases": ["smart"], "defaults": {"max_tokens": 2048}}
+//	  },
+//	  "tenants": {"free": ["fast"], "*": ["*"]}
+//	}
+//
+// Tenants map to the models (names or aliases) they may use; "*" as a model
+// allows every model, and the "*" tenant applies to tenants not listed. With
+// no tenants section every tenant may use every model.
+type Config struct {
+	Default string                 `json:"default"`
+	Models  map[string]modelConfig `json:"models"`
+	Tenants map[string][]string    `json:"tenants"`
+}
+
+type modelConfig struct {
+	Aliases  []string `json:"aliases"`
+	Defaults Defaults `json:"defaults"`
+}
+
+// Catalog resolves requested models against the allowlist
+type Catalog struct {
+	mu       sync.RWMutex
+	models   map[string]*Model // By name
+	names    map[string]string // Name or alias to name
+	tenants  map[string]map[string]bool
+	def      *Model
+	implicit bool // No allowlist file: the allowlist is whatever the default has been
+}
+
+// LoadCatalog reads the allowlist file. Without one, the catalog only holds
+// the fallback model. The fallback is also the default when the file names
+// none.
+func LoadCatalog(file, fallback string) (*Catalog, error) {
+	var cfg Config
+	data, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid model config %s: %w", file, err)
+		}
+	}
+	if len(cfg.Models) == 0 && fallback != "" {
+		cfg.Models = map[string]modelConfig{fallback: {}}
+	}
+	if cfg.Default == "" {
+		cfg.Default = fallback
+	}
+	c, err := NewCatalog(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.implicit = data == nil
+	return c, nil
+}
+
+// NewCatalog builds a catalog from a config
+func NewCatalog(cfg Config) (*Catalog, error) {
+	c := &Catalog{
+		models:  make(map[string]*Model, len(cfg.Models)),
+		names:   make(map[string]string),
+		tenants: make(map[string]map[string]bool, len(cfg.Tenants)),
+	}
+
+	for name, mc := range cfg.Models {
+		c.models[name] = &Model{Name: name, Aliases: mc.Aliases, Defaults: mc.Defaults}
+		c.names[name] = name
+	}
+	for name, mc := range cfg.Models {
+		for _, alias := range mc.Aliases {
+			if other, taken := c.names[alias]; taken && other != name {
+				return nil, fmt.Errorf("model alias %q is used by both %s and %s", alias, other, name)
+			}
+			c.names[alias] = name
+		}
+	}
+
+	if cfg.Default != "" {
+		name, ok := c.names[cfg.Default]
+		if !ok {
+			return nil, fmt.Errorf("%w: default %q is not in the model list", ErrUnknownModel, cfg.Default)
+		}
+		c.def = c.models[name]
+		c.def.Default = true
+	}
+
+	for tenant, allowed := range cfg.Tenants {
+		set := make(map[string]bool, len(allowed))
+		for _, model := range allowed {
+			if model == "*" {
+				set["*"] = true
+				continue
+			}
+			name, ok := c.names[model]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q allowed for tenant %q is not in the model list", ErrUnknownModel, model, tenant)
+			}
+			set[name] = true
+		}
+		c.tenants[tenant] = set
+	}
+	return c, nil
+}
+
+// Resolve returns the model a tenant asked for by name or alias, or the
+// default model when requested is empty
+func (c *Catalog) Resolve(requested, tenant string) (Model, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	model := c.def
+	if requested != "" {
+		name, ok := c.names[requested]
+		if !ok {
+			return Model{}, fmt.Errorf("%w: %s", ErrUnknownModel, requested)
+		}
+		model = c.models[name]
+	}
+	if model == nil {
+		return Model{}, fmt.Errorf("%w: no model requested and no default configured", ErrUnknownModel)
+	}
+	if !c.permitted(model.Name, tenant) {
+		return Model{}, fmt.Errorf("%w: %s", ErrNotPermitted, model.Name)
+	}
+	return *model, nil
+}
+
+// Lookup resolves a name or alias without checking permissions
+func (c *Catalog) Lookup(requested string) (Model, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	name, ok := c.names[requested]
+	if !ok {
+		return Model{}, false
+	}
+	return *c.models[name], true
+}
+
+// Default returns the model used when a request names none
+func (c *Catalog) Default() (Model, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.def == nil {
+		return Model{}, false
+	}
+	return *c.def, true
+}
+
+// SetDefault changes the model used when a request names none. It must be
+// allowlisted, unless the catalog was loaded without an allowlist file, in
+// which case the model is added to it.
+func (c *Catalog) SetDefault(requested string) (Model, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name, ok := c.names[requested]
+	if !ok {
+		if !c.implicit || requested == "" {
+			return Model{}, fmt.Errorf("%w: %s", ErrUnknownModel, requested)
+		}
+		name = requested
+		c.models[name] = &Model{Name: name}
+		c.names[name] = name
+	}
+	if c.def != nil {
+		c.def.Default = false
+	}
+	c.def = c.models[name]
+	c.def.Default = true
+	return *c.def, nil
+}
+
+// Permitted reports whether a tenant may use a model
+func (c *Catalog) Permitted(name, tenant string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.permitted(name, tenant)
+}
+
+func (c *Catalog) permitted(name, tenant string) bool {
+	if len(c.tenants) == 0 {
+		return true
+	}
+	allowed, ok := c.tenants[tenant]
+	if !ok {
+		allowed = c.tenants["*"]
+	}
+	return allowed["*"] || allowed[name]
+}
+
+// List returns the models a tenant may use, sorted by name
+func (c *Catalog) List(tenant string) []Model {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	list := make([]Model, 0, len(c.models))
+	for name, model := range c.models {
+		if c.permitted(name, tenant) {
+			list = append(list, *model)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const catalogConfig = `{
+  "default": "fast",
+  "models": {
+    "ai/llama3.2:1B-Q8_0": {"aliases": ["fast"], "defaults": {"temperature": 0.7}},
+    "ai/qwen2.5:7B-Q4_K_M": {"aliases": ["smart"], "defaults": {"max_tokens": 2048}}
+  },
+  "tenants": {"free": ["fast"], "*": ["*"]}
+}`
+
+func loadCatalog(t *testing.T, config string) *Catalog {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "models.json")
+	if err := os.WriteFile(file, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadCatalog(file, "ai/smollm2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCatalogResolve(t *testing.T) {
+	c := loadCatalog(t, catalogConfig)
+	tests := []struct {
+		requested, tenant string
+		want              string
+		err               error
+	}{
+		{"", "acme", "ai/llama3.2:1B-Q8_0", nil},
+		{"smart", "acme", "ai/qwen2.5:7B-Q4_K_M", nil},
+		{"ai/qwen2.5:7B-Q4_K_M", "", "ai/qwen2.5:7B-Q4_K_M", nil},
+		{"fast", "free", "ai/llama3.2:1B-Q8_0", nil},
+		{"smart", "free", "", ErrNotPermitted},
+		{"ai/smollm2", "acme", "", ErrUnknownModel},
+	}
+	for _, tt := range tests {
+		model, err := c.Resolve(tt.requested, tt.tenant)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Resolve(%q, %q): err = %v, want %v", tt.requested, tt.tenant, err, tt.err)
+			continue
+		}
+		if model.Name != tt.want {
+			t.Errorf("Resolve(%q, %q) = %s, want %s", tt.requested, tt.tenant, model.Name, tt.want)
+		}
+	}
+
+	model, _ := c.Resolve("fast", "acme")
+	if !model.Default || model.Defaults.Temperature == nil || *model.Defaults.Temperature != 0.7 {
+		t.Fatalf("fast model = %+v, want the default with its temperature", model)
+	}
+
+	free := c.List("free")
+	if len(free) != 1 || free[0].Name != "ai/llama3.2:1B-Q8_0" {
+		t.Fatalf("List(free) = %+v, want only the fast model", free)
+	}
+	if len(c.List("acme")) != 2 {
+		t.Fatalf("List(acme) = %+v, want both models", c.List("acme"))
+	}
+}
+
+func TestCatalogUnlistedTenants(t *testing.T) {
+	c := loadCatalog(t, `{"default": "a", "models": {"a": {}, "b": {}}, "tenants": {"team": ["a"]}}`)
+	// Unlisted tenants get nothing when there is no "*" tenant
+	if c.Permitted("a", "other") {
+		t.Error("unlisted tenant may use a")
+	}
+	if !c.Permitted("a", "team") || c.Permitted("b", "team") {
+		t.Error("team may not use exactly a")
+	}
+	if _, err := c.Resolve("", "other"); !errors.Is(err, ErrNotPermitted) {
+		t.Fatalf("Resolve the default for an unlisted tenant: err = %v, want ErrNotPermitted", err)
+	}
+}
+
+func TestLoadCatalogErrors(t *testing.T) {
+	tests := map[string]string{
+		"invalid json":    `{"models":`,
+		"shared alias":    `{"models": {"a": {"aliases": ["x"]}, "b": {"aliases": ["x"]}}}`,
+		"unknown default": `{"default": "c", "models": {"a": {}}}`,
+		"unknown tenant":  `{"default": "a", "models": {"a": {}}, "tenants": {"free": ["c"]}}`,
+		// Without a default the fallback is used, and it must be listed too
+		"unlisted fallback": `{"models": {"a": {}}}`,
+	}
+	for name, config := range tests {
+		file := filepath.Join(t.TempDir(), "models.json")
+		if err := os.WriteFile(file, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadCatalog(file, "ai/smollm2"); err == nil {
+			t.Errorf("%s: LoadCatalog succeeded, want an error", name)
+		}
+	}
+}
+
+func TestCatalogSetDefault(t *testing.T) {
+	// Without an allowlist file any model can become the default
+	c, err := LoadCatalog(filepath.Join(t.TempDir(), "missing.json"), "ai/smollm2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model, ok := c.Default(); !ok || model.Name != "ai/smollm2" {
+		t.Fatalf("Default = %+v, want the fallback", model)
+	}
+	if _, err := c.SetDefault("ai/gemma3"); err != nil {
+		t.Fatal(err)
+	}
+	model, err := c.Resolve("", "")
+	if err != nil || model.Name != "ai/gemma3" {
+		t.Fatalf("Resolve after SetDefault = %+v, %v", model, err)
+	}
+	if old, _ := c.Lookup("ai/smollm2"); old.Default {
+		t.Fatal("the previous default is still marked default")
+	}
+
+	// With one, the default must be allowlisted
+	c = loadCatalog(t, catalogConfig)
+	if _, err := c.SetDefault("ai/gemma3"); !errors.Is(err, ErrUnknownModel) {
+		t.Fatalf("SetDefault to an unlisted model: err = %v, want ErrUnknownModel", err)
+	}
+	if model, err := c.SetDefault("smart"); err != nil || model.Name != "ai/qwen2.5:7B-Q4_K_M" {
+		t.Fatalf("SetDefault(smart) = %+v, %v", model, err)
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/identity"
+)
+
+// Handler lists the models available to the caller
+type Handler struct {
+	catalog *Catalog
+}
+
+// NewHandler creates an HTTP handler for the catalog
+func NewHandler(catalog *Catalog) *Handler {
+	return &Handler{catalog: catalog}
+}
+
+// Register adds the model routes to the mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /models", h.handleList)
+}
+
+// handleList returns the models the caller's tenant may select
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"models": h.catalog.List(identity.TenantID(r))})
+}
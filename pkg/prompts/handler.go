@@ -0,0 +1,43 @@
+package prompts
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler serves the prompt template library
+type Handler struct {
+	library *Library
+}
+
+// NewHandler creates an HTTP handler for the library
+func NewHandler(library *Library) *Handler {
+	return &Handler{library: library}
+}
+
+// Register adds the prompt template routes to the mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /prompts", h.handleList)
+	mux.HandleFunc("GET /prompts/{id}", h.handleGet)
+}
+
+// handleList lists the templates and their versions
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"templates": h.library.List()})
+}
+
+// handleGet returns every version of a template with its variables and source
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	versions := h.library.Versions(r.PathValue("id"))
+	if len(versions) == 0 {
+		http.Error(w, "Prompt template not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"versions": versions})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,146 @@
+package prompts
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Extension of template files. A library directory holds one directory per
+// template, with one file per version: <id>/<version>.tmpl
+const Extension = ".tmpl"
+
+// builtin are the templates available without a library directory
+var builtin = map[string]string{
+	"markdown/1": "{\"description\": \"Ask for markdown formatting\"}\n---\n" +
+		"Please format your response using markdown. Use proper headings, bullet points, numbered lists, code blocks with syntax highlighting, and tables where appropriate.",
+}
+
+// Library holds every version of every template
+type Library struct {
+	templates map[string][]*Template // Sorted by version
+}
+
+// Summary describes a template and its versions
+type Summary struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	Latest      int    `json:"latest"`
+	Versions    []int  `json:"versions"`
+}
+
+// Load reads the built-in templates and those in dir. A file in dir replaces
+// a built-in template with the same ID and version, but two files in dir,
+// such as 2.tmpl and v2.tmpl, may not name the same version. A missing
+// directory only provides the built-ins.
+func Load(dir string) (*Library, error) {
+	l := &Library{templates: make(map[string][]*Template)}
+	files := make(map[templateKey][]byte, len(builtin))
+	for name, source := range builtin {
+		key, err := parseName(name)
+		if err != nil {
+			return nil, err
+		}
+		files[key] = []byte(source)
+	}
+
+	fromDir := make(map[templateKey]string)
+	err := fs.WalkDir(os.DirFS(dir), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(name) != Extension {
+			return nil
+		}
+		key, err := parseName(strings.TrimSuffix(name, Extension))
+		if err != nil {
+			return err
+		}
+		if other, ok := fromDir[key]; ok {
+			return fmt.Errorf("prompt template %s: version %d of %s is also defined by %s", name, key.version, key.id, other)
+		}
+		data, err := fs.ReadFile(os.DirFS(dir), name)
+		if err != nil {
+			return err
+		}
+		fromDir[key] = name
+		files[key] = data
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	for key, data := range files {
+		t, err := Parse(key.id, key.version, data)
+		if err != nil {
+			return nil, err
+		}
+		l.templates[key.id] = append(l.templates[key.id], t)
+	}
+	for _, versions := range l.templates {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	}
+	return l, nil
+}
+
+// templateKey identifies a version of a template
+type templateKey struct {
+	id      string
+	version int
+}
+
+// parseName reads the ID and version from a file name without its extension,
+// such as "summarize/2" or "summarize/v2"
+func parseName(name string) (templateKey, error) {
+	id, versionText := path.Split(name)
+	id = strings.TrimSuffix(id, "/")
+	version, err := strconv.Atoi(strings.TrimPrefix(versionText, "v"))
+	if id == "" || strings.Contains(id, "/") || err != nil || version < 1 {
+		return templateKey{}, fmt.Errorf("prompt template %s%s: expected <id>/<version>%s with a positive version", name, Extension, Extension)
+	}
+	return templateKey{id: id, version: version}, nil
+}
+
+// Get returns a version of a template, or its latest version when version is 0
+func (l *Library) Get(id string, version int) (*Template, error) {
+	versions := l.templates[id]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, t := range versions {
+		if t.Version == version {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s version %d", ErrNotFound, id, version)
+}
+
+// Versions returns every version of a template, oldest first
+func (l *Library) Versions(id string) []*Template {
+	return l.templates[id]
+}
+
+// List summarizes the templates, sorted by ID. The description is the
+// latest version's.
+func (l *Library) List() []Summary {
+	list := make([]Summary, 0, len(l.templates))
+	for id, versions := range l.templates {
+		latest := versions[len(versions)-1]
+		summary := Summary{ID: id, Description: latest.Description, Latest: latest.Version}
+		for _, t := range versions {
+			summary.Versions = append(summary.Versions, t.Version)
+		}
+		list = append(list, summary)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
@@ -0,0 +1,101 @@
+package prompts
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplates creates a library directory from file names and contents
+func writeTemplates(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"support/1.tmpl":  `{"description": "Support agent"}` + "\n---\nYou help customers.",
+		"support/v2.tmpl": `{"description": "Support agent, v2"}` + "\n---\nYou help customers politely.",
+		"markdown/1.tmpl": "Use markdown.",
+		"README.md":       "Not a template",
+	})
+	library, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := library.Get("support", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Version != 2 {
+		t.Fatalf("latest version = %d, want 2", latest.Version)
+	}
+	first, err := library.Get("support", 1)
+	if err != nil || first.Source != "You help customers." {
+		t.Fatalf("Get(support, 1) = %+v, %v", first, err)
+	}
+	if _, err := library.Get("support", 3); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(support, 3): err = %v, want ErrNotFound", err)
+	}
+	if _, err := library.Get("missing", 0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(missing, 0): err = %v, want ErrNotFound", err)
+	}
+
+	// The directory replaces the built-in markdown template
+	markdown, _ := library.Get("markdown", 1)
+	if markdown.Source != "Use markdown." {
+		t.Fatalf("markdown template = %q, want the one from the directory", markdown.Source)
+	}
+
+	list := library.List()
+	if len(list) != 2 || list[0].ID != "markdown" || list[1].ID != "support" {
+		t.Fatalf("List = %+v, want markdown and support", list)
+	}
+	if s := list[1]; s.Latest != 2 || s.Description != "Support agent, v2" || len(s.Versions) != 2 || s.Versions[0] != 1 {
+		t.Fatalf("support summary = %+v", s)
+	}
+}
+
+func TestLoadBuiltins(t *testing.T) {
+	library, err := Load(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := library.Get("markdown", 0); err != nil {
+		t.Fatalf("built-in markdown template: %v", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := map[string]map[string]string{
+		"duplicate version": {"support/2.tmpl": "a", "support/v2.tmpl": "b"},
+		"no version":        {"support/latest.tmpl": "a"},
+		"zero version":      {"support/0.tmpl": "a"},
+		"nested directory":  {"team/support/1.tmpl": "a"},
+		"top level":         {"1.tmpl": "a"},
+		"invalid template":  {"support/1.tmpl": "{{.name"},
+	}
+	for name, files := range tests {
+		_, err := Load(writeTemplates(t, files))
+		if err == nil {
+			t.Errorf("%s: Load succeeded, want an error", name)
+			continue
+		}
+		if name == "duplicate version" && !strings.Contains(err.Error(), "also defined by") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
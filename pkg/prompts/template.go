@@ -0,0 +1,155 @@
+// Package prompts is a library of versioned system prompt templates. Each
+// version is a Go text/template with a header declaring its typed variables;
+// variables passed in a request are validated against those declarations
+// before the template is rendered.
+package prompts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/jsonschema"
+)
+
+// Errors returned when selecting and rendering templates
+var (
+	ErrNotFound         = errors.New("prompt template not found")
+	ErrInvalidVariables = errors.New("invalid template variables")
+)
+
+// Variable declares a template variable
+type Variable struct {
+	Type        string      `json:"type"` // string, integer, number, boolean, array or object
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+}
+
+// Template is one version of a prompt template
+type Template struct {
+	ID          string              `json:"id"`
+	Version     int                 `json:"version"`
+	Description string              `json:"description,omitempty"`
+	Variables   map[string]Variable `json:"variables,omitempty"`
+	Source      string              `json:"source"` // Template text without the header
+
+	tmpl *template.Template
+}
+
+// header is the optional JSON object at the top of a template file,
+// separated from the template text by a line containing only ---
+type header struct {
+	Description string              `json:"description"`
+	Variables   map[string]Variable `json:"variables"`
+}
+
+var variableTypes = map[string]bool{
+	"string": true, "integer": true, "number": true, "boolean": true, "array": true, "object": true,
+}
+
+// Parse reads a template file: an optional JSON header, a --- line, then the
+// template text
+//
+//	{"description": "Support agent", "variables": {"product": {"type": "string", "required": true}}}
+//	---
+//	You help customers with {{.product}}.
+func Parse(id string, version int, data []byte) (*Template, error) {
+	t := &Template{ID: id, Version: version}
+	text := string(data)
+
+	if strings.HasPrefix(strings.TrimSpace(text), "{") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		var h header
+		if err := decoder.Decode(&h); err != nil {
+			return nil, fmt.Errorf("template %s v%d: invalid header: %w", id, version, err)
+		}
+		rest := strings.TrimLeft(text[decoder.InputOffset():], " \t\r\n")
+		if !strings.HasPrefix(rest, "---") {
+			return nil, fmt.Errorf("template %s v%d: header must be followed by a --- line", id, version)
+		}
+		rest = strings.TrimPrefix(rest, "---")
+		if newline := strings.IndexByte(rest, '\n'); newline >= 0 {
+			rest = rest[newline+1:]
+		} else {
+			rest = ""
+		}
+		text = rest
+		t.Description, t.Variables = h.Description, h.Variables
+	}
+
+	for name, v := range t.Variables {
+		if !variableTypes[v.Type] {
+			return nil, fmt.Errorf("template %s v%d: variable %s has unknown type %q", id, version, name, v.Type)
+		}
+		if v.Default != nil {
+			if err := jsonschema.Validate(jsonschema.Schema{"type": v.Type}, v.Default); err != nil {
+				return nil, fmt.Errorf("template %s v%d: default of %s: %v", id, version, name, err)
+			}
+		}
+	}
+
+	tmpl, err := template.New(id).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template %s v%d: %w", id, version, err)
+	}
+	t.Source, t.tmpl = strings.TrimSpace(text), tmpl
+	return t, nil
+}
+
+// Schema returns the JSON Schema of the template's variables
+func (t *Template) Schema() jsonschema.Schema {
+	properties := make(map[string]interface{}, len(t.Variables))
+	var required []interface{}
+	names := make([]string, 0, len(t.Variables))
+	for name := range t.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := t.Variables[name]
+		properties[name] = map[string]interface{}{"type": v.Type}
+		if v.Required {
+			required = append(required, name)
+		}
+	}
+	schema := jsonschema.Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// Render validates the variables, fills in defaults and executes the
+// template. Optional variables without a default are nil, so templates can
+// test them with {{if}}.
+func (t *Template) Render(vars map[string]interface{}) (string, error) {
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	if err := jsonschema.Validate(t.Schema(), vars); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidVariables, err)
+	}
+
+	data := make(map[string]interface{}, len(t.Variables))
+	for name, v := range t.Variables {
+		data[name] = v.Default
+	}
+	for name, value := range vars {
+		data[name] = value
+	}
+
+	var out strings.Builder
+	if err := t.tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("rendering template %s v%d: %w", t.ID, t.Version, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,92 @@
+package prompts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const supportTemplate = `{
+  "description": "Support agent",
+  "variables": {
+    "product": {"type": "string", "required": true},
+    "tone": {"type": "string", "default": "friendly"},
+    "max_steps": {"type": "integer"}
+  }
+}
+---
+You help customers with {{.product}}. Be {{.tone}}.
+{{if .max_steps}}Use at most {{.max_steps}} steps.{{end}}
+`
+
+func TestParse(t *testing.T) {
+	tmpl, err := Parse("support", 2, []byte(supportTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.ID != "support" || tmpl.Version != 2 || tmpl.Description != "Support agent" || len(tmpl.Variables) != 3 {
+		t.Fatalf("Parse = %+v", tmpl)
+	}
+	if !strings.HasPrefix(tmpl.Source, "You help customers") {
+		t.Fatalf("Source = %q, want the text after the header", tmpl.Source)
+	}
+
+	// Templates without a header have no variables
+	plain, err := Parse("plain", 1, []byte("Answer briefly.\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := plain.Render(nil); err != nil || got != "Answer briefly." {
+		t.Fatalf("Render = %q, %v", got, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"invalid header":    `{"variables": ` + "\n---\nHi",
+		"missing separator": `{"description": "x"}` + "\nHi",
+		"unknown type":      `{"variables": {"n": {"type": "float"}}}` + "\n---\nHi",
+		"mistyped default":  `{"variables": {"n": {"type": "integer", "default": "two"}}}` + "\n---\nHi",
+		"invalid template":  "Hello {{.name",
+	}
+	for name, data := range tests {
+		if _, err := Parse("bad", 1, []byte(data)); err == nil {
+			t.Errorf("%s: Parse succeeded, want an error", name)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tmpl, err := Parse("support", 1, []byte(supportTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		vars map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"product": "Docker"}, "You help customers with Docker. Be friendly."},
+		{map[string]interface{}{"product": "Docker", "tone": "formal", "max_steps": 3.0}, "You help customers with Docker. Be formal.\nUse at most 3 steps."},
+	}
+	for _, tt := range tests {
+		got, err := tmpl.Render(tt.vars)
+		if err != nil {
+			t.Fatalf("Render(%v): %v", tt.vars, err)
+		}
+		if got != tt.want {
+			t.Errorf("Render(%v) = %q, want %q", tt.vars, got, tt.want)
+		}
+	}
+
+	for _, vars := range []map[string]interface{}{
+		nil,
+		{"product": 1.0},
+		{"product": "Docker", "max_steps": 2.5},
+		{"product": "Docker", "colour": "blue"},
+	} {
+		if _, err := tmpl.Render(vars); !errors.Is(err, ErrInvalidVariables) {
+			t.Errorf("Render(%v): err = %v, want ErrInvalidVariables", vars, err)
+		}
+	}
+}
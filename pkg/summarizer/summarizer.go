@@ -0,0 +1,286 @@
+package summarizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/conversation"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// Completer generates a single non-streaming completion
+type Completer interface {
+	Complete(ctx context.Context, system, prompt string) (string, error)
+}
+
+// Options configures the background worker pool
+type Options struct {
+	Workers       int           // Concurrent summarization jobs
+	QueueSize     int           // Pending conversations before new requests are dropped
+	RatePerMinute int           // Model calls per minute across all workers
+	MinMessages   int           // New messages required before the summary is refreshed
+	Timeout       time.Duration // Per model call
+	// Idle reports whether interactive chat is idle. Workers wait for it before
+	// calling the model so summaries never compete with /chat streams.
+	Idle func() bool
+	// MaxDeferral bounds the wait for Idle, so summaries still get written
+	// while chat is never idle
+	MaxDeferral time.Duration
+
+	JobsCounter *prometheus.CounterVec // Labelled by result
+	QueueDepth  prometheus.Gauge
+}
+
+// Summarizer generates conversation titles and rolling summaries in the background
+type Summarizer struct {
+	store     conversation.Store
+	completer Completer
+	opts      Options
+
+	queue   chan string
+	limiter *time.Ticker
+
+	mu      sync.Mutex
+	pending map[string]bool
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+const (
+	titlePrompt = "Write a short title (at most six words) for the following conversation. " +
+		"Reply with the title only, without quotes or punctuation at the end."
+	summaryPrompt = "You maintain a running summary of a conversation between a user and an assistant. " +
+		"Update the existing summary with the new messages. Keep it under 80 words, " +
+		"focus on the topics discussed and conclusions reached, and reply with the summary only."
+)
+
+// New creates a summarizer and starts its workers
+func New(store conversation.Store, completer Completer, opts Options) *Summarizer {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+	if opts.RatePerMinute <= 0 {
+		opts.RatePerMinute = 10
+	}
+	if opts.MinMessages <= 0 {
+		opts.MinMessages = 2
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.Idle == nil {
+		opts.Idle = func() bool { return true }
+	}
+	if opts.MaxDeferral <= 0 {
+		opts.MaxDeferral = 2 * time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Summarizer{
+		store:     store,
+		completer: completer,
+		opts:      opts,
+		queue:     make(chan string, opts.QueueSize),
+		limiter:   time.NewTicker(time.Minute / time.Duration(opts.RatePerMinute)),
+		pending:   make(map[string]bool),
+		cancel:    cancel,
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		s.wg.Add(1)
+		go s.worker(ctx)
+	}
+	return s
+}
+
+// Enqueue schedules a conversation for summarization. It never blocks:
+// conversations already queued are skipped and a full queue drops the request.
+func (s *Summarizer) Enqueue(conversationID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending[conversationID] {
+		return
+	}
+	select {
+	case s.queue <- conversationID:
+		s.pending[conversationID] = true
+		s.setQueueDepth()
+	default:
+		s.record("dropped")
+		log.Warn().Str("conversation_id", conversationID).Msg("Summarizer queue full, skipping conversation")
+	}
+}
+
+// Close stops the workers, abandoning queued jobs
+func (s *Summarizer) Close() {
+	s.cancel()
+	s.limiter.Stop()
+	s.wg.Wait()
+}
+
+// worker processes queued conversations until the context is cancelled
+func (s *Summarizer) worker(ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			s.mu.Lock()
+			delete(s.pending, id)
+			s.setQueueDepth()
+			s.mu.Unlock()
+
+			if err := s.summarize(ctx, id); err != nil {
+				if !errors.Is(err, context.Canceled) {
+					s.record("error")
+					log.Error().Err(err).Str("conversation_id", id).Msg("Failed to summarize conversation")
+				}
+			}
+		}
+	}
+}
+
+// summarize refreshes the title and summary of one conversation
+func (s *Summarizer) summarize(ctx context.Context, id string) error {
+	conv, err := s.store.Get(ctx, id)
+	if errors.Is(err, conversation.ErrNotFound) {
+		s.record("skipped")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	branch := conv.ActiveBranch()
+	previous, newMessages := splitSummarized(conv, branch)
+	if len(newMessages) < s.opts.MinMessages && conv.Title != "" {
+		s.record("skipped")
+		return nil
+	}
+
+	var title string
+	if conv.Title == "" {
+		title, err = s.complete(ctx, titlePrompt, transcript(branch))
+		if err != nil {
+			return fmt.Errorf("generate title: %w", err)
+		}
+		title = cleanTitle(title)
+	}
+
+	summary := conv.Summary
+	if len(newMessages) > 0 {
+		prompt := "Existing summary:\n" + previous + "\n\nNew messages:\n" + transcript(newMessages)
+		if previous == "" {
+			prompt = "Existing summary: (none)\n\nNew messages:\n" + transcript(newMessages)
+		}
+		summary, err = s.complete(ctx, summaryPrompt, prompt)
+		if err != nil {
+			return fmt.Errorf("generate summary: %w", err)
+		}
+		summary = strings.TrimSpace(summary)
+	}
+
+	if err := s.store.UpdateSummary(ctx, id, title, summary, conv.HeadID); err != nil {
+		return err
+	}
+	s.record("success")
+	log.Debug().Str("conversation_id", id).Str("title", title).Msg("Updated conversation summary")
+	return nil
+}
+
+// complete waits for the budget and an idle interactive path, for at most
+// MaxDeferral, then calls the model
+func (s *Summarizer) complete(ctx context.Context, system, prompt string) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-s.limiter.C:
+	}
+
+	deadline := time.Now().Add(s.opts.MaxDeferral)
+	for !s.opts.Idle() && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	return s.completer.Complete(callCtx, system, prompt)
+}
+
+// splitSummarized returns the previous summary and the messages not yet
+// covered by it. If the active branch no longer contains the last summarized
+// message (the user switched branches), the summary is rebuilt from scratch.
+func splitSummarized(conv *conversation.Conversation, branch []conversation.Message) (string, []conversation.Message) {
+	if conv.SummarizedThrough == "" {
+		return "", branch
+	}
+	for i, msg := range branch {
+		if msg.ID == conv.SummarizedThrough {
+			return conv.Summary, branch[i+1:]
+		}
+	}
+	return "", branch
+}
+
+// transcript renders messages as a plain-text dialogue for the prompt
+func transcript(msgs []conversation.Message) string {
+	var b strings.Builder
+	for _, msg := range msgs {
+		content := msg.Content
+		if len(content) > 2000 {
+			content = truncate(content, 2000) + "..."
+		}
+		fmt.Fprintf(&b, "%s: %s\n", msg.Role, content)
+	}
+	return b.String()
+}
+
+// cleanTitle strips the quoting and trailing punctuation models like to add
+func cleanTitle(title string) string {
+	title = strings.TrimSpace(strings.SplitN(strings.TrimSpace(title), "\n", 2)[0])
+	title = strings.Trim(title, `"'*#`)
+	title = strings.TrimRight(title, ".")
+	return strings.TrimSpace(truncate(title, 80))
+}
+
+// truncate shortens text to at most n bytes without splitting a character
+func truncate(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
+// record counts a finished job by result
+func (s *Summarizer) record(result string) {
+	if s.opts.JobsCounter != nil {
+		s.opts.JobsCounter.WithLabelValues(result).Inc()
+	}
+}
+
+// setQueueDepth updates the queue gauge; callers hold s.mu
+func (s *Summarizer) setQueueDepth() {
+	if s.opts.QueueDepth != nil {
+		s.opts.QueueDepth.Set(float64(len(s.pending)))
+	}
+}
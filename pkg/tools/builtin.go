@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/jsonschema"
+)
+
+// CurrentTime reports the current date and time, optionally in a given time zone
+func CurrentTime() Tool {
+	return Tool{
+		Name:        "current_time",
+		Description: "Get the current date and time. Optionally pass an IANA time zone such as Europe/Berlin; the default is UTC.",
+		Parameters: jsonschema.Schema{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"timezone": map[string]interface{}{
+					"type":        "string",
+					"description": "IANA time zone name",
+				},
+			},
+		},
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var params struct {
+				Timezone string `json:"timezone"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return "", err
+			}
+
+			loc := time.UTC
+			if params.Timezone != "" {
+				var err error
+				if loc, err = time.LoadLocation(params.Timezone); err != nil {
+					return "", fmt.Errorf("unknown time zone %q", params.Timezone)
+				}
+			}
+			now := time.Now().In(loc)
+			return fmt.Sprintf("%s (%s)", now.Format(time.RFC3339), now.Format("Monday, January 2, 2006")), nil
+		},
+	}
+}
+
+// ErrOutsideRoot is returned for paths that escape the file lookup root
+var ErrOutsideRoot = errors.New("path is outside the allowed directory")
+
+// FileLookup reads files below root, read-only. Paths are relative to root;
+// absolute paths, ".." and symlinks leading outside it are rejected. Reading
+// a directory lists its entries. At most maxBytes are returned per call.
+func FileLookup(root string, maxBytes int64) (Tool, error) {
+	resolved, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return Tool{}, fmt.Errorf("file lookup root: %w", err)
+	}
+	if resolved, err = filepath.Abs(resolved); err != nil {
+		return Tool{}, fmt.Errorf("file lookup root: %w", err)
+	}
+	if maxBytes <= 0 {
+		maxBytes = 64 << 10
+	}
+
+	return Tool{
+		Name:        "read_file",
+		Description: "Read a text file, or list a directory, from the documents available to the assistant. Paths are relative, for example notes/setup.md or . for the top-level listing.",
+		Parameters: jsonschema.Schema{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Relative path of the file or directory",
+				},
+				"offset": map[string]interface{}{
+					"type":        "integer",
+					"minimum":     0,
+					"description": "Byte offset to start reading from, for files larger than one response",
+				},
+			},
+			"required": []interface{}{"path"},
+		},
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var params struct {
+				Path   string `json:"path"`
+				Offset int64  `json:"offset"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return "", err
+			}
+
+			path, err := sandboxPath(resolved, params.Path)
+			if err != nil {
+				return "", err
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", fmt.Errorf("%s: not found", params.Path)
+			}
+			if info.IsDir() {
+				return listDirectory(path)
+			}
+			return readFile(path, params.Offset, maxBytes)
+		},
+	}, nil
+}
+
+// sandboxPath resolves a relative path below root, following symlinks, and
+// rejects anything that ends up outside it
+func sandboxPath(root, path string) (string, error) {
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return "", ErrOutsideRoot
+	}
+	joined := filepath.Join(root, filepath.Clean("/"+path))
+	resolved, err := filepath.EvalSymlinks(joined)
+	if err != nil {
+		return "", fmt.Errorf("%s: not found", path)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideRoot
+	}
+	return resolved, nil
+}
+
+func listDirectory(path string) (string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "(empty directory)", nil
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintln(&b, name)
+	}
+	return b.String(), nil
+}
+
+func readFile(path string, offset, maxBytes int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if offset > info.Size() {
+		return "", fmt.Errorf("offset %d is beyond the end of the file (%d bytes)", offset, info.Size())
+	}
+
+	data, err := io.ReadAll(io.LimitReader(io.NewSectionReader(f, offset, info.Size()-offset), maxBytes))
+	if err != nil {
+		return "", err
+	}
+	if end := offset + int64(len(data)); end < info.Size() {
+		return fmt.Sprintf("%s\n[truncated: %d of %d bytes shown; continue with offset %d]", data, len(data), info.Size(), end), nil
+	}
+	return string(data), nil
+}
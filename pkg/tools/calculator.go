@@ -0,0 +1,304 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/jsonschema"
+)
+
+// Calculator evaluates arithmetic expressions. Models are unreliable at
+// arithmetic, so this is usually the first tool worth offering.
+func Calculator() Tool {
+	return Tool{
+		Name:        "calculator",
+		Description: "Evaluate an arithmetic expression. Supports + - * / % ^, parentheses, the constants pi and e, and the functions sqrt, abs, ln, log, exp, sin, cos, tan, floor, ceil, round, min and max.",
+		Parameters: jsonschema.Schema{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"expression": map[string]interface{}{
+					"type":        "string",
+					"description": "The expression to evaluate, for example (2 + 3) * sqrt(16)",
+				},
+			},
+			"required": []interface{}{"expression"},
+		},
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var params struct {
+				Expression string `json:"expression"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return "", err
+			}
+			value, err := Evaluate(params.Expression)
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatFloat(value, 'g', -1, 64), nil
+		},
+	}
+}
+
+// Evaluate computes the value of an arithmetic expression
+func Evaluate(expression string) (float64, error) {
+	p := &parser{input: expression}
+	p.next()
+	value, err := p.expression()
+	if err != nil {
+		return 0, err
+	}
+	if p.token != "" {
+		return 0, fmt.Errorf("unexpected %q", p.token)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return value, nil
+}
+
+// parser is a recursive descent parser over a stream of tokens:
+//
+//	expression = term { ("+" | "-") term }
+//	term       = unary { ("*" | "/" | "%") unary }
+//	unary      = ("+" | "-") unary | power
+//	power      = primary [ "^" unary ]
+//	primary    = number | name | name "(" expression { "," expression } ")" | "(" expression ")"
+type parser struct {
+	input string
+	pos   int
+	token string
+}
+
+// next reads the following token into p.token, "" at the end of the input
+func (p *parser) next() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	if p.pos >= len(p.input) {
+		p.token = ""
+		return
+	}
+
+	start := p.pos
+	c := rune(p.input[p.pos])
+	switch {
+	case unicode.IsDigit(c) || c == '.':
+		for p.pos < len(p.input) && (unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		// Exponent, as in 1.5e3
+		if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+			end := p.pos + 1
+			if end < len(p.input) && (p.input[end] == '+' || p.input[end] == '-') {
+				end++
+			}
+			if end < len(p.input) && unicode.IsDigit(rune(p.input[end])) {
+				for end < len(p.input) && unicode.IsDigit(rune(p.input[end])) {
+					end++
+				}
+				p.pos = end
+			}
+		}
+	case unicode.IsLetter(c):
+		for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+	case c == '*' && p.pos+1 < len(p.input) && p.input[p.pos+1] == '*':
+		// Python-style power
+		p.pos += 2
+		p.token = "^"
+		return
+	default:
+		p.pos++
+	}
+	p.token = p.input[start:p.pos]
+}
+
+func (p *parser) expression() (float64, error) {
+	left, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for p.token == "+" || p.token == "-" {
+		op := p.token
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return 0, err
+		}
+		if op == "+" {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) term() (float64, error) {
+	left, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for p.token == "*" || p.token == "/" || p.token == "%" {
+		op := p.token
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "*":
+			left *= right
+		case "/":
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			left /= right
+		case "%":
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			left = math.Mod(left, right)
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (float64, error) {
+	switch p.token {
+	case "-":
+		p.next()
+		value, err := p.unary()
+		return -value, err
+	case "+":
+		p.next()
+		return p.unary()
+	}
+	return p.power()
+}
+
+func (p *parser) power() (float64, error) {
+	base, err := p.primary()
+	if err != nil {
+		return 0, err
+	}
+	if p.token != "^" {
+		return base, nil
+	}
+	p.next()
+	// Right associative: 2^3^2 is 2^(3^2)
+	exponent, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+func (p *parser) primary() (float64, error) {
+	token := p.token
+	switch {
+	case token == "":
+		return 0, fmt.Errorf("unexpected end of expression")
+	case token == "(":
+		p.next()
+		value, err := p.expression()
+		if err != nil {
+			return 0, err
+		}
+		if p.token != ")" {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		p.next()
+		return value, nil
+	case unicode.IsDigit(rune(token[0])) || token[0] == '.':
+		value, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", token)
+		}
+		p.next()
+		return value, nil
+	case unicode.IsLetter(rune(token[0])):
+		p.next()
+		name := strings.ToLower(token)
+		if p.token != "(" {
+			switch name {
+			case "pi":
+				return math.Pi, nil
+			case "e":
+				return math.E, nil
+			}
+			return 0, fmt.Errorf("unknown constant %q", token)
+		}
+		args, err := p.arguments()
+		if err != nil {
+			return 0, err
+		}
+		return call(name, args)
+	}
+	return 0, fmt.Errorf("unexpected %q", token)
+}
+
+// arguments parses a parenthesized, comma-separated argument list
+func (p *parser) arguments() ([]float64, error) {
+	p.next() // "("
+	var args []float64
+	for {
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+		if p.token == ")" {
+			p.next()
+			return args, nil
+		}
+		if p.token != "," {
+			return nil, fmt.Errorf("expected , or ) in argument list")
+		}
+		p.next()
+	}
+}
+
+// functions of one argument
+var unaryFunctions = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"exp":   math.Exp,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+}
+
+func call(name string, args []float64) (float64, error) {
+	if fn, ok := unaryFunctions[name]; ok {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("%s takes one argument", name)
+		}
+		return fn(args[0]), nil
+	}
+
+	switch name {
+	case "min", "max":
+		result := args[0]
+		for _, arg := range args[1:] {
+			if name == "min" {
+				result = math.Min(result, arg)
+			} else {
+				result = math.Max(result, arg)
+			}
+		}
+		return result, nil
+	}
+	return 0, fmt.Errorf("unknown function %q", name)
+}
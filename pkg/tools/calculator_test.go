@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"2 ^ 3 ^ 2", 512},
+		{"2 ** 10", 1024},
+		{"-2 ^ 2", -4},
+		{"2 ^ -1", 0.5},
+		{"7 % 4", 3},
+		{"--3", 3},
+		{"1.5e3 / 3", 500},
+		{"sqrt(16) + abs(-2)", 6},
+		{"max(1, 5, 3) - min(4, 2)", 3},
+		{"round(2.5) + floor(1.9) + ceil(1.1)", 6},
+		{"log(1000) + ln(e)", 4},
+		{"PI", math.Pi},
+	}
+	for _, tt := range tests {
+		got, err := Evaluate(tt.expression)
+		if err != nil {
+			t.Errorf("Evaluate(%q): %v", tt.expression, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Evaluate(%q) = %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"1 / 0", "division by zero"},
+		{"5 % (2 - 2)", "division by zero"},
+		{"tau", "unknown constant"},
+		{"foo(1)", "unknown function"},
+		{"sqrt(1, 2)", "takes one argument"},
+		{"(1 + 2", "missing closing parenthesis"},
+		{"1 +", "unexpected end of expression"},
+		{"1 2", "unexpected"},
+		{"1..2", "invalid number"},
+		{"sqrt(-1)", "not a finite number"},
+		{"", "unexpected end of expression"},
+	}
+	for _, tt := range tests {
+		_, err := Evaluate(tt.expression)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Evaluate(%q): err = %v, want %q", tt.expression, err, tt.want)
+		}
+	}
+}
+
+func TestCalculatorCall(t *testing.T) {
+	registry := NewRegistry(Options{})
+	if err := registry.Register(Calculator()); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := registry.Call(context.Background(), "calculator", json.RawMessage(`{"expression":"(2 + 3) * sqrt(16)"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "20" {
+		t.Fatalf("result = %q, want 20", result)
+	}
+
+	if _, err := registry.Call(context.Background(), "calculator", json.RawMessage(`{"expr":"1"}`)); !errors.Is(err, ErrInvalidArguments) {
+		t.Fatalf("call without expression: err = %v, want ErrInvalidArguments", err)
+	}
+	if _, err := registry.Call(context.Background(), "calc", nil); !errors.Is(err, ErrUnknownTool) {
+		t.Fatalf("call to an unknown tool: err = %v, want ErrUnknownTool", err)
+	}
+	if err := registry.Register(Calculator()); !errors.Is(err, ErrDuplicateTool) {
+		t.Fatalf("second Register: err = %v, want ErrDuplicateTool", err)
+	}
+}
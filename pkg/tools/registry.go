@@ -0,0 +1,186 @@
+// Package tools is a registry of functions the model can call. Each tool
+// declares its parameters as a JSON Schema; arguments from the model are
+// validated against it before the handler runs.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/jsonschema"
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Errors returned by the registry
+var (
+	ErrUnknownTool      = errors.New("unknown tool")
+	ErrDuplicateTool    = errors.New("tool already registered")
+	ErrInvalidName      = errors.New("invalid tool name")
+	ErrInvalidArguments = errors.New("invalid tool arguments")
+)
+
+// Handler runs a tool with arguments that already match its schema and
+// returns the text given back to the model
+type Handler func(ctx context.Context, args json.RawMessage) (string, error)
+
+// Tool is a function the model can call
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  jsonschema.Schema // JSON Schema of the arguments object
+	Handler     Handler
+	Mutating    bool // Changes state outside the chat, so calls may need approval
+}
+
+// Options configures tool call metrics
+type Options struct {
+	Calls    *prometheus.CounterVec   // Labelled by tool and result
+	Duration *prometheus.HistogramVec // Labelled by tool
+}
+
+// Registry holds the tools available to the model
+type Registry struct {
+	opts Options
+
+	mu    sync.RWMutex
+	tools map[string]Tool
+}
+
+// validName is the function name format accepted by the chat completions API
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// NewRegistry creates an empty registry
+func NewRegistry(opts Options) *Registry {
+	return &Registry{opts: opts, tools: make(map[string]Tool)}
+}
+
+// Register adds a tool. Tools without parameters accept an empty object.
+func (r *Registry) Register(tool Tool) error {
+	if !validName.MatchString(tool.Name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, tool.Name)
+	}
+	if tool.Handler == nil {
+		return fmt.Errorf("tool %q has no handler", tool.Name)
+	}
+	if tool.Parameters == nil {
+		tool.Parameters = jsonschema.Schema{"type": "object", "properties": map[string]interface{}{}}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tools[tool.Name]; exists {
+		return fmt.Errorf("%w: %s", ErrDuplicateTool, tool.Name)
+	}
+	r.tools[tool.Name] = tool
+	return nil
+}
+
+// Unregister removes a tool if it exists
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
+// Get returns a tool by name
+func (r *Registry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+// List returns all tools sorted by name
+func (r *Registry) List() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Tool, 0, len(r.tools))
+	for _, tool := range r.tools {
+		list = append(list, tool)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Select returns the named tools; "*" selects every tool. Unknown names fail
+// with ErrUnknownTool.
+func (r *Registry) Select(names []string) ([]Tool, error) {
+	var selected []Tool
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name == "*" {
+			return r.List(), nil
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		tool, ok := r.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTool, name)
+		}
+		selected = append(selected, tool)
+	}
+	return selected, nil
+}
+
+// Call validates the arguments and runs a tool inside a span, recording the
+// call count and duration
+func (r *Registry) Call(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	ctx, span := tracing.StartChildSpan(ctx, "tool.call")
+	defer span.End()
+	span.SetAttributes(attribute.String("tool.name", name))
+
+	start := time.Now()
+	result, err := r.call(ctx, name, args)
+
+	outcome := "success"
+	switch {
+	case errors.Is(err, ErrUnknownTool):
+		outcome = "unknown"
+	case errors.Is(err, ErrInvalidArguments):
+		outcome = "invalid"
+	case errors.Is(err, context.DeadlineExceeded):
+		outcome = "timeout"
+	case err != nil:
+		outcome = "error"
+	}
+	span.SetAttributes(attribute.String("tool.result", outcome))
+	if err != nil {
+		tracing.RecordError(ctx, err, "Tool call failed")
+	}
+
+	if r.opts.Calls != nil {
+		r.opts.Calls.WithLabelValues(name, outcome).Inc()
+	}
+	if r.opts.Duration != nil && outcome != "unknown" {
+		r.opts.Duration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+	return result, err
+}
+
+func (r *Registry) call(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	tool, ok := r.Get(name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTool, name)
+	}
+
+	// Models often send an empty string for tools without parameters
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if err := jsonschema.ValidateJSON(tool.Parameters, args); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidArguments, err)
+	}
+	return tool.Handler(ctx, args)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"time"
 
 	"go.opentelemetry.io/otel"
@@ -71,6 +72,16 @@ func SetupTracing(serviceName string, otlpEndpoint string) (func(), error) {
 	}, nil
 }
 
+// PingExporter checks that the OTLP endpoint accepts connections
+func PingExporter(ctx context.Context, otlpEndpoint string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", otlpEndpoint)
+	if err != nil {
+		return fmt.Errorf("OTLP endpoint %s is unreachable: %w", otlpEndpoint, err)
+	}
+	return conn.Close()
+}
+
 // StartSpan starts a new span
 func StartSpan(ctx context.Context, spanName string) (context.Context, otelTrace.Span) {
 	tracer := otel.Tracer("genai-app")
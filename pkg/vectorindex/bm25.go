@@ -0,0 +1,214 @@
+package vectorindex
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters, the common defaults from the literature
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// bm25 is an inverted index over item texts
+type bm25 struct {
+	postings    map[string]map[uint32]uint32 // Term to term frequency per node
+	lengths     map[uint32]uint32            // Tokens per node
+	totalLength uint64
+}
+
+// scored is a node with a keyword score
+type scored struct {
+	id    uint32
+	score float32
+}
+
+func newBM25() *bm25 {
+	return &bm25{postings: make(map[string]map[uint32]uint32), lengths: make(map[uint32]uint32)}
+}
+
+// tokenize lowercases text and splits it into runs of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func (b *bm25) add(id uint32, text string) {
+	terms := tokenize(text)
+	if len(terms) == 0 {
+		return
+	}
+	for _, term := range terms {
+		posting, ok := b.postings[term]
+		if !ok {
+			posting = make(map[uint32]uint32)
+			b.postings[term] = posting
+		}
+		posting[id]++
+	}
+	b.lengths[id] = uint32(len(terms))
+	b.totalLength += uint64(len(terms))
+}
+
+func (b *bm25) remove(id uint32, text string) {
+	length, ok := b.lengths[id]
+	if !ok {
+		return
+	}
+	for _, term := range tokenize(text) {
+		if posting, ok := b.postings[term]; ok {
+			delete(posting, id)
+			if len(posting) == 0 {
+				delete(b.postings, term)
+			}
+		}
+	}
+	delete(b.lengths, id)
+	b.totalLength -= uint64(length)
+}
+
+// scoredHeap keeps the k best scores, lowest on top
+type scoredHeap []scored
+
+func (h scoredHeap) Len() int            { return len(h) }
+func (h scoredHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h scoredHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *scoredHeap) Push(x interface{}) { *h = append(*h, x.(scored)) }
+func (h *scoredHeap) Pop() interface{} {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
+
+// offer adds a node to a heap of the k best, if it is one of them
+func (h *scoredHeap) offer(s scored, k int) {
+	switch {
+	case h.Len() < k:
+		heap.Push(h, s)
+	case s.score > (*h)[0].score:
+		(*h)[0] = s
+		heap.Fix(h, 0)
+	}
+}
+
+// scoreBuffers holds the dense score slices of finished searches for reuse
+var scoreBuffers sync.Pool
+
+// queryTerm is a term of a query with its posting list
+type queryTerm struct {
+	posting map[uint32]uint32
+	idf     float64
+	bound   float32 // Most the term can add to a score
+}
+
+// search scores the nodes containing the query terms and returns the top k
+// accepted by keep, best first. Scores accumulate in a dense slice of size
+// entries (the number of graph nodes), reused across searches, which is much
+// faster than a map when common terms match a large share of the index.
+//
+// Terms are scored rarest first. Once the terms left could not lift a node
+// that has no score yet past the k-th best score, those terms only add to
+// the nodes already scored, looking each up rather than walking the term's
+// posting list (the MaxScore optimization). The results are exact.
+func (b *bm25) search(query string, k, size int, keep func(uint32) bool) []scored {
+	if len(b.lengths) == 0 || k <= 0 {
+		return nil
+	}
+	docs := float64(len(b.lengths))
+	avgLength := float64(b.totalLength) / docs
+
+	var terms []queryTerm
+	seen := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		posting := b.postings[term]
+		if len(posting) == 0 {
+			continue
+		}
+		idf := math.Log(1 + (docs-float64(len(posting))+0.5)/(float64(len(posting))+0.5))
+		terms = append(terms, queryTerm{posting: posting, idf: idf, bound: float32(idf * (bm25K1 + 1))})
+	}
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i].posting) < len(terms[j].posting) })
+	// remaining[i] bounds what terms i and later can add together
+	remaining := make([]float32, len(terms)+1)
+	for i := len(terms) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + terms[i].bound
+	}
+
+	buffer, _ := scoreBuffers.Get().(*[]float32)
+	if buffer == nil || len(*buffer) < size {
+		scores := make([]float32, size)
+		buffer = &scores
+	}
+	scores := *buffer
+	var touched []uint32
+	var best float32 // Highest score so far, which bounds the k-th best
+	score := func(id, tf uint32, idf float64) {
+		norm := bm25K1 * (1 - bm25B + bm25B*float64(b.lengths[id])/avgLength)
+		scores[id] += float32(idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + norm))
+		best = max(best, scores[id])
+	}
+
+	pruned := false
+	for i, term := range terms {
+		if !pruned && len(touched) >= k && remaining[i] < best {
+			pruned = remaining[i] < threshold(scores, touched, k, keep)
+		}
+		if pruned {
+			for _, id := range touched {
+				if tf, ok := term.posting[id]; ok {
+					score(id, tf, term.idf)
+				}
+			}
+			continue
+		}
+		for id, tf := range term.posting {
+			if scores[id] == 0 {
+				touched = append(touched, id)
+			}
+			score(id, tf, term.idf)
+		}
+	}
+
+	top := make(scoredHeap, 0, k)
+	for _, id := range touched {
+		if keep(id) {
+			top.offer(scored{id, scores[id]}, k)
+		}
+		scores[id] = 0
+	}
+	scoreBuffers.Put(buffer)
+
+	results := make([]scored, top.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		results[i] = heap.Pop(&top).(scored)
+	}
+	return results
+}
+
+// threshold returns the k-th best score of the nodes keep accepts so far,
+// or 0 when fewer than k are accepted. Scores only grow, so no node with a
+// lower score can end up in the top k.
+func threshold(scores []float32, touched []uint32, k int, keep func(uint32) bool) float32 {
+	top := make(scoredHeap, 0, k)
+	for _, id := range touched {
+		if keep(id) {
+			top.offer(scored{id, scores[id]}, k)
+		}
+	}
+	if top.Len() < k {
+		return 0
+	}
+	return top[0].score
+}
@@ -0,0 +1,294 @@
+package vectorindex
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+)
+
+// node is a vector in the HNSW graph. Deleted nodes stay in the graph as
+// waypoints so the remaining nodes stay reachable, but are never returned.
+type node struct {
+	ID        string
+	Vector    []float32
+	Level     int
+	Neighbors [][]uint32 // Per level, 0 to Level
+	Metadata  map[string]string
+	Text      string
+	Deleted   bool
+}
+
+// candidate is a node and its distance to the query
+type candidate struct {
+	id   uint32
+	dist float32
+}
+
+// minHeap pops the closest candidate first
+type minHeap []candidate
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// maxHeap pops the furthest candidate first
+type maxHeap []candidate
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].dist > h[j].dist }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// visitedSet marks nodes seen during a search. Marks are compared against an
+// epoch so the set can be reused without clearing it.
+type visitedSet struct {
+	marks []uint32
+	epoch uint32
+}
+
+var visitedPool = sync.Pool{New: func() interface{} { return &visitedSet{} }}
+
+func acquireVisited(size int) *visitedSet {
+	v := visitedPool.Get().(*visitedSet)
+	if len(v.marks) < size {
+		v.marks = make([]uint32, size+size/4)
+		v.epoch = 0
+	}
+	v.reset()
+	return v
+}
+
+// reset forgets all visits
+func (v *visitedSet) reset() {
+	v.epoch++
+	if v.epoch == 0 { // Wrapped around; stale marks could match again
+		clear(v.marks)
+		v.epoch = 1
+	}
+}
+
+// visit marks a node and reports whether it was already visited
+func (v *visitedSet) visit(id uint32) bool {
+	if v.marks[id] == v.epoch {
+		return true
+	}
+	v.marks[id] = v.epoch
+	return false
+}
+
+// distance orders vectors by similarity, smallest first. Cosine vectors are
+// normalized on insert, so both metrics reduce to one minus the dot product.
+func (idx *Index) distance(a, b []float32) float32 {
+	return 1 - dot(a, b)
+}
+
+// dot is unrolled four ways, which roughly halves its cost since Go does not
+// vectorize the plain loop
+func dot(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(1 / math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x * norm
+	}
+	return out
+}
+
+// randomLevel draws the top layer of a new node from an exponential distribution
+func (idx *Index) randomLevel() int {
+	level := int(-math.Log(1-idx.rng.Float64()) * idx.levelMult)
+	return min(level, 16)
+}
+
+// insert links a new node into the graph; callers hold the write lock
+func (idx *Index) insert(n *node) uint32 {
+	id := uint32(len(idx.nodes))
+	n.Level = idx.randomLevel()
+	n.Neighbors = make([][]uint32, n.Level+1)
+	idx.nodes = append(idx.nodes, n)
+
+	if len(idx.nodes) == 1 {
+		idx.entry, idx.maxLevel = id, n.Level
+		return id
+	}
+
+	visited := acquireVisited(len(idx.nodes))
+	defer visitedPool.Put(visited)
+
+	// Greedy descent through the layers above the new node
+	ep := candidate{idx.entry, idx.distance(n.Vector, idx.nodes[idx.entry].Vector)}
+	for level := idx.maxLevel; level > n.Level; level-- {
+		ep = idx.greedy(n.Vector, ep, level)
+	}
+
+	entries := []candidate{ep}
+	for level := min(n.Level, idx.maxLevel); level >= 0; level-- {
+		visited.reset()
+		found := idx.searchLayer(n.Vector, entries, idx.opts.EfConstruction, level, visited, nil)
+		neighbors := idx.selectNeighbors(found, idx.maxNeighbors(level))
+		n.Neighbors[level] = neighbors
+
+		for _, neighbor := range neighbors {
+			idx.link(neighbor, id, level)
+		}
+		entries = found
+	}
+
+	if n.Level > idx.maxLevel {
+		idx.entry, idx.maxLevel = id, n.Level
+	}
+	return id
+}
+
+// link adds a reverse edge, pruning the neighbor's list to its closest nodes when full
+func (idx *Index) link(from, to uint32, level int) {
+	n := idx.nodes[from]
+	n.Neighbors[level] = append(n.Neighbors[level], to)
+	limit := idx.maxNeighbors(level)
+	if len(n.Neighbors[level]) <= limit {
+		return
+	}
+
+	candidates := make([]candidate, len(n.Neighbors[level]))
+	for i, neighbor := range n.Neighbors[level] {
+		candidates[i] = candidate{neighbor, idx.distance(n.Vector, idx.nodes[neighbor].Vector)}
+	}
+	n.Neighbors[level] = idx.selectNeighbors(candidates, limit)
+}
+
+// selectNeighbors picks up to m neighbors with the HNSW heuristic: a candidate
+// is kept only if it is closer to the base node than to any neighbor already
+// selected, which keeps links spread out across clusters. Remaining slots are
+// filled with the closest discarded candidates.
+func (idx *Index) selectNeighbors(candidates []candidate, m int) []uint32 {
+	sorted := make(minHeap, len(candidates))
+	copy(sorted, candidates)
+	heap.Init(&sorted)
+
+	selected := make([]uint32, 0, m)
+	var discarded []uint32
+	for sorted.Len() > 0 && len(selected) < m {
+		c := heap.Pop(&sorted).(candidate)
+		keep := true
+		for _, s := range selected {
+			if idx.distance(idx.nodes[c.id].Vector, idx.nodes[s].Vector) < c.dist {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, c.id)
+		} else {
+			discarded = append(discarded, c.id)
+		}
+	}
+	for _, id := range discarded {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+// maxNeighbors is M on the upper layers and 2*M on the base layer
+func (idx *Index) maxNeighbors(level int) int {
+	if level == 0 {
+		return idx.opts.M * 2
+	}
+	return idx.opts.M
+}
+
+// greedy walks a single layer towards the query, returning the closest node found
+func (idx *Index) greedy(query []float32, ep candidate, level int) candidate {
+	for changed := true; changed; {
+		changed = false
+		for _, neighbor := range idx.nodes[ep.id].Neighbors[level] {
+			if d := idx.distance(query, idx.nodes[neighbor].Vector); d < ep.dist {
+				ep = candidate{neighbor, d}
+				changed = true
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer is the HNSW beam search. Only nodes accepted by keep (all nodes
+// when nil) enter the result set, but every node is traversed, so selective
+// filters widen the search instead of losing results.
+func (idx *Index) searchLayer(query []float32, entries []candidate, ef, level int, visited *visitedSet, keep func(*node) bool) []candidate {
+	candidates := make(minHeap, 0, ef)
+	results := make(maxHeap, 0, ef+1)
+
+	for _, ep := range entries {
+		if visited.visit(ep.id) {
+			continue
+		}
+		heap.Push(&candidates, ep)
+		if keep == nil || keep(idx.nodes[ep.id]) {
+			heap.Push(&results, ep)
+		}
+	}
+	for results.Len() > ef {
+		heap.Pop(&results)
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(&candidates).(candidate)
+		if results.Len() >= ef && c.dist > results[0].dist {
+			break
+		}
+
+		for _, neighbor := range idx.nodes[c.id].Neighbors[level] {
+			if visited.visit(neighbor) {
+				continue
+			}
+			d := idx.distance(query, idx.nodes[neighbor].Vector)
+			if results.Len() < ef || d < results[0].dist {
+				heap.Push(&candidates, candidate{neighbor, d})
+				if keep == nil || keep(idx.nodes[neighbor]) {
+					heap.Push(&results, candidate{neighbor, d})
+					if results.Len() > ef {
+						heap.Pop(&results)
+					}
+				}
+			}
+		}
+	}
+	return results
+}
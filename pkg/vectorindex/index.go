@@ -0,0 +1,360 @@
+// Package vectorindex is an in-process approximate nearest neighbour index
+// (HNSW) with BM25 keyword scoring, metadata filtering and hybrid retrieval
+// through reciprocal rank fusion. Indexes can be saved to and loaded from disk.
+package vectorindex
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Metric is the similarity measure used to compare vectors
+type Metric string
+
+// Supported metrics
+const (
+	Cosine Metric = "cosine"
+	Dot    Metric = "dot"
+)
+
+// ErrDimensionMismatch is returned for vectors whose length differs from the index
+var ErrDimensionMismatch = errors.New("vector dimensions do not match the index")
+
+// Options tunes the HNSW graph
+type Options struct {
+	Metric         Metric
+	M              int   // Links per node on the upper layers; twice this on the base layer
+	EfConstruction int   // Beam width while inserting
+	EfSearch       int   // Beam width while searching; raised to k when smaller
+	Seed           int64 // Level generator seed, for reproducible graphs
+}
+
+// DefaultOptions balance recall and build time for text embeddings
+var DefaultOptions = Options{Metric: Cosine, M: 16, EfConstruction: 200, EfSearch: 64, Seed: 1}
+
+// Item is a vector to index, with optional text for keyword search and
+// metadata for filtering
+type Item struct {
+	ID       string
+	Vector   []float32
+	Text     string
+	Metadata map[string]string
+}
+
+// Filter restricts results to items whose metadata has all of the given values
+type Filter map[string]string
+
+// matches reports whether metadata satisfies the filter
+func (f Filter) matches(metadata map[string]string) bool {
+	for key, value := range f {
+		if metadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Result is a search hit. Score is the similarity for vector search, the
+// BM25 score for keyword search and the fused score for hybrid search.
+type Result struct {
+	ID           string            `json:"id"`
+	Score        float32           `json:"score"`
+	VectorScore  float32           `json:"vector_score,omitempty"`
+	KeywordScore float32           `json:"keyword_score,omitempty"`
+	Text         string            `json:"text,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// Index is a concurrency-safe HNSW vector index with a BM25 keyword index
+// over the item texts. Searches run in parallel; writes are serialized.
+type Index struct {
+	opts      Options
+	dim       int
+	levelMult float64
+	rng       *rand.Rand
+
+	mu       sync.RWMutex
+	nodes    []*node
+	ids      map[string]uint32 // Live nodes by item ID
+	entry    uint32
+	maxLevel int
+	keywords *bm25
+}
+
+// New creates an empty index. With dim 0 the dimensions are taken from the
+// first vector added.
+func New(dim int, opts Options) (*Index, error) {
+	if opts.Metric == "" {
+		opts.Metric = DefaultOptions.Metric
+	}
+	if opts.Metric != Cosine && opts.Metric != Dot {
+		return nil, fmt.Errorf("unsupported metric %q", opts.Metric)
+	}
+	if opts.M <= 1 {
+		opts.M = DefaultOptions.M
+	}
+	if opts.EfConstruction <= 0 {
+		opts.EfConstruction = DefaultOptions.EfConstruction
+	}
+	if opts.EfSearch <= 0 {
+		opts.EfSearch = DefaultOptions.EfSearch
+	}
+
+	return &Index{
+		opts:      opts,
+		dim:       dim,
+		levelMult: 1 / math.Log(float64(opts.M)),
+		rng:       rand.New(rand.NewSource(opts.Seed)),
+		ids:       make(map[string]uint32),
+		keywords:  newBM25(),
+	}, nil
+}
+
+// Len returns the number of live items
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.ids)
+}
+
+// Tombstones returns the number of deleted items still in the graph
+func (idx *Index) Tombstones() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.nodes) - len(idx.ids)
+}
+
+// Compact returns a new index holding only the live items, without the
+// tombstones deletes and replacements leave behind. The index itself is not
+// changed.
+func (idx *Index) Compact() *Index {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	out := &Index{
+		opts:      idx.opts,
+		dim:       idx.dim,
+		levelMult: idx.levelMult,
+		rng:       rand.New(rand.NewSource(idx.opts.Seed)),
+		ids:       make(map[string]uint32, len(idx.ids)),
+		keywords:  newBM25(),
+	}
+	for _, n := range idx.nodes {
+		if n.Deleted {
+			continue
+		}
+		// Vectors were normalized on insert and are never modified, so they can be shared
+		id := out.insert(&node{ID: n.ID, Vector: n.Vector, Text: n.Text, Metadata: n.Metadata})
+		out.ids[n.ID] = id
+		out.keywords.add(id, n.Text)
+	}
+	return out
+}
+
+// Dimensions returns the vector length of the index, 0 while it is empty
+func (idx *Index) Dimensions() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.dim
+}
+
+// Add inserts items, replacing any existing items with the same IDs
+func (idx *Index) Add(items ...Item) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, item := range items {
+		if idx.dim == 0 {
+			idx.dim = len(item.Vector)
+		}
+		if len(item.Vector) != idx.dim || idx.dim == 0 {
+			return fmt.Errorf("%w: item %q has %d, index has %d", ErrDimensionMismatch, item.ID, len(item.Vector), idx.dim)
+		}
+	}
+
+	for _, item := range items {
+		idx.remove(item.ID)
+
+		vector := item.Vector
+		if idx.opts.Metric == Cosine {
+			vector = normalize(vector)
+		} else {
+			vector = append([]float32(nil), vector...)
+		}
+		id := idx.insert(&node{ID: item.ID, Vector: vector, Text: item.Text, Metadata: item.Metadata})
+		idx.ids[item.ID] = id
+		idx.keywords.add(id, item.Text)
+	}
+	return nil
+}
+
+// Delete removes items by ID. Unknown IDs are ignored.
+func (idx *Index) Delete(ids ...string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, id := range ids {
+		idx.remove(id)
+	}
+}
+
+// remove tombstones a live item; callers hold the write lock
+func (idx *Index) remove(id string) {
+	n, ok := idx.ids[id]
+	if !ok {
+		return
+	}
+	idx.nodes[n].Deleted = true
+	idx.keywords.remove(n, idx.nodes[n].Text)
+	delete(idx.ids, id)
+}
+
+// Search returns the k items most similar to the query vector
+func (idx *Index) Search(query []float32, k int, filter Filter) ([]Result, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	found, err := idx.search(query, k, filter)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(found))
+	for i, c := range found {
+		results[i] = idx.result(c.id)
+		results[i].Score = 1 - c.dist
+		results[i].VectorScore = results[i].Score
+	}
+	return results, nil
+}
+
+// search runs the HNSW query; callers hold the read lock
+func (idx *Index) search(query []float32, k int, filter Filter) ([]candidate, error) {
+	if k <= 0 || len(idx.ids) == 0 {
+		return nil, nil
+	}
+	if len(query) != idx.dim {
+		return nil, fmt.Errorf("%w: query has %d, index has %d", ErrDimensionMismatch, len(query), idx.dim)
+	}
+	if idx.opts.Metric == Cosine {
+		query = normalize(query)
+	}
+
+	visited := acquireVisited(len(idx.nodes))
+	defer visitedPool.Put(visited)
+
+	ep := candidate{idx.entry, idx.distance(query, idx.nodes[idx.entry].Vector)}
+	for level := idx.maxLevel; level > 0; level-- {
+		ep = idx.greedy(query, ep, level)
+	}
+
+	keep := func(n *node) bool { return !n.Deleted && filter.matches(n.Metadata) }
+	found := idx.searchLayer(query, []candidate{ep}, max(idx.opts.EfSearch, k), 0, visited, keep)
+	sort.Slice(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	if len(found) > k {
+		found = found[:k]
+	}
+	return found, nil
+}
+
+// KeywordSearch returns the k items whose text best matches the query by BM25
+func (idx *Index) KeywordSearch(query string, k int, filter Filter) []Result {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	found := idx.keywordSearch(query, k, filter)
+	results := make([]Result, len(found))
+	for i, s := range found {
+		results[i] = idx.result(s.id)
+		results[i].Score = s.score
+		results[i].KeywordScore = s.score
+	}
+	return results
+}
+
+// keywordSearch runs the BM25 query; callers hold the read lock
+func (idx *Index) keywordSearch(query string, k int, filter Filter) []scored {
+	if k <= 0 {
+		return nil
+	}
+	return idx.keywords.search(query, k, len(idx.nodes), func(id uint32) bool {
+		n := idx.nodes[id]
+		return !n.Deleted && filter.matches(n.Metadata)
+	})
+}
+
+// HybridOptions tunes hybrid search
+type HybridOptions struct {
+	Candidates    int     // Results fetched from each retriever before fusion; defaults to 4*k
+	RRFK          float64 // Rank constant of reciprocal rank fusion; defaults to 60
+	VectorWeight  float64 // Defaults to 1
+	KeywordWeight float64 // Defaults to 1
+}
+
+// HybridSearch combines vector similarity and BM25 keyword scoring with
+// reciprocal rank fusion: each item scores the sum of weight/(RRFK+rank)
+// over the rankings it appears in.
+func (idx *Index) HybridSearch(vector []float32, text string, k int, filter Filter, opts HybridOptions) ([]Result, error) {
+	if opts.Candidates < k {
+		opts.Candidates = 4 * k
+	}
+	if opts.RRFK <= 0 {
+		opts.RRFK = 60
+	}
+	if opts.VectorWeight == 0 && opts.KeywordWeight == 0 {
+		opts.VectorWeight, opts.KeywordWeight = 1, 1
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	vectorHits, err := idx.search(vector, opts.Candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+	keywordHits := idx.keywordSearch(text, opts.Candidates, filter)
+
+	fused := make(map[uint32]*Result)
+	get := func(id uint32) *Result {
+		if r, ok := fused[id]; ok {
+			return r
+		}
+		r := idx.result(id)
+		fused[id] = &r
+		return &r
+	}
+	for rank, c := range vectorHits {
+		r := get(c.id)
+		r.VectorScore = 1 - c.dist
+		r.Score += float32(opts.VectorWeight / (opts.RRFK + float64(rank+1)))
+	}
+	for rank, s := range keywordHits {
+		r := get(s.id)
+		r.KeywordScore = s.score
+		r.Score += float32(opts.KeywordWeight / (opts.RRFK + float64(rank+1)))
+	}
+
+	results := make([]Result, 0, len(fused))
+	for _, r := range fused {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// result builds a Result for a node without scores
+func (idx *Index) result(id uint32) Result {
+	n := idx.nodes[id]
+	return Result{ID: n.ID, Text: n.Text, Metadata: n.Metadata}
+}
@@ -0,0 +1,557 @@
+package vectorindex
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clusteredVectors generates vectors around random centroids, which resembles
+// real embeddings more closely than uniform noise
+func clusteredVectors(rng *rand.Rand, n, dim int) [][]float32 {
+	next := clusterGenerator(rng, n, dim)
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = next()
+	}
+	return vectors
+}
+
+// clusterGenerator returns a function generating the vectors of
+// clusteredVectors one at a time, so large benchmarks need not hold them all
+func clusterGenerator(rng *rand.Rand, n, dim int) func() []float32 {
+	centroids := make([][]float32, max(n/1000, 10))
+	for i := range centroids {
+		centroids[i] = make([]float32, dim)
+		for j := range centroids[i] {
+			centroids[i][j] = float32(rng.NormFloat64())
+		}
+	}
+
+	return func() []float32 {
+		c := centroids[rng.Intn(len(centroids))]
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = c[j] + float32(rng.NormFloat64()*0.5)
+		}
+		return v
+	}
+}
+
+// nearbyQueries perturbs random indexed vectors, so queries come from the same
+// distribution as the data
+func nearbyQueries(rng *rand.Rand, vectors [][]float32, n int) [][]float32 {
+	queries := make([][]float32, n)
+	for i := range queries {
+		queries[i] = perturb(rng, vectors[rng.Intn(len(vectors))])
+	}
+	return queries
+}
+
+// perturb returns a noisy copy of a vector
+func perturb(rng *rand.Rand, v []float32) []float32 {
+	out := make([]float32, len(v))
+	for j := range v {
+		out[j] = v[j] + float32(rng.NormFloat64()*0.5)
+	}
+	return out
+}
+
+// bruteForce returns the IDs of the k vectors most similar to the query by cosine
+func bruteForce(vectors [][]float32, query []float32, k int) []string {
+	q := normalize(query)
+	type hit struct {
+		id    int
+		score float32
+	}
+	hits := make([]hit, len(vectors))
+	for i, v := range vectors {
+		hits[i] = hit{i, dot(q, normalize(v))}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+
+	ids := make([]string, k)
+	for i := range ids {
+		ids[i] = strconv.Itoa(hits[i].id)
+	}
+	return ids
+}
+
+// bruteForceIndex is bruteForce over the normalized vectors stored in a
+// cosine index, for benchmarks that do not keep their own copy of the data
+func bruteForceIndex(idx *Index, query []float32, k int) []string {
+	q := normalize(query)
+	type hit struct {
+		id    string
+		score float32
+	}
+	hits := make([]hit, 0, len(idx.nodes))
+	for _, n := range idx.nodes {
+		if !n.Deleted {
+			hits = append(hits, hit{n.ID, dot(q, n.Vector)})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+
+	ids := make([]string, k)
+	for i := range ids {
+		ids[i] = hits[i].id
+	}
+	return ids
+}
+
+// recall is the fraction of the expected IDs present in the results
+func recall(results []Result, expected []string) float64 {
+	want := make(map[string]bool, len(expected))
+	for _, id := range expected {
+		want[id] = true
+	}
+	found := 0
+	for _, r := range results {
+		if want[r.ID] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(expected))
+}
+
+func buildIndex(tb testing.TB, vectors [][]float32, opts Options) *Index {
+	tb.Helper()
+	idx, err := New(0, opts)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i, v := range vectors {
+		item := Item{ID: strconv.Itoa(i), Vector: v, Metadata: map[string]string{"parity": strconv.Itoa(i % 2)}}
+		if err := idx.Add(item); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return idx
+}
+
+func TestSearchRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	vectors := clusteredVectors(rng, 5000, 32)
+	idx := buildIndex(t, vectors, DefaultOptions)
+
+	total := 0.0
+	queries := nearbyQueries(rng, vectors, 50)
+	for _, q := range queries {
+		results, err := idx.Search(q, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += recall(results, bruteForce(vectors, q, 10))
+	}
+	if avg := total / float64(len(queries)); avg < 0.9 {
+		t.Fatalf("recall@10 = %.3f, want at least 0.9", avg)
+	}
+}
+
+func TestFilterAndDelete(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	vectors := clusteredVectors(rng, 1000, 16)
+	idx := buildIndex(t, vectors, DefaultOptions)
+
+	results, err := idx.Search(vectors[3], 20, Filter{"parity": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 20 {
+		t.Fatalf("got %d filtered results, want 20", len(results))
+	}
+	for _, r := range results {
+		if r.Metadata["parity"] != "1" {
+			t.Fatalf("result %s does not match the filter", r.ID)
+		}
+	}
+	if results[0].ID != "3" {
+		t.Fatalf("nearest result = %s, want the query vector itself", results[0].ID)
+	}
+
+	idx.Delete("3")
+	results, _ = idx.Search(vectors[3], 5, nil)
+	for _, r := range results {
+		if r.ID == "3" {
+			t.Fatal("deleted item returned by search")
+		}
+	}
+	if idx.Len() != 999 {
+		t.Fatalf("Len() = %d, want 999", idx.Len())
+	}
+
+	if err := idx.Add(Item{ID: "x", Vector: make([]float32, 8)}); err == nil {
+		t.Fatal("expected a dimension mismatch error")
+	}
+}
+
+func TestDotMetric(t *testing.T) {
+	idx, _ := New(2, Options{Metric: Dot})
+	_ = idx.Add(
+		Item{ID: "small", Vector: []float32{1, 0}},
+		Item{ID: "large", Vector: []float32{5, 0}},
+		Item{ID: "orthogonal", Vector: []float32{0, 9}},
+	)
+	results, _ := idx.Search([]float32{1, 0}, 3, nil)
+	if results[0].ID != "large" || results[0].Score != 5 {
+		t.Fatalf("top result = %s (%.2f), want large (5.00)", results[0].ID, results[0].Score)
+	}
+}
+
+func TestKeywordAndHybridSearch(t *testing.T) {
+	idx, _ := New(3, DefaultOptions)
+	_ = idx.Add(
+		Item{ID: "docker", Vector: []float32{1, 0, 0}, Text: "Docker Model Runner serves models locally"},
+		Item{ID: "grafana", Vector: []float32{0, 1, 0}, Text: "Grafana dashboards show Prometheus metrics"},
+		Item{ID: "jaeger", Vector: []float32{0, 0, 1}, Text: "Jaeger collects traces; traces show latency"},
+	)
+
+	keyword := idx.KeywordSearch("prometheus metrics", 3, nil)
+	if len(keyword) != 1 || keyword[0].ID != "grafana" {
+		t.Fatalf("keyword results = %+v, want only grafana", keyword)
+	}
+
+	// The vector favours docker, the text favours jaeger; both appear in the fused ranking
+	hybrid, err := idx.HybridSearch([]float32{1, 0, 0.1}, "traces latency", 2, nil, HybridOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, r := range hybrid {
+		ids[r.ID] = true
+	}
+	if !ids["docker"] || !ids["jaeger"] {
+		t.Fatalf("hybrid results = %+v, want docker and jaeger", hybrid)
+	}
+}
+
+// bruteForceBM25 scores every live item of the index against the query and
+// returns the k best scores accepted by the filter
+func bruteForceBM25(idx *Index, query string, k int, filter Filter) []float32 {
+	b := idx.keywords
+	docs := float64(len(b.lengths))
+	avgLength := float64(b.totalLength) / docs
+	terms := map[string]bool{}
+	for _, term := range tokenize(query) {
+		terms[term] = true
+	}
+
+	var scores []float32
+	for id, n := range idx.nodes {
+		if n.Deleted || !filter.matches(n.Metadata) {
+			continue
+		}
+		var score float64
+		for term := range terms {
+			tf := float64(b.postings[term][uint32(id)])
+			if tf == 0 {
+				continue
+			}
+			df := float64(len(b.postings[term]))
+			idf := math.Log(1 + (docs-df+0.5)/(df+0.5))
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(b.lengths[uint32(id)])/avgLength)
+			score += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+		if score > 0 {
+			scores = append(scores, float32(score))
+		}
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i] > scores[j] })
+	if len(scores) > k {
+		scores = scores[:k]
+	}
+	return scores
+}
+
+func TestKeywordSearchMatchesExhaustiveScoring(t *testing.T) {
+	// Common words are in most texts, mid ones in about a tenth and rare
+	// ones in about a hundredth, so queries mixing them let the search
+	// skip walking the postings of the more common words
+	rng := rand.New(rand.NewSource(5))
+	words := map[string]float64{"c0": 0.9, "c1": 0.8}
+	for i := 0; i < 5; i++ {
+		words["m"+strconv.Itoa(i)] = 0.1
+	}
+	for i := 0; i < 10; i++ {
+		words["r"+strconv.Itoa(i)] = 0.01
+	}
+	idx, _ := New(2, DefaultOptions)
+	for i := 0; i < 3000; i++ {
+		var text []string
+		for word, p := range words {
+			if rng.Float64() < p {
+				for n := 1 + rng.Intn(3); n > 0; n-- {
+					text = append(text, word)
+				}
+			}
+		}
+		for n := rng.Intn(20); n > 0; n-- {
+			text = append(text, "filler")
+		}
+		err := idx.Add(Item{
+			ID:       strconv.Itoa(i),
+			Vector:   []float32{rng.Float32(), rng.Float32()},
+			Text:     strings.Join(text, " "),
+			Metadata: map[string]string{"parity": strconv.Itoa(i % 2)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3000; i += 7 {
+		idx.Delete(strconv.Itoa(i))
+	}
+
+	queries := []string{"r0 c0", "r5 r6", "r1 m0 c1", "m0 m1", "m2 m3 c0 c1", "r2 r3 c0 c1", "c0 c1", "m4", "r4 r4 unknown"}
+	for _, query := range queries {
+		for _, filter := range []Filter{nil, {"parity": "1"}} {
+			results := idx.KeywordSearch(query, 10, filter)
+			want := bruteForceBM25(idx, query, 10, filter)
+			if len(results) != len(want) {
+				t.Fatalf("%q with %v: %d results, want %d", query, filter, len(results), len(want))
+			}
+			for i, r := range results {
+				if math.Abs(float64(r.Score-want[i])) > 1e-4*float64(want[i]) {
+					t.Fatalf("%q with %v: score %d = %v, want %v", query, filter, i, r.Score, want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	vectors := clusteredVectors(rng, 500, 16)
+	idx := buildIndex(t, vectors, DefaultOptions)
+	idx.Delete("10")
+
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != idx.Len() {
+		t.Fatalf("loaded %d items, want %d", loaded.Len(), idx.Len())
+	}
+
+	want, _ := idx.Search(vectors[42], 10, nil)
+	got, _ := loaded.Search(vectors[42], 10, nil)
+	for i := range want {
+		if want[i].ID != got[i].ID {
+			t.Fatalf("result %d = %s after reload, want %s", i, got[i].ID, want[i].ID)
+		}
+	}
+}
+
+func TestSaveGraphLoadGraph(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	vectors := clusteredVectors(rng, 500, 16)
+	idx := buildIndex(t, vectors, DefaultOptions)
+	idx.Delete("10")
+
+	var buf bytes.Buffer
+	if err := idx.SaveGraph(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatal("Load accepted an index saved without vectors")
+	}
+
+	vector := func(id string) ([]float32, bool) {
+		i, err := strconv.Atoi(id)
+		if err != nil || i >= len(vectors) {
+			return nil, false
+		}
+		return vectors[i], true
+	}
+	loaded, err := LoadGraph(bytes.NewReader(buf.Bytes()), vector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := idx.Search(vectors[42], 10, nil)
+	got, _ := loaded.Search(vectors[42], 10, nil)
+	for i := range want {
+		if want[i].ID != got[i].ID {
+			t.Fatalf("result %d = %s after reload, want %s", i, got[i].ID, want[i].ID)
+		}
+	}
+
+	missing := func(id string) ([]float32, bool) {
+		if id == "7" {
+			return nil, false
+		}
+		return vector(id)
+	}
+	if _, err := LoadGraph(bytes.NewReader(buf.Bytes()), missing); err == nil {
+		t.Fatal("LoadGraph accepted a live item without a vector")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	vectors := clusteredVectors(rng, 300, 16)
+	idx := buildIndex(t, vectors, DefaultOptions)
+	for i := 0; i < 100; i++ {
+		idx.Delete(strconv.Itoa(i))
+	}
+	if idx.Tombstones() != 100 {
+		t.Fatalf("Tombstones() = %d, want 100", idx.Tombstones())
+	}
+
+	compacted := idx.Compact()
+	if compacted.Tombstones() != 0 || compacted.Len() != 200 {
+		t.Fatalf("compacted index has %d items and %d tombstones, want 200 and 0", compacted.Len(), compacted.Tombstones())
+	}
+	if idx.Len() != 200 || idx.Tombstones() != 100 {
+		t.Fatal("Compact changed the original index")
+	}
+	results, _ := compacted.Search(vectors[150], 1, Filter{"parity": "0"})
+	if len(results) != 1 || results[0].ID != "150" {
+		t.Fatalf("nearest result = %+v, want 150", results)
+	}
+	if len(compacted.KeywordSearch("anything", 1, nil)) != 0 {
+		t.Fatal("keyword search matched items without text")
+	}
+}
+
+// Benchmark sizes are configurable so the index can be measured at production
+// scale, e.g. VECTORINDEX_BENCH_SIZE=1000000 VECTORINDEX_BENCH_DIM=384
+func benchConfig() (size, dim int) {
+	size, _ = strconv.Atoi(os.Getenv("VECTORINDEX_BENCH_SIZE"))
+	dim, _ = strconv.Atoi(os.Getenv("VECTORINDEX_BENCH_DIM"))
+	if size <= 0 {
+		size = 10000
+	}
+	if dim <= 0 {
+		dim = 384
+	}
+	return size, dim
+}
+
+var (
+	benchOnce    sync.Once
+	benchIndex   *Index
+	benchQueries [][]float32
+)
+
+// benchSetup builds the benchmark index once and shares it between
+// benchmarks. Vectors are generated as they are added and only the index
+// keeps them, so a 1M x 384 index fits in the memory of a small machine.
+func benchSetup(b *testing.B) {
+	benchOnce.Do(func() {
+		size, dim := benchConfig()
+		rng := rand.New(rand.NewSource(1))
+		next := clusterGenerator(rng, size, dim)
+
+		// Queries perturb random items, picked before the items exist
+		sources := make(map[int]int)
+		for len(sources) < min(100, size) {
+			sources[rng.Intn(size)]++
+		}
+
+		start := time.Now()
+		idx, _ := New(dim, DefaultOptions)
+		for i := 0; i < size; i++ {
+			v := next()
+			for range sources[i] {
+				benchQueries = append(benchQueries, perturb(rng, v))
+			}
+			text := fmt.Sprintf("chunk %d of cluster document %d", i, i%97)
+			_ = idx.Add(Item{ID: strconv.Itoa(i), Vector: v, Text: text, Metadata: map[string]string{"parity": strconv.Itoa(i % 2)}})
+		}
+		built := time.Since(start)
+
+		runtime.GC()
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		b.Logf("built index of %d x %d vectors in %s, heap in use %d MiB",
+			size, dim, built.Round(time.Millisecond), mem.HeapInuse>>20)
+		benchIndex = idx
+	})
+}
+
+func BenchmarkSearch(b *testing.B) {
+	benchSetup(b)
+
+	// Recall is measured against exact search on a sample of queries
+	total := 0.0
+	for _, q := range benchQueries[:20] {
+		results, _ := benchIndex.Search(q, 10, nil)
+		total += recall(results, bruteForceIndex(benchIndex, q, 10))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := benchIndex.Search(benchQueries[i%len(benchQueries)], 10, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(total/20, "recall@10")
+}
+
+func BenchmarkSearchFiltered(b *testing.B) {
+	benchSetup(b)
+	filter := Filter{"parity": "1"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := benchIndex.Search(benchQueries[i%len(benchQueries)], 10, filter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHybridSearch(b *testing.B) {
+	benchSetup(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := benchQueries[i%len(benchQueries)]
+		if _, err := benchIndex.HybridSearch(q, "cluster document 42", 10, nil, HybridOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkHybridSearchCommonTerms searches for words every chunk contains,
+// the worst case for keyword scoring, which cannot skip any of them
+func BenchmarkHybridSearchCommonTerms(b *testing.B) {
+	benchSetup(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := benchQueries[i%len(benchQueries)]
+		if _, err := benchIndex.HybridSearch(q, "cluster document", 10, nil, HybridOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSearchParallel(b *testing.B) {
+	benchSetup(b)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := benchIndex.Search(benchQueries[i%len(benchQueries)], 10, nil); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package vectorindex
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// formatVersion is bumped whenever the snapshot layout changes
+const formatVersion = 1
+
+// snapshot is the persisted form of an index. The keyword index is rebuilt
+// from the node texts on load rather than stored.
+type snapshot struct {
+	Version  int
+	Options  Options
+	Dim      int
+	Nodes    []*node
+	Entry    uint32
+	MaxLevel int
+	External bool // Live nodes were saved without their vectors
+}
+
+// VectorFunc returns the vector of a live item, for indexes saved with
+// SaveGraph
+type VectorFunc func(id string) ([]float32, bool)
+
+// Save writes the index to w
+func (idx *Index) Save(w io.Writer) error {
+	return idx.save(w, false)
+}
+
+// SaveGraph writes the index like Save, but without the vectors of live
+// items. It is for callers that store the vectors themselves and hand them
+// back to LoadGraph, so each vector is persisted once. Deleted items keep
+// their vectors since the graph still routes through them.
+func (idx *Index) SaveGraph(w io.Writer) error {
+	return idx.save(w, true)
+}
+
+func (idx *Index) save(w io.Writer, external bool) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	nodes := idx.nodes
+	if external {
+		nodes = make([]*node, len(idx.nodes))
+		for i, n := range idx.nodes {
+			if n.Deleted {
+				nodes[i] = n
+				continue
+			}
+			stripped := *n
+			stripped.Vector = nil
+			nodes[i] = &stripped
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	err := gob.NewEncoder(bw).Encode(snapshot{
+		Version:  formatVersion,
+		Options:  idx.opts,
+		Dim:      idx.dim,
+		Nodes:    nodes,
+		Entry:    idx.entry,
+		MaxLevel: idx.maxLevel,
+		External: external,
+	})
+	if err != nil {
+		return fmt.Errorf("encode index: %w", err)
+	}
+	return bw.Flush()
+}
+
+// SaveFile writes the index to path atomically, through a temporary file in
+// the same directory
+func (idx *Index) SaveFile(path string) error {
+	return saveFile(path, idx.Save)
+}
+
+// SaveGraphFile writes the index to path like SaveGraph, atomically
+func (idx *Index) SaveGraphFile(path string) error {
+	return saveFile(path, idx.SaveGraph)
+}
+
+func saveFile(path string, save func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := save(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads an index written by Save
+func Load(r io.Reader) (*Index, error) {
+	return load(r, nil)
+}
+
+// LoadGraph reads an index written by Save or SaveGraph, taking the vectors
+// of live items from vector when they were not saved. It fails when vector
+// does not know a live item.
+func LoadGraph(r io.Reader, vector VectorFunc) (*Index, error) {
+	return load(r, vector)
+}
+
+func load(r io.Reader, vector VectorFunc) (*Index, error) {
+	var snap snapshot
+	if err := gob.NewDecoder(bufio.NewReader(r)).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("decode index: %w", err)
+	}
+	if snap.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported index format version %d", snap.Version)
+	}
+	if snap.External && vector == nil {
+		return nil, errors.New("index was saved without vectors")
+	}
+
+	idx := &Index{
+		opts:      snap.Options,
+		dim:       snap.Dim,
+		levelMult: 1 / math.Log(float64(snap.Options.M)),
+		rng:       rand.New(rand.NewSource(snap.Options.Seed + int64(len(snap.Nodes)))),
+		nodes:     snap.Nodes,
+		ids:       make(map[string]uint32, len(snap.Nodes)),
+		entry:     snap.Entry,
+		maxLevel:  snap.MaxLevel,
+		keywords:  newBM25(),
+	}
+	for i, n := range idx.nodes {
+		// gob omits empty slices, so restore the per-level lists
+		for len(n.Neighbors) <= n.Level {
+			n.Neighbors = append(n.Neighbors, nil)
+		}
+		if n.Deleted {
+			continue
+		}
+		if snap.External {
+			v, ok := vector(n.ID)
+			if !ok {
+				return nil, fmt.Errorf("no vector for item %q", n.ID)
+			}
+			if len(v) != idx.dim {
+				return nil, fmt.Errorf("%w: item %q has %d, index has %d", ErrDimensionMismatch, n.ID, len(v), idx.dim)
+			}
+			if idx.opts.Metric == Cosine {
+				n.Vector = normalize(v)
+			} else {
+				n.Vector = append([]float32(nil), v...)
+			}
+		}
+		idx.ids[n.ID] = uint32(i)
+		idx.keywords.add(uint32(i), n.Text)
+	}
+	return idx, nil
+}
+
+// LoadFile reads an index from path
+func LoadFile(path string) (*Index, error) {
+	return LoadGraphFile(path, nil)
+}
+
+// LoadGraphFile reads an index from path like LoadGraph
+func LoadGraphFile(path string, vector VectorFunc) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return load(f, vector)
+}
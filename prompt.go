@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/prompts"
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxTracedPromptBytes bounds the rendered prompt recorded on the trace
+const maxTracedPromptBytes = 4096
+
+// promptSelection picks a system prompt template for a chat request
+type promptSelection struct {
+	TemplateID      string                 `json:"template_id,omitempty"`
+	TemplateVersion int                    `json:"template_version,omitempty"` // 0 selects the latest version
+	Variables       map[string]interface{} `json:"variables,omitempty"`
+}
+
+// renderedPrompt is a system prompt rendered from a template
+type renderedPrompt struct {
+	Template *prompts.Template
+	Text     string
+}
+
+// labels returns the metric labels of the template
+func (p *renderedPrompt) labels() []string {
+	return []string{p.Template.ID, strconv.Itoa(p.Template.Version)}
+}
+
+// renderPrompt renders the selected template and records it on the trace.
+// It returns nil when no template is selected, and the HTTP status to report
+// on failure.
+func renderPrompt(ctx context.Context, library *prompts.Library, sel promptSelection) (*renderedPrompt, int, error) {
+	if sel.TemplateID == "" {
+		return nil, 0, nil
+	}
+
+	tmpl, err := library.Get(sel.TemplateID, sel.TemplateVersion)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	text, err := tmpl.Render(sel.Variables)
+	if errors.Is(err, prompts.ErrInvalidVariables) {
+		return nil, http.StatusBadRequest, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	traced := text
+	if len(traced) > maxTracedPromptBytes {
+		traced = traced[:maxTracedPromptBytes]
+	}
+	tracing.AddAttributes(ctx,
+		attribute.String("prompt.template.id", tmpl.ID),
+		attribute.Int("prompt.template.version", tmpl.Version),
+		attribute.String("prompt.rendered", traced),
+	)
+
+	rendered := &renderedPrompt{Template: tmpl, Text: text}
+	promptTemplateCounter.WithLabelValues(rendered.labels()...).Inc()
+	return rendered, 0, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/cache"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// promptCacheOptions configures prompt cache reuse on llama.cpp. The server
+// keeps the KV cache of the last prompt in each slot and only evaluates what
+// follows the prefix a new prompt shares with it, so routing a conversation
+// back to the same slot skips re-reading its history.
+type promptCacheOptions struct {
+	Mode  string        // "on", "off", or "auto" for llama.cpp servers only
+	Slots *slotAffinity // Pins conversations to slots; nil sends no slot
+}
+
+// enabled reports whether requests to the server at baseURL ask it to reuse
+// its prompt cache
+func (o promptCacheOptions) enabled(baseURL string) bool {
+	return o.Mode == "on" || (o.Mode == "auto" && strings.Contains(baseURL, "llama.cpp"))
+}
+
+// requestOptions returns the llama.cpp fields that reuse the prompt cache of
+// the slot, or of any slot when slot is negative
+func (o promptCacheOptions) requestOptions(slot int) []option.RequestOption {
+	opts := []option.RequestOption{option.WithJSONSet("cache_prompt", true)}
+	if slot >= 0 {
+		opts = append(opts, option.WithJSONSet("id_slot", slot))
+	}
+	return opts
+}
+
+// affinityKey identifies the conversation a request continues. Stored
+// conversations have an ID; clients that send the history themselves are
+// told apart by the user and the first question.
+func affinityKey(req ChatRequest, history []Message, user string) string {
+	if req.ConversationID != "" {
+		return "conversation:" + req.ConversationID
+	}
+	first := req.Message
+	for _, msg := range history {
+		if msg.Role == "user" {
+			first = msg.Content
+			break
+		}
+	}
+	return "history:" + cache.Key([]string{user, normalizeContent(first)})
+}
+
+// slotAffinity assigns conversations to server slots. A new conversation
+// takes an idle slot, the one used least recently, which evicts the prompt
+// cache of the conversation that has been idle longest. When every slot is
+// generating it takes the one with the fewest generations.
+type slotAffinity struct {
+	maxConversations int
+
+	mu       sync.Mutex
+	lastUsed []time.Time              // By slot
+	inFlight []int                    // Generations running, by slot
+	lru      *list.List               // Most recently used conversations first
+	owners   map[string]*list.Element // Values are *slotOwner
+}
+
+// slotOwner is a conversation and the slot holding its prompt cache
+type slotOwner struct {
+	key  string
+	slot int
+}
+
+// newSlotAffinity creates a table for a server with the given number of
+// slots, remembering up to maxConversations conversations
+func newSlotAffinity(slots, maxConversations int) *slotAffinity {
+	if maxConversations <= 0 {
+		maxConversations = 10000
+	}
+	return &slotAffinity{
+		maxConversations: maxConversations,
+		lastUsed:         make([]time.Time, slots),
+		inFlight:         make([]int, slots),
+		lru:              list.New(),
+		owners:           make(map[string]*list.Element),
+	}
+}
+
+// assign returns the slot of the conversation and whether it had one
+// already. Conversations whose slot was taken over since start afresh. The
+// slot counts as busy until release is called, when the generation ends.
+func (a *slotAffinity) assign(key string) (slot int, reused bool, release func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if el, ok := a.owners[key]; ok {
+		owner := el.Value.(*slotOwner)
+		a.lru.MoveToFront(el)
+		return owner.slot, true, a.acquire(owner.slot)
+	}
+
+	slot = 0
+	for i := range a.lastUsed {
+		if a.inFlight[i] < a.inFlight[slot] ||
+			(a.inFlight[i] == a.inFlight[slot] && a.lastUsed[i].Before(a.lastUsed[slot])) {
+			slot = i
+		}
+	}
+	// The slot's previous conversation loses its cache, so it is assigned
+	// again on its next turn
+	for el := a.lru.Front(); el != nil; el = el.Next() {
+		if owner := el.Value.(*slotOwner); owner.slot == slot {
+			a.lru.Remove(el)
+			delete(a.owners, owner.key)
+			break
+		}
+	}
+	a.owners[key] = a.lru.PushFront(&slotOwner{key: key, slot: slot})
+	for a.lru.Len() > a.maxConversations {
+		a.removeOldest()
+	}
+	return slot, false, a.acquire(slot)
+}
+
+// acquire marks a generation as running on the slot and returns the
+// function that ends it. Call with a.mu held.
+func (a *slotAffinity) acquire(slot int) func() {
+	a.inFlight[slot]++
+	a.lastUsed[slot] = time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.inFlight[slot]--
+			a.lastUsed[slot] = time.Now()
+		})
+	}
+}
+
+func (a *slotAffinity) removeOldest() {
+	el := a.lru.Back()
+	a.lru.Remove(el)
+	delete(a.owners, el.Value.(*slotOwner).key)
+}
+
+// llamaTimings is the part of the timings llama.cpp adds to the last chunk
+// of a stream that counts prompt tokens
+type llamaTimings struct {
+	CacheN  int64 `json:"cache_n"`  // Reused from the slot's prompt cache
+	PromptN int64 `json:"prompt_n"` // Evaluated
+}
+
+// promptTokens returns how many prompt tokens were reused from the prompt
+// cache and how many were evaluated, from llama.cpp timings or, failing
+// that, the usage OpenAI-compatible servers report
+func promptTokens(chunk openai.ChatCompletionChunk) (cached, evaluated int64, ok bool) {
+	if field, found := chunk.JSON.ExtraFields["timings"]; found {
+		var timings llamaTimings
+		if err := json.Unmarshal([]byte(field.Raw()), &timings); err == nil {
+			return timings.CacheN, timings.PromptN, true
+		}
+	}
+	if usage := chunk.Usage; usage.PromptTokens > 0 {
+		cached := usage.PromptTokensDetails.CachedTokens
+		return cached, usage.PromptTokens - cached, true
+	}
+	return 0, 0, false
+}
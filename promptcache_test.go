@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// assign assigns a conversation a slot and checks the result, leaving a
+// moment before the next call so slots are never used at the same instant
+func assign(t *testing.T, a *slotAffinity, key string, wantSlot int, wantReused bool) func() {
+	t.Helper()
+	slot, reused, release := a.assign(key)
+	if slot != wantSlot || reused != wantReused {
+		t.Fatalf("assign(%s) = slot %d, reused %t, want slot %d, reused %t", key, slot, reused, wantSlot, wantReused)
+	}
+	time.Sleep(time.Millisecond)
+	return release
+}
+
+func TestSlotAffinity(t *testing.T) {
+	a := newSlotAffinity(2, 0)
+
+	releaseA := assign(t, a, "a", 0, false)
+	// Slot 0 is generating, so the next conversation takes the idle slot
+	releaseB := assign(t, a, "b", 1, false)
+	releaseA()
+
+	// A conversation comes back to its slot
+	assign(t, a, "a", 0, true)()
+	releaseB()
+	assign(t, a, "b", 1, true)()
+
+	// With both slots idle, a new conversation evicts the one idle longest
+	releaseC := assign(t, a, "c", 0, false)
+	assign(t, a, "a", 1, false)() // a lost slot 0, and now takes b's
+	assign(t, a, "b", 1, false)() // c is still generating on slot 0
+	releaseC()
+	assign(t, a, "c", 0, true)()
+}
+
+func TestSlotAffinityBusySlots(t *testing.T) {
+	a := newSlotAffinity(2, 0)
+	// Every slot is generating: a new conversation goes to the one with the fewest
+	release := assign(t, a, "a", 0, false)
+	assign(t, a, "b", 1, false)
+	assign(t, a, "a", 0, true)
+	assign(t, a, "c", 1, false)
+	if a.inFlight[0] != 2 || a.inFlight[1] != 2 {
+		t.Fatalf("inFlight = %v, want 2 on each slot", a.inFlight)
+	}
+
+	// Releasing twice does not end the other generation on the slot
+	release()
+	release()
+	if a.inFlight[0] != 1 {
+		t.Fatalf("inFlight = %v, want 1 on slot 0", a.inFlight)
+	}
+	assign(t, a, "d", 0, false)
+}
+
+func TestSlotAffinityForgetsConversations(t *testing.T) {
+	a := newSlotAffinity(4, 2)
+	assign(t, a, "a", 0, false)()
+	assign(t, a, "b", 1, false)()
+	assign(t, a, "c", 2, false)()
+	// Only the two most recent conversations are remembered
+	assign(t, a, "a", 3, false)()
+	assign(t, a, "c", 2, true)()
+}
+
+func TestAffinityKey(t *testing.T) {
+	stored := affinityKey(ChatRequest{ConversationID: "42", Message: "Hi"}, nil, "alice")
+	if stored != "conversation:42" {
+		t.Fatalf("key of a stored conversation = %s", stored)
+	}
+
+	// Later turns of a conversation sent with its history keep the first turn's key
+	first := affinityKey(ChatRequest{Message: "What is Docker?"}, nil, "alice")
+	history := []Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "What is Docker?  \r\n"},
+		{Role: "assistant", Content: "A container platform."},
+	}
+	if later := affinityKey(ChatRequest{Message: "And Compose?"}, history, "alice"); later != first {
+		t.Fatalf("later turn key = %s, want the first turn's %s", later, first)
+	}
+	if other := affinityKey(ChatRequest{Message: "What is Docker?"}, nil, "bob"); other == first {
+		t.Fatal("different users share a key")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/identity"
+	"github.com/ajeetraina/genai-app-demo/pkg/modelrunner"
+	"github.com/ajeetraina/genai-app-demo/pkg/models"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// provider is the inference server configuration chat requests run against.
+// It is never modified: a change builds a new provider and swaps it in, so a
+// request keeps using the snapshot it started with until it finishes.
+type provider struct {
+	Version      int64
+	Client       *openai.Client
+	BaseURL      string
+	APIKey       string
+	DefaultModel string
+	UpdatedAt    time.Time
+	UpdatedBy    string
+}
+
+// newProvider builds a provider and its client
+func newProvider(version int64, baseURL, apiKey, defaultModel, updatedBy string) *provider {
+	return &provider{
+		Version: version,
+		Client: openai.NewClient(
+			option.WithBaseURL(baseURL),
+			option.WithAPIKey(apiKey),
+		),
+		BaseURL:      baseURL,
+		APIKey:       apiKey,
+		DefaultModel: defaultModel,
+		UpdatedAt:    time.Now().UTC(),
+		UpdatedBy:    updatedBy,
+	}
+}
+
+// runtimeConfig is the provider configuration shown by and accepted by the
+// admin endpoint. The API key is write-only.
+type runtimeConfig struct {
+	Version      int64     `json:"version"`
+	BaseURL      string    `json:"base_url"`
+	DefaultModel string    `json:"default_model"`
+	APIKeySet    bool      `json:"api_key_set"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	UpdatedBy    string    `json:"updated_by,omitempty"`
+}
+
+// configUpdate changes some of the provider settings; omitted fields keep
+// their current value
+type configUpdate struct {
+	BaseURL      *string `json:"base_url"`
+	APIKey       *string `json:"api_key"`
+	DefaultModel *string `json:"default_model"`
+}
+
+// adminHandler switches the provider at runtime
+type adminHandler struct {
+	current *atomic.Pointer[provider]
+	catalog *models.Catalog
+	token   string // Bearer token required by the admin endpoints; disabled when empty
+
+	mu sync.Mutex // Serializes updates
+}
+
+// Register adds the admin routes to the mux
+func (h *adminHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/config", h.authorize(http.HandlerFunc(h.handleGetConfig)))
+	mux.HandleFunc("PUT /admin/config", h.authorize(http.HandlerFunc(h.handleUpdateConfig)))
+}
+
+// authorize requires the admin token. Without a configured token the admin
+// endpoints do not exist.
+func (h *adminHandler) authorize(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+func (h *adminHandler) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(describeProvider(h.current.Load()))
+}
+
+// handleUpdateConfig builds a provider from the current one and the update
+// and swaps it in. Requests already streaming finish on the old provider.
+func (h *adminHandler) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
+	var update configUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old := h.current.Load()
+
+	baseURL, apiKey, defaultModel := old.BaseURL, old.APIKey, old.DefaultModel
+	if update.BaseURL != nil {
+		u, err := url.Parse(*update.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "base_url must be an http or https URL", http.StatusBadRequest)
+			return
+		}
+		baseURL = *update.BaseURL
+	}
+	if update.APIKey != nil {
+		apiKey = *update.APIKey
+	}
+	if update.DefaultModel != nil {
+		model, err := h.catalog.SetDefault(*update.DefaultModel)
+		if errors.Is(err, models.ErrUnknownModel) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defaultModel = model.Name
+	}
+
+	next := newProvider(old.Version+1, baseURL, apiKey, defaultModel, identity.UserID(r))
+	h.current.Store(next)
+	configVersionGauge.Set(float64(next.Version))
+
+	log.Printf("Runtime config changed to version %d by %q: base URL %s -> %s, default model %s -> %s, API key changed: %t",
+		next.Version, next.UpdatedBy, old.BaseURL, next.BaseURL, old.DefaultModel, next.DefaultModel, next.APIKey != old.APIKey)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(describeProvider(next))
+}
+
+func describeProvider(p *provider) runtimeConfig {
+	return runtimeConfig{
+		Version:      p.Version,
+		BaseURL:      p.BaseURL,
+		DefaultModel: p.DefaultModel,
+		APIKeySet:    p.APIKey != "",
+		UpdatedAt:    p.UpdatedAt,
+		UpdatedBy:    p.UpdatedBy,
+	}
+}
+
+// runnerHandler serves the Model Runner management API of the runner behind
+// the current provider. It answers 404 while the provider is not a runner.
+type runnerHandler struct {
+	url     string // Fixed runner URL; derived from the provider's base URL when empty
+	current *atomic.Pointer[provider]
+
+	mu      sync.Mutex
+	lastURL string
+	mux     *http.ServeMux // Routes for lastURL
+}
+
+func (h *runnerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	runnerURL, ok := h.url, true
+	if runnerURL == "" {
+		runnerURL, ok = modelrunner.BaseURL(h.current.Load().BaseURL)
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	h.routes(runnerURL).ServeHTTP(w, r)
+}
+
+// routes returns the management routes for the runner, rebuilding them when
+// the runner URL has changed
+func (h *runnerHandler) routes(runnerURL string) *http.ServeMux {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.mux == nil || h.lastURL != runnerURL {
+		h.mux = http.NewServeMux()
+		modelrunner.NewHandler(modelrunner.New(runnerURL, nil)).Register(h.mux)
+		h.lastURL = runnerURL
+		log.Printf("Model Runner management API at %s", runnerURL)
+	}
+	return h.mux
+}
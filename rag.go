@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/ingest"
+)
+
+// maxTopK bounds the number of chunks a request may pull into the prompt
+const maxTopK = 20
+
+// defaultRAGTemplate numbers the retrieved chunks so the model can cite them
+// as [n]; the citations event maps those markers back to the chunks
+const defaultRAGTemplate = `Answer the user's question using the numbered sources below. After each sentence that uses a source, cite it with its number in square brackets, for example [1] or [1][3]. If the sources do not contain the answer, say so instead of guessing.
+
+{{range .Sources}}[{{.Number}}] {{.Filename}}{{if .Heading}} - {{.Heading}}{{end}}
+{{.Text}}
+
+{{end}}`
+
+// ragService retrieves chunks from document collections and renders them
+// into a system prompt
+type ragService struct {
+	retriever *ingest.Retriever
+	prompt    *template.Template
+	topK      int
+}
+
+// ragSource is a retrieved chunk as seen by the prompt template
+type ragSource struct {
+	Number   int
+	Filename string
+	Heading  string
+	Text     string
+}
+
+// newRAGService parses the prompt template, read from templatePath when set
+func newRAGService(retriever *ingest.Retriever, templatePath string, topK int) (*ragService, error) {
+	text := defaultRAGTemplate
+	if templatePath != "" {
+		data, err := os.ReadFile(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RAG prompt template: %w", err)
+		}
+		text = string(data)
+	}
+	prompt, err := template.New("rag").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse RAG prompt template: %w", err)
+	}
+
+	if topK <= 0 || topK > maxTopK {
+		topK = 4
+	}
+	return &ragService{retriever: retriever, prompt: prompt, topK: topK}, nil
+}
+
+// prepare retrieves the chunks relevant to the request and renders the system
+// prompt, writing the error response and returning false on failure
+func (s *ragService) prepare(w http.ResponseWriter, r *http.Request, req ChatRequest, history []Message) ([]ingest.Hit, string, bool) {
+	if req.TopK < 0 || req.TopK > maxTopK {
+		http.Error(w, fmt.Sprintf("top_k must be between 1 and %d", maxTopK), http.StatusBadRequest)
+		return nil, "", false
+	}
+	topK := req.TopK
+	if topK == 0 {
+		topK = s.topK
+	}
+
+	// The query is the new message, or the last user turn when replying to history
+	query := req.Message
+	for i := len(history) - 1; query == "" && i >= 0; i-- {
+		if history[i].Role == "user" {
+			query = history[i].Content
+		}
+	}
+	if query == "" {
+		http.Error(w, "A message is required for retrieval", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	hits, err := s.retriever.Retrieve(r.Context(), uniqueCollections(req.Collections), query, topK)
+	switch {
+	case errors.Is(err, ingest.ErrCollectionNotFound):
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return nil, "", false
+	case errors.Is(err, ingest.ErrEmbedding):
+		log.Printf("Retrieval failed: %v", err)
+		http.Error(w, "Failed to embed the query", http.StatusBadGateway)
+		return nil, "", false
+	case err != nil:
+		log.Printf("Retrieval failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, "", false
+	}
+
+	sources := make([]ragSource, len(hits))
+	for i, hit := range hits {
+		sources[i] = ragSource{Number: i + 1, Filename: hit.Filename, Heading: hit.Heading, Text: hit.Text}
+	}
+	var prompt strings.Builder
+	if err := s.prompt.Execute(&prompt, struct {
+		Question string
+		Sources  []ragSource
+	}{query, sources}); err != nil {
+		log.Printf("Failed to render RAG prompt: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, "", false
+	}
+	return hits, prompt.String(), true
+}
+
+// uniqueCollections drops repeated collection names, keeping the first of
+// each, so a collection is not searched twice and its chunks not cited twice
+func uniqueCollections(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// citationSource describes a retrieved chunk in the citations event
+type citationSource struct {
+	Source     int     `json:"source"` // The number the model cites as [n]
+	Collection string  `json:"collection"`
+	DocumentID string  `json:"document_id"`
+	Filename   string  `json:"filename"`
+	ChunkIndex int     `json:"chunk_index"`
+	Start      int     `json:"start"` // Byte offsets of the chunk in the document text
+	End        int     `json:"end"`
+	Heading    string  `json:"heading,omitempty"`
+	Score      float32 `json:"score"`
+}
+
+// citation maps a span of the answer to the source it cites
+type citation struct {
+	AnswerStart int    `json:"answer_start"` // Byte offsets of the cited span in the reply
+	AnswerEnd   int    `json:"answer_end"`
+	Source      int    `json:"source"`
+	Collection  string `json:"collection"`
+	DocumentID  string `json:"document_id"`
+	Filename    string `json:"filename"`
+	ChunkIndex  int    `json:"chunk_index"`
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+}
+
+// citations is the payload of the citations event
+type citations struct {
+	Sources   []citationSource `json:"sources"`
+	Citations []citation       `json:"citations"`
+}
+
+// citationMarker matches [1] and [1, 3]
+var citationMarker = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// newCitations finds the [n] markers in the reply. Each marker cites the
+// sentence it follows; adjacent markers such as [1][2] share one span.
+// Numbers that do not refer to a retrieved source are ignored.
+func newCitations(reply string, hits []ingest.Hit) citations {
+	result := citations{Sources: make([]citationSource, len(hits)), Citations: []citation{}}
+	for i, hit := range hits {
+		result.Sources[i] = citationSource{
+			Source:     i + 1,
+			Collection: hit.Collection,
+			DocumentID: hit.DocumentID,
+			Filename:   hit.Filename,
+			ChunkIndex: hit.ChunkIndex,
+			Start:      hit.Start,
+			End:        hit.End,
+			Heading:    hit.Heading,
+			Score:      hit.Score,
+		}
+	}
+
+	spanStart, spanEnd, lastMarker := 0, 0, 0
+	for _, m := range citationMarker.FindAllStringSubmatchIndex(reply, -1) {
+		if strings.TrimSpace(reply[lastMarker:m[0]]) != "" || lastMarker == 0 {
+			spanStart, spanEnd = sentenceBefore(reply, lastMarker, m[0])
+		}
+		lastMarker = m[1]
+
+		for _, field := range strings.Split(reply[m[2]:m[3]], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || n < 1 || n > len(hits) {
+				continue
+			}
+			hit := hits[n-1]
+			result.Citations = append(result.Citations, citation{
+				AnswerStart: spanStart,
+				AnswerEnd:   spanEnd,
+				Source:      n,
+				Collection:  hit.Collection,
+				DocumentID:  hit.DocumentID,
+				Filename:    hit.Filename,
+				ChunkIndex:  hit.ChunkIndex,
+				Start:       hit.Start,
+				End:         hit.End,
+			})
+		}
+	}
+	return result
+}
+
+// sentenceBefore returns the span of the sentence ending at end, searching no
+// further back than from. Trailing whitespace and sentence punctuation before
+// the marker belong to the cited sentence.
+func sentenceBefore(reply string, from, end int) (int, int) {
+	end = from + len(strings.TrimRight(reply[from:end], " \t\n"))
+	content := strings.TrimRight(reply[from:end], ".!?")
+	start := from + strings.LastIndexAny(content, ".!?\n") + 1
+	for start < end && strings.ContainsRune(" \t\n", rune(reply[start])) {
+		start++
+	}
+	return start, end
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/cache"
+	"github.com/ajeetraina/genai-app-demo/pkg/ingest"
+	"github.com/ajeetraina/genai-app-demo/pkg/models"
+	"github.com/openai/openai-go"
+)
+
+// samplingParams are the generation parameters sent with a request: the
+// model defaults, overridden by the request
+type samplingParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens   int64    `json:"max_tokens,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+// newSamplingParams merges the model defaults with the request parameters
+func newSamplingParams(defaults models.Defaults, req ChatRequest) samplingParams {
+	params := samplingParams{
+		Temperature: defaults.Temperature,
+		TopP:        defaults.TopP,
+		MaxTokens:   defaults.MaxTokens,
+		Seed:        req.Seed,
+	}
+	if req.Temperature != nil {
+		params.Temperature = req.Temperature
+	}
+	return params
+}
+
+// apply sets the parameters on a completion request
+func (p samplingParams) apply(param *openai.ChatCompletionNewParams) {
+	if p.Temperature != nil {
+		param.Temperature = openai.F(*p.Temperature)
+	}
+	if p.TopP != nil {
+		param.TopP = openai.F(*p.TopP)
+	}
+	if p.MaxTokens > 0 {
+		param.MaxTokens = openai.F(p.MaxTokens)
+	}
+	if p.Seed != nil {
+		param.Seed = openai.F(*p.Seed)
+	}
+}
+
+// deterministic reports whether the same prompt gets the same reply, which is
+// when sampling is greedy or seeded
+func (p samplingParams) deterministic() bool {
+	return p.Seed != nil || (p.Temperature != nil && *p.Temperature == 0)
+}
+
+// responseCacheOptions configures the exact response cache
+type responseCacheOptions struct {
+	Cache       *cache.Cache  // Disabled when nil
+	ReplayDelay time.Duration // Pause between the chunks of a replayed reply
+}
+
+// semanticCacheOptions configures the semantic cache
+type semanticCacheOptions struct {
+	Cache          *cache.Semantic // Disabled when nil
+	Embedder       ingest.Embedder
+	EmbeddingModel string
+	DisabledRoutes map[string]bool // Route patterns without the method, such as /chat
+}
+
+// applies reports whether a request can be answered from the semantic
+// cache: a single question without tools, on a route that has not opted out
+func (o semanticCacheOptions) applies(r *http.Request, req ChatRequest, history []Message, tools int) bool {
+	if o.Cache == nil || tools > 0 || req.bypassCache || req.Message == "" {
+		return false
+	}
+	_, route, found := strings.Cut(r.Pattern, " ")
+	if !found {
+		route = r.Pattern
+	}
+	if o.DisabledRoutes[route] {
+		return false
+	}
+	// Earlier turns change what a question means
+	for _, msg := range history {
+		if msg.Role != "system" {
+			return false
+		}
+	}
+	return true
+}
+
+// semanticScope keeps apart questions whose answers differ for reasons other
+// than the question: the tenant, the model and the prompt around it
+func semanticScope(tenant, model string, req ChatRequest) string {
+	collections := append([]string(nil), req.Collections...)
+	sort.Strings(collections)
+	return cache.Key(struct {
+		Tenant      string          `json:"tenant"`
+		Model       string          `json:"model"`
+		Format      responseFormat  `json:"format"`
+		Prompt      promptSelection `json:"prompt"`
+		Collections []string        `json:"collections"`
+	}{tenant, model, req.Format, req.promptSelection, collections})
+}
+
+// cachedEvent is the payload of the cached event sent before a cached reply
+type cachedEvent struct {
+	Cached     string  `json:"cached"`             // "exact" or "semantic"
+	EntryID    string  `json:"entry_id,omitempty"` // Semantic entry to send feedback on
+	Similarity float64 `json:"similarity,omitempty"`
+}
+
+// cacheKey is everything a cached reply must share with a new request. Tools
+// are never part of it since requests offering tools are not cached.
+type cacheKey struct {
+	BaseURL  string         `json:"base_url"`
+	Model    string         `json:"model"`
+	Messages []Message      `json:"messages"`
+	Sampling samplingParams `json:"sampling"`
+	Format   responseFormat `json:"format"`
+}
+
+// key hashes the request after normalizing the messages
+func (k cacheKey) key() string {
+	normalized := k
+	normalized.Messages = make([]Message, len(k.Messages))
+	for i, msg := range k.Messages {
+		normalized.Messages[i] = Message{Role: msg.Role, Content: normalizeContent(msg.Content)}
+	}
+	return cache.Key(normalized)
+}
+
+// normalizeContent ignores differences that do not change what was asked:
+// line endings, and whitespace around the content and at line ends
+func normalizeContent(content string) string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// serveCached marks the response as cached, with how it matched, and
+// replays the reply
+func serveCached(stream *chatStream, r *http.Request, event cachedEvent, reply string, delay time.Duration, start time.Time) error {
+	stream.w.Header().Set("X-Cache", "HIT")
+	stream.w.Header().Set("X-Cache-Match", event.Cached)
+	if event.EntryID != "" {
+		stream.w.Header().Set("X-Cache-Entry", event.EntryID)
+	}
+	stream.Event("cached", event)
+	if err := replayReply(stream, reply, delay); err != nil {
+		log.Printf("Error writing to stream: %v", err)
+		return err
+	}
+	requestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(time.Since(start).Seconds())
+	requestCounter.WithLabelValues(r.Method, r.URL.Path, "200").Inc()
+	return nil
+}
+
+// replayReply streams a cached reply the way a model would, a word at a time
+func replayReply(stream *chatStream, reply string, delay time.Duration) error {
+	for i, chunk := range splitWords(reply) {
+		if i > 0 && delay > 0 {
+			time.Sleep(delay)
+		}
+		if err := stream.Text(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitWords splits text into words, each with the whitespace that follows it
+func splitWords(text string) []string {
+	var chunks []string
+	start, inSpace := 0, false
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if inSpace && !space {
+			chunks = append(chunks, text[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(text) {
+		chunks = append(chunks, text[start:])
+	}
+	return chunks
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chatWriter receives a reply as it is generated
+type chatWriter interface {
+	Text(content string) error
+	Event(name string, data interface{}) error
+	Error(message string, status int)
+}
+
+// chatStream writes a chat reply to the client. By default the reply is
+// streamed as plain text, which is what existing clients read. Clients that
+// send "Accept: text/event-stream" get Server-Sent Events instead: reply text
+// arrives as unnamed events carrying {"content": ...}, and side channels such
+// as citations arrive as named events. Named events are dropped for plain
+// text clients. Responses that frame messages themselves, such as WebSocket
+// generations, get the reply and events as they are.
+type chatStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	sse     bool
+	nextID  int         // Last SSE event ID
+	wrote   bool        // Whether any of the body has been written
+	frames  chatWriter  // Set when the response frames messages itself
+	gen     *generation // Keeps the events for clients that resume; nil when not tracked
+	gone    error       // Why writing to the client failed
+	failed  bool        // Whether an error was reported
+	route   string      // Pattern of the route, for metrics
+	opened  bool        // Whether the generation event was sent
+
+	mu            sync.Mutex // Serializes writes with the heartbeat
+	active        bool       // Whether anything was written since the last heartbeat
+	stopHeartbeat func()     // Stops the heartbeat; nil when none is running
+}
+
+// newChatStream prepares the response headers for streaming
+func newChatStream(w http.ResponseWriter, r *http.Request) *chatStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	flusher, _ := w.(http.Flusher)
+	return &chatStream{
+		w:       w,
+		flusher: flusher,
+		sse:     strings.Contains(r.Header.Get("Accept"), "text/event-stream"),
+		frames:  framesOf(w),
+		route:   r.Pattern,
+	}
+}
+
+// framesOf returns the response that frames messages itself, looking through
+// middleware that wraps it, or nil when there is none
+func framesOf(w http.ResponseWriter) chatWriter {
+	for {
+		if frames, ok := w.(chatWriter); ok {
+			return frames
+		}
+		wrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = wrapper.Unwrap()
+	}
+}
+
+// Text streams a piece of the reply
+func (s *chatStream) Text(content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.frames != nil {
+		s.record("", map[string]string{"content": content})
+		s.wrote = true
+		return s.frames.Text(content)
+	}
+	if !s.sse {
+		s.record("", map[string]string{"content": content})
+		s.wrote = true
+		return s.deliver(func() error {
+			_, err := fmt.Fprint(s.w, content)
+			return err
+		})
+	}
+	return s.write("", map[string]string{"content": content})
+}
+
+// Event sends a named event with a JSON payload to SSE clients
+func (s *chatStream) Event(name string, data interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.event(name, data)
+}
+
+func (s *chatStream) event(name string, data interface{}) error {
+	if s.frames != nil {
+		s.record(name, data)
+		s.wrote = true
+		return s.frames.Event(name, data)
+	}
+	if !s.sse {
+		s.record(name, data)
+		return nil
+	}
+	return s.write(name, data)
+}
+
+// Done tells SSE clients that the reply is complete
+func (s *chatStream) Done() error {
+	return s.Event("done", struct{}{})
+}
+
+// Error reports a failure. Before anything was streamed, and always for
+// plain text clients, the message is written with http.Error; SSE clients
+// that already received events get an error event instead. Framed responses
+// always get the error as a message. A cancelled generation reports why
+// rather than the error the cancellation caused.
+func (s *chatStream) Error(message string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	if s.gen != nil {
+		if cause := s.gen.cancelled(); cause != nil {
+			message = cause.Error()
+		}
+	}
+	if s.frames != nil {
+		s.record("error", map[string]string{"message": message})
+		s.frames.Error(message, status)
+		return
+	}
+	if !s.sse || !s.wrote {
+		s.record("error", map[string]string{"message": message})
+		s.deliver(func() error {
+			http.Error(s.w, message, status)
+			return nil
+		})
+		s.wrote = true
+		return
+	}
+	s.event("error", map[string]string{"message": message})
+}
+
+// heartbeat sends an SSE comment every interval in which nothing else was
+// sent, so proxies do not drop the connection while the model reads a long
+// prompt, a tool runs or an approval is pending. Headers cannot change once
+// it runs, as the first heartbeat sends them. Plain text clients get none,
+// as a comment would corrupt the reply.
+func (s *chatStream) heartbeat(interval time.Duration) {
+	if !s.sse || s.frames != nil || interval <= 0 || s.stopHeartbeat != nil {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	s.stopHeartbeat = func() {
+		close(stop)
+		<-done
+	}
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if !s.beat() {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// beat sends a heartbeat unless something else was sent since the last one,
+// and reports whether the client is still there
+func (s *chatStream) beat() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active {
+		// The status is sent with the first heartbeat, so later
+		// errors become error events
+		s.open()
+		s.wrote = true
+		s.deliver(func() error {
+			_, err := io.WriteString(s.w, ": heartbeat\n\n")
+			return err
+		})
+	}
+	s.active = false
+	return s.gone == nil
+}
+
+// finish stops the heartbeat and ends the stream's generation, if it has one
+func (s *chatStream) finish() {
+	if s.stopHeartbeat != nil {
+		s.stopHeartbeat()
+		s.stopHeartbeat = nil
+	}
+	if s.gen == nil {
+		return
+	}
+	outcome := outcomeCompleted
+	if s.failed {
+		outcome = outcomeFailed
+	}
+	s.gen.finish(outcome)
+}
+
+// record keeps an event written some other way than SSE for clients that
+// resume the generation, under the ID SSE would have given it
+func (s *chatStream) record(name string, data interface{}) {
+	if s.gen == nil {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	s.nextID++
+	s.gen.record(s.nextID, name, payload)
+}
+
+// write sends one SSE event with an incrementing ID
+func (s *chatStream) write(name string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.open()
+	s.nextID++
+	s.wrote = true
+	if s.gen != nil {
+		s.gen.record(s.nextID, name, payload)
+	}
+	return s.deliver(func() error {
+		return writeEvent(s.w, s.nextID, name, payload)
+	})
+}
+
+// open sends SSE clients the ID of their generation as the first event, so
+// they can cancel or resume it without reading headers
+func (s *chatStream) open() {
+	if s.opened || s.gen == nil {
+		return
+	}
+	s.opened = true
+	s.write("generation", map[string]string{"id": s.gen.ID})
+}
+
+// deliver writes to the client and flushes. Once a write fails the client
+// is taken to be gone: a generation carries on without it so it can be
+// resumed, otherwise the error stops the reply.
+func (s *chatStream) deliver(write func() error) error {
+	s.active = true
+	if s.gone == nil {
+		if s.gone = write(); s.gone == nil {
+			s.flush()
+			return nil
+		}
+		countStreamTimeout(s.route, s.gone)
+	}
+	if s.gen != nil {
+		return nil
+	}
+	return s.gone
+}
+
+func (s *chatStream) flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	stream, w := newTestStream("text/event-stream")
+	stream.heartbeat(20 * time.Millisecond)
+	time.Sleep(70 * time.Millisecond)
+	stream.Text("Hello")
+	stream.finish()
+
+	body := w.Body.String()
+	if !strings.HasPrefix(body, ": heartbeat\n\n") {
+		t.Fatalf("body = %q, want heartbeats while nothing was sent", body)
+	}
+	// Once the status went out with a heartbeat, errors become events
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	stream.Error("model unavailable", http.StatusBadGateway)
+	if !strings.Contains(w.Body.String(), "event: error") {
+		t.Fatalf("error after a heartbeat was not an event:\n%s", w.Body)
+	}
+}
+
+func TestHeartbeatSkipsActiveIntervals(t *testing.T) {
+	stream, w := newTestStream("text/event-stream")
+	stream.heartbeat(50 * time.Millisecond)
+	// Writing more often than the interval leaves no room for heartbeats
+	for range 30 {
+		stream.Text("token")
+		time.Sleep(5 * time.Millisecond)
+	}
+	stream.finish()
+	if strings.Contains(w.Body.String(), "heartbeat") {
+		t.Fatalf("heartbeat sent between writes:\n%s", w.Body)
+	}
+}
+
+func TestHeartbeatPlainText(t *testing.T) {
+	stream, w := newTestStream("")
+	stream.heartbeat(10 * time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	stream.Text("Hello")
+	stream.finish()
+	if got := w.Body.String(); got != "Hello" {
+		t.Fatalf("plain text body = %q, want only the reply", got)
+	}
+}
+
+func TestHeartbeatAnnouncesGeneration(t *testing.T) {
+	registry := newGenerationRegistry(generationOptions{ResumeWindow: time.Minute})
+	stream, _ := startGeneration(context.Background(), registry)
+	w := stream.w.(*httptest.ResponseRecorder)
+	stream.heartbeat(10 * time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	stream.finish()
+
+	// Clients learn the generation ID before the first heartbeat
+	if !strings.HasPrefix(w.Body.String(), "id: 1\nevent: generation\ndata: {\"id\":\""+stream.gen.ID+"\"}\n\n: heartbeat") {
+		t.Fatalf("body = %q, want the generation event before the first heartbeat", w.Body)
+	}
+}
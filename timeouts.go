@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// routeTimeouts gives routes their own write deadline in place of the
+// server's WriteTimeout, so long generations are not cut off mid-stream
+type routeTimeouts struct {
+	mux      *http.ServeMux
+	timeouts map[string]time.Duration // By route pattern; zero means no deadline
+}
+
+// parseRouteTimeouts reads "pattern=duration" entries, such as
+// "POST /conversations/{id}/messages/{messageID}/edit=10m"
+func parseRouteTimeouts(mux *http.ServeMux, entries []string) routeTimeouts {
+	t := routeTimeouts{mux: mux, timeouts: make(map[string]time.Duration)}
+	for _, entry := range entries {
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			log.Printf("Ignoring route timeout %q: expected pattern=duration", entry)
+			continue
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(entry[i+1:]))
+		if err != nil || timeout < 0 {
+			log.Printf("Ignoring route timeout %q: invalid duration", entry)
+			continue
+		}
+		t.timeouts[strings.TrimSpace(entry[:i])] = timeout
+	}
+	return t
+}
+
+// wrap sets the write deadline of requests to routes with a timeout
+func (t routeTimeouts) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := t.mux.Handler(r)
+		if timeout, ok := t.timeouts[pattern]; ok {
+			var deadline time.Time
+			if timeout > 0 {
+				deadline = time.Now().Add(timeout)
+			}
+			if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+				log.Printf("Failed to set the write deadline for %s: %v", pattern, err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// countStreamTimeout counts a stream whose write failed because its
+// deadline passed
+func countStreamTimeout(route string, err error) {
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return
+	}
+	streamTimeoutsCounter.WithLabelValues(route).Inc()
+	log.Printf("Stream on %s hit its write deadline", route)
+}
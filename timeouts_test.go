@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRouteTimeouts(t *testing.T) {
+	timeouts := parseRouteTimeouts(http.NewServeMux(), []string{
+		"POST /chat=10m",
+		" GET /generations/{id}/events = 0 ",
+		"POST /conversations/{id}/messages/{messageID}/edit=90s",
+		"POST /summaries",
+		"POST /ingest=soon",
+		"POST /embed=-1s",
+	})
+	want := map[string]time.Duration{
+		"POST /chat":                   10 * time.Minute,
+		"GET /generations/{id}/events": 0,
+		"POST /conversations/{id}/messages/{messageID}/edit": 90 * time.Second,
+	}
+	if len(timeouts.timeouts) != len(want) {
+		t.Fatalf("timeouts = %v, want %v", timeouts.timeouts, want)
+	}
+	for pattern, timeout := range want {
+		if got, ok := timeouts.timeouts[pattern]; !ok || got != timeout {
+			t.Errorf("timeout of %s = %v, want %v", pattern, got, timeout)
+		}
+	}
+}
+
+// slowStream writes a piece, waits past the server's write timeout, then
+// writes another
+func slowStream(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "first ")
+	http.NewResponseController(w).Flush()
+	time.Sleep(150 * time.Millisecond)
+	io.WriteString(w, "second")
+}
+
+func TestRouteTimeoutsWrap(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat", slowStream)
+	mux.HandleFunc("POST /summaries", slowStream)
+	mux.HandleFunc("POST /ingest", slowStream)
+	timeouts := parseRouteTimeouts(mux, []string{"POST /chat=0", "POST /ingest=1m"})
+
+	server := httptest.NewUnstartedServer(timeouts.wrap(mux))
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/chat", "first second"},   // No deadline
+		{"/ingest", "first second"}, // A deadline later than the server's
+		{"/summaries", "first "},    // The server's write timeout cuts the stream
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(server.URL+tt.path, "application/json", nil)
+		if err != nil {
+			t.Fatalf("POST %s: %v", tt.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tt.want {
+			t.Errorf("POST %s = %q, want %q", tt.path, body, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/health"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// errModelMissing means the inference server does not have the model, which
+// retrying will not fix
+var errModelMissing = errors.New("model not found on the inference server")
+
+// warmupOptions configures the startup warm-up
+type warmupOptions struct {
+	Timeout       time.Duration // Give up after this long
+	RetryInterval time.Duration // Wait between attempts while the server is unreachable or loading
+}
+
+// warmUp checks that the default model exists and sends a one-token
+// completion so the inference server loads it before the first chat. It
+// retries until the timeout and marks readiness ready once an attempt
+// succeeds. Every attempt uses the provider current at the time, so a
+// configuration change during warm-up takes effect on the next attempt.
+func warmUp(ctx context.Context, current *atomic.Pointer[provider], opts warmupOptions, readiness *health.Readiness) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		p := current.Load()
+		err := warmUpOnce(ctx, p, p.DefaultModel, readiness)
+		if err == nil {
+			readiness.SetReady()
+			readyGauge.Set(1)
+			return nil
+		}
+		readiness.SetFailed(err)
+		if errors.Is(err, errModelMissing) {
+			return err
+		}
+
+		log.Printf("Warm-up attempt %d failed, retrying in %s: %v", attempt, opts.RetryInterval, err)
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("gave up after %s: %w", opts.Timeout, err)
+			readiness.SetFailed(err)
+			return err
+		case <-time.After(opts.RetryInterval):
+		}
+	}
+}
+
+// warmUpOnce runs one warm-up attempt
+func warmUpOnce(ctx context.Context, p *provider, model string, readiness *health.Readiness) error {
+	readiness.SetPhase("checking_model")
+	if err := checkModel(ctx, p.Client, model); err != nil {
+		return err
+	}
+
+	readiness.SetPhase("warming_up")
+	start := time.Now()
+	_, err := p.Client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
+			openai.UserMessage("Hello"),
+		}),
+		Model:     openai.F(model),
+		MaxTokens: openai.F(int64(1)),
+	})
+	if err != nil {
+		return fmt.Errorf("warm-up completion: %w", err)
+	}
+
+	duration := time.Since(start)
+	modelWarmupDuration.WithLabelValues(model).Set(duration.Seconds())
+	log.Printf("Model %s warmed up in %s", model, duration.Round(time.Millisecond))
+	return nil
+}
+
+// checkModel verifies the inference server lists the model. Servers without
+// a model list are trusted to have it.
+func checkModel(ctx context.Context, client *openai.Client, model string) error {
+	// The caller retries, or runs the check again later
+	pager := client.Models.ListAutoPaging(ctx, option.WithMaxRetries(0))
+	for pager.Next() {
+		if sameModel(pager.Current().ID, model) {
+			return nil
+		}
+	}
+
+	var apiErr *openai.Error
+	switch err := pager.Err(); {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		log.Printf("The inference server has no model list, skipping the check for %s", model)
+		return nil
+	case err != nil:
+		return fmt.Errorf("list models: %w", err)
+	}
+	return fmt.Errorf("%w: %s", errModelMissing, model)
+}
+
+// sameModel compares model names, treating a missing tag as "latest"
+func sameModel(a, b string) bool {
+	withTag := func(name string) string {
+		if strings.LastIndex(name, ":") > strings.LastIndex(name, "/") {
+			return name
+		}
+		return name + ":latest"
+	}
+	return withTag(a) == withTag(b)
+}
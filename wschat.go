@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/middleware"
+	"github.com/ajeetraina/genai-app-demo/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/websocket"
+)
+
+// wsOptions configures the chat WebSocket
+type wsOptions struct {
+	MaxGenerations int           // Generations a connection may run at once
+	WriteTimeout   time.Duration // Close connections that stop reading for this long
+}
+
+// wsMessage is a message on the chat WebSocket, in either direction. Clients
+// send chat, cancel, ping and sampling messages; the server answers with
+// text, event, done, error, cancelled, pong and sampling messages. Messages
+// about a generation carry the ID the client gave it.
+type wsMessage struct {
+	Type     string          `json:"type"`
+	ID       string          `json:"id,omitempty"`
+	Request  json.RawMessage `json:"request,omitempty"`  // chat: the body /chat accepts
+	Sampling *wsSampling     `json:"sampling,omitempty"` // sampling: the session defaults
+	Content  string          `json:"content,omitempty"`  // text: a piece of the reply
+	Event    string          `json:"event,omitempty"`    // event: the name /chat gives the SSE event
+	Data     interface{}     `json:"data,omitempty"`     // event: its payload
+	Message  string          `json:"message,omitempty"`  // error
+	Status   int             `json:"status,omitempty"`   // error: the status /chat would answer with
+}
+
+// wsSampling are sampling parameters a session applies to the chat requests
+// that do not set their own
+type wsSampling struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+// handleWebSocket serves /chat over a WebSocket, for clients behind proxies
+// that buffer SSE. Each chat message runs the /chat handler wrapped by
+// observe, the metrics and tracing middleware, so requests, errors, metrics
+// and tracing are the same; a connection can run several generations at once.
+func (s *chatService) handleWebSocket(cors middleware.CORSConfig, observe func(http.Handler) http.Handler, opts wsOptions) http.Handler {
+	return wsServer(observe(s.handleChat()), cors, opts)
+}
+
+// wsServer runs each chat message of a connection through the chat handler
+func wsServer(chat http.Handler, cors middleware.CORSConfig, opts wsOptions) websocket.Server {
+	return websocket.Server{
+		// Browsers do not apply CORS to WebSockets and send the user's
+		// cookies along, so any page could otherwise chat as the user.
+		// Cross-origin upgrades need their origin listed; "*" does not count.
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			origin := r.Header.Get("Origin")
+			if origin == "" || sameOrigin(origin, r) || cors.ListsOrigin(origin) {
+				return nil
+			}
+			corsRejectedCounter.WithLabelValues("websocket_origin").Inc()
+			return fmt.Errorf("origin %s is not allowed", origin)
+		},
+		Handler: func(conn *websocket.Conn) {
+			// The server's timeouts were meant for the upgrade request
+			conn.SetDeadline(time.Time{})
+			wsConnectionsGauge.Inc()
+			defer wsConnectionsGauge.Dec()
+
+			ctx, cancel := context.WithCancel(conn.Request().Context())
+			session := &wsSession{
+				chat:        chat,
+				conn:        conn,
+				opts:        opts,
+				ctx:         ctx,
+				generations: make(map[string]context.CancelFunc),
+			}
+			session.serve()
+			cancel()
+			session.wg.Wait()
+		},
+	}
+}
+
+// sameOrigin reports whether the origin is the host the request was sent to
+func sameOrigin(origin string, r *http.Request) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// wsSession is one chat WebSocket connection
+type wsSession struct {
+	chat http.Handler
+	conn *websocket.Conn
+	opts wsOptions
+	ctx  context.Context // Cancelled when the connection closes
+
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	generations map[string]context.CancelFunc // By ID
+	sampling    wsSampling
+	wg          sync.WaitGroup
+}
+
+// serve reads the client's messages until the connection closes
+func (ws *wsSession) serve() {
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws.conn, &data); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Closing chat WebSocket: %v", err)
+			}
+			return
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			ws.send(wsMessage{Type: "error", Message: "Invalid message", Status: http.StatusBadRequest})
+			continue
+		}
+		wsMessagesCounter.WithLabelValues("in", msg.Type).Inc()
+
+		switch msg.Type {
+		case "chat":
+			ws.start(msg)
+		case "cancel":
+			ws.mu.Lock()
+			cancel, ok := ws.generations[msg.ID]
+			ws.mu.Unlock()
+			if !ok {
+				ws.send(wsMessage{Type: "error", ID: msg.ID, Message: "Generation not found", Status: http.StatusNotFound})
+				continue
+			}
+			cancel()
+		case "ping":
+			ws.send(wsMessage{Type: "pong", ID: msg.ID})
+		case "sampling":
+			// Generations already running keep the parameters they started with
+			ws.mu.Lock()
+			ws.sampling = wsSampling{}
+			if msg.Sampling != nil {
+				ws.sampling = *msg.Sampling
+			}
+			sampling := ws.sampling
+			ws.mu.Unlock()
+			ws.send(wsMessage{Type: "sampling", Sampling: &sampling})
+		default:
+			ws.send(wsMessage{Type: "error", ID: msg.ID, Message: fmt.Sprintf("Unknown message type %q", msg.Type), Status: http.StatusBadRequest})
+		}
+	}
+}
+
+// start runs a chat request in the background
+func (ws *wsSession) start(msg wsMessage) {
+	fail := func(message string, status int) {
+		ws.send(wsMessage{Type: "error", ID: msg.ID, Message: message, Status: status})
+	}
+	if msg.ID == "" {
+		fail("Chat messages need an id", http.StatusBadRequest)
+		return
+	}
+
+	ws.mu.Lock()
+	_, running := ws.generations[msg.ID]
+	full := len(ws.generations) >= ws.opts.MaxGenerations
+	sampling := ws.sampling
+	if running || full {
+		ws.mu.Unlock()
+		if running {
+			fail("A generation with this id is running", http.StatusConflict)
+		} else {
+			fail(fmt.Sprintf("At most %d generations can run at once", ws.opts.MaxGenerations), http.StatusTooManyRequests)
+		}
+		return
+	}
+	ctx, cancel := context.WithCancel(ws.ctx)
+	ws.generations[msg.ID] = cancel
+	ws.wg.Add(1)
+	ws.mu.Unlock()
+
+	go func() {
+		defer ws.wg.Done()
+		defer func() {
+			ws.mu.Lock()
+			delete(ws.generations, msg.ID)
+			ws.mu.Unlock()
+			cancel()
+		}()
+
+		ctx, span := tracing.StartSpan(ctx, "ws_chat")
+		defer span.End()
+		tracing.AddAttributes(ctx, attribute.String("ws.generation_id", msg.ID))
+
+		body, err := sampling.apply(msg.Request)
+		if err != nil {
+			fail("Invalid request body", http.StatusBadRequest)
+			return
+		}
+		upgrade := ws.conn.Request()
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, upgrade.URL.Path, bytes.NewReader(body))
+		if err != nil {
+			fail("Invalid request", http.StatusBadRequest)
+			return
+		}
+		// Identity and tenant headers come from the upgrade request
+		r.Header = upgrade.Header.Clone()
+		r.Header.Del("Connection")
+		r.Header.Del("Upgrade")
+		r.Header.Set("Content-Type", "application/json")
+		r.RemoteAddr = upgrade.RemoteAddr
+		r.Pattern = upgrade.Pattern
+
+		gen := &wsGeneration{session: ws, ctx: ctx, id: msg.ID, header: make(http.Header)}
+		ws.chat.ServeHTTP(gen, r)
+		gen.finish()
+	}()
+}
+
+// apply fills in the session's sampling parameters the request leaves out
+func (p wsSampling) apply(request json.RawMessage) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(request, &fields); err != nil || fields == nil {
+		return nil, errors.New("request is not a JSON object")
+	}
+	if _, ok := fields["temperature"]; !ok && p.Temperature != nil {
+		fields["temperature"], _ = json.Marshal(*p.Temperature)
+	}
+	if _, ok := fields["seed"]; !ok && p.Seed != nil {
+		fields["seed"], _ = json.Marshal(*p.Seed)
+	}
+	return json.Marshal(fields)
+}
+
+// send writes a message, closing the connection if the client stops reading
+func (ws *wsSession) send(msg wsMessage) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	ws.conn.SetWriteDeadline(time.Now().Add(ws.opts.WriteTimeout))
+	if err := websocket.JSON.Send(ws.conn, msg); err != nil {
+		ws.conn.Close()
+		return err
+	}
+	wsMessagesCounter.WithLabelValues("out", msg.Type).Inc()
+	return nil
+}
+
+// wsGeneration is the response to one chat message. The chat handler writes
+// the reply through it as messages; errors written with http.Error before
+// the reply started become error messages too.
+type wsGeneration struct {
+	session *wsSession
+	ctx     context.Context
+	id      string
+	header  http.Header
+	status  int
+	ended   bool // Whether done or error was sent
+}
+
+// Header implements http.ResponseWriter. Headers are not sent.
+func (g *wsGeneration) Header() http.Header {
+	return g.header
+}
+
+// WriteHeader implements http.ResponseWriter
+func (g *wsGeneration) WriteHeader(status int) {
+	g.status = status
+}
+
+// Write implements http.ResponseWriter
+func (g *wsGeneration) Write(p []byte) (int, error) {
+	if g.status >= http.StatusBadRequest {
+		g.Error(strings.TrimSpace(string(p)), g.status)
+		return len(p), nil
+	}
+	return len(p), g.Text(string(p))
+}
+
+// Text implements chatWriter
+func (g *wsGeneration) Text(content string) error {
+	return g.send(wsMessage{Type: "text", Content: content})
+}
+
+// Event implements chatWriter
+func (g *wsGeneration) Event(name string, data interface{}) error {
+	if name == "done" {
+		err := g.send(wsMessage{Type: "done"})
+		g.ended = err == nil
+		return err
+	}
+	return g.send(wsMessage{Type: "event", Event: name, Data: data})
+}
+
+// Error implements chatWriter
+func (g *wsGeneration) Error(message string, status int) {
+	g.ended = g.send(wsMessage{Type: "error", Message: message, Status: status}) == nil
+}
+
+// send writes a message about the generation. Nothing is sent once it has
+// been cancelled, apart from the cancelled message.
+func (g *wsGeneration) send(msg wsMessage) error {
+	if err := g.ctx.Err(); err != nil {
+		return err
+	}
+	msg.ID = g.id
+	return g.session.send(msg)
+}
+
+// finish tells the client how a generation ended if the handler did not
+func (g *wsGeneration) finish() {
+	switch {
+	case g.ended:
+	case g.ctx.Err() != nil:
+		if g.session.ctx.Err() == nil {
+			g.session.send(wsMessage{Type: "cancelled", ID: g.id})
+		}
+	default:
+		g.session.send(wsMessage{Type: "error", ID: g.id, Message: "The reply ended unexpectedly", Status: http.StatusInternalServerError})
+	}
+}
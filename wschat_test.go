@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajeetraina/genai-app-demo/pkg/middleware"
+	"golang.org/x/net/websocket"
+)
+
+// echoChat stands in for the /chat handler. It echoes the message with the
+// temperature and user it got; "fail" is rejected and "wait" streams a
+// first piece, then waits until the generation is cancelled.
+func echoChat(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message     string   `json:"message"`
+		Temperature *float64 `json:"temperature"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Message == "fail" {
+		http.Error(w, "Model not permitted", http.StatusForbidden)
+		return
+	}
+
+	stream := newChatStream(w, r)
+	if req.Message == "wait" {
+		stream.Text("Thinking")
+		<-r.Context().Done()
+		stream.Text("too late")
+		return
+	}
+	stream.Text("echo: " + req.Message)
+	stream.Event("request", map[string]interface{}{
+		"temperature": req.Temperature,
+		"user":        r.Header.Get("X-User-ID"),
+		"upgrade":     r.Header.Get("Upgrade"),
+	})
+	stream.Done()
+}
+
+func newWSServer(t *testing.T, cors middleware.CORSConfig) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(wsServer(http.HandlerFunc(echoChat), cors, wsOptions{
+		MaxGenerations: 2,
+		WriteTimeout:   time.Second,
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// dialWS connects to the server from the given origin as alice
+func dialWS(server *httptest.Server, origin string) (*websocket.Conn, error) {
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/chat", origin)
+	if err != nil {
+		return nil, err
+	}
+	config.Header = http.Header{"X-User-Id": {"alice"}}
+	return websocket.DialConfig(config)
+}
+
+type wsClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func newWSClient(t *testing.T, server *httptest.Server) *wsClient {
+	t.Helper()
+	conn, err := dialWS(server, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsClient{t: t, conn: conn}
+}
+
+func (c *wsClient) send(msg string) {
+	c.t.Helper()
+	if err := websocket.Message.Send(c.conn, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) receive() wsMessage {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg wsMessage
+	if err := websocket.JSON.Receive(c.conn, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// expect receives a message and checks its type and generation ID
+func (c *wsClient) expect(typ, id string) wsMessage {
+	c.t.Helper()
+	msg := c.receive()
+	if msg.Type != typ || msg.ID != id {
+		c.t.Fatalf("received %+v, want %s for %q", msg, typ, id)
+	}
+	return msg
+}
+
+func TestWebSocketChat(t *testing.T) {
+	client := newWSClient(t, newWSServer(t, middleware.CORSConfig{}))
+
+	client.send(`{"type":"ping","id":"p1"}`)
+	client.expect("pong", "p1")
+
+	client.send(`{"type":"chat","id":"g1","request":{"message":"hello"}}`)
+	if msg := client.expect("text", "g1"); msg.Content != "echo: hello" {
+		t.Fatalf("text = %q", msg.Content)
+	}
+	request := client.expect("event", "g1")
+	data, _ := request.Data.(map[string]interface{})
+	if request.Event != "request" || data["user"] != "alice" || data["upgrade"] != "" || data["temperature"] != nil {
+		t.Fatalf("event = %+v, want the upgrade's identity without its upgrade headers", request)
+	}
+	client.expect("done", "g1")
+
+	// Errors the handler writes before the reply become error messages
+	client.send(`{"type":"chat","id":"g2","request":{"message":"fail"}}`)
+	if msg := client.expect("error", "g2"); msg.Status != http.StatusForbidden || msg.Message != "Model not permitted" {
+		t.Fatalf("error = %+v", msg)
+	}
+}
+
+func TestWebSocketSampling(t *testing.T) {
+	client := newWSClient(t, newWSServer(t, middleware.CORSConfig{}))
+	temperature := func(id, request string) interface{} {
+		t.Helper()
+		client.send(`{"type":"chat","id":"` + id + `","request":` + request + `}`)
+		client.expect("text", id)
+		data, _ := client.expect("event", id).Data.(map[string]interface{})
+		client.expect("done", id)
+		return data["temperature"]
+	}
+
+	client.send(`{"type":"sampling","sampling":{"temperature":0.2}}`)
+	if msg := client.expect("sampling", ""); msg.Sampling == nil || *msg.Sampling.Temperature != 0.2 {
+		t.Fatalf("sampling = %+v", msg)
+	}
+	if got := temperature("a", `{"message":"hi"}`); got != 0.2 {
+		t.Fatalf("temperature = %v, want the session's 0.2", got)
+	}
+	if got := temperature("b", `{"message":"hi","temperature":0.9}`); got != 0.9 {
+		t.Fatalf("temperature = %v, want the request's own 0.9", got)
+	}
+
+	client.send(`{"type":"sampling"}`)
+	client.expect("sampling", "")
+	if got := temperature("c", `{"message":"hi"}`); got != nil {
+		t.Fatalf("temperature = %v, want none after the defaults were cleared", got)
+	}
+}
+
+func TestWebSocketMultiplexAndCancel(t *testing.T) {
+	client := newWSClient(t, newWSServer(t, middleware.CORSConfig{}))
+
+	client.send(`{"type":"chat","id":"slow","request":{"message":"wait"}}`)
+	client.expect("text", "slow")
+
+	// Other generations run while the first one is still going
+	client.send(`{"type":"chat","id":"slow","request":{"message":"wait"}}`)
+	if msg := client.expect("error", "slow"); msg.Status != http.StatusConflict {
+		t.Fatalf("reused id: status = %d, want 409", msg.Status)
+	}
+	client.send(`{"type":"chat","id":"fast","request":{"message":"hi"}}`)
+	client.expect("text", "fast")
+	client.expect("event", "fast")
+	client.expect("done", "fast")
+
+	client.send(`{"type":"chat","id":"slow2","request":{"message":"wait"}}`)
+	client.expect("text", "slow2")
+	client.send(`{"type":"chat","id":"third","request":{"message":"hi"}}`)
+	if msg := client.expect("error", "third"); msg.Status != http.StatusTooManyRequests {
+		t.Fatalf("third generation: status = %d, want 429", msg.Status)
+	}
+
+	// Cancelling one generation leaves the other running, and nothing more
+	// is sent about it
+	client.send(`{"type":"cancel","id":"slow"}`)
+	client.expect("cancelled", "slow")
+	client.send(`{"type":"ping","id":"p"}`)
+	client.expect("pong", "p")
+	client.send(`{"type":"cancel","id":"slow2"}`)
+	client.expect("cancelled", "slow2")
+
+	client.send(`{"type":"cancel","id":"slow"}`)
+	if msg := client.expect("error", "slow"); msg.Status != http.StatusNotFound {
+		t.Fatalf("cancel of a finished generation: status = %d, want 404", msg.Status)
+	}
+}
+
+func TestWebSocketInvalidMessages(t *testing.T) {
+	client := newWSClient(t, newWSServer(t, middleware.CORSConfig{}))
+	tests := []struct {
+		message string
+		id      string
+	}{
+		{`not json`, ""},
+		{`{"type":"chat","request":{"message":"hi"}}`, ""},
+		{`{"type":"chat","id":"g","request":"hi"}`, "g"},
+		{`{"type":"shout","id":"s"}`, "s"},
+	}
+	for _, tt := range tests {
+		client.send(tt.message)
+		if msg := client.expect("error", tt.id); msg.Status != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400", tt.message, msg.Status)
+		}
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	server := newWSServer(t, middleware.CORSConfig{AllowedOrigins: []string{"*", "https://app.example.com"}})
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{server.URL, true},
+		{"https://app.example.com", true},
+		// "*" lets any site read responses, but not chat as the user
+		{"https://evil.test", false},
+	}
+	for _, tt := range tests {
+		conn, err := dialWS(server, tt.origin)
+		if (err == nil) != tt.allowed {
+			t.Errorf("origin %s: err = %v, want allowed %t", tt.origin, err, tt.allowed)
+		}
+		if err == nil {
+			conn.Close()
+		}
+	}
+}
+
+func TestWebSocketObserved(t *testing.T) {
+	// The chat handler runs behind the metrics middleware as in main, and
+	// tracks its generations, so a reply reaches the generation through the
+	// middleware's response writer
+	service := &chatService{generations: newGenerationRegistry(generationOptions{ResumeWindow: time.Minute})}
+	stopped := make(chan struct{})
+	chat := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		stream, r := service.newStream(w, r)
+		defer stream.finish()
+		if req.Message == "wait" {
+			stream.Text("Thinking")
+			<-r.Context().Done()
+			close(stopped)
+			return
+		}
+		stream.Text("echo: " + req.Message)
+		stream.Event("citations", []string{"doc-1"})
+		stream.Done()
+	})
+	observe := middleware.MetricsMiddleware(requestCounter, requestDuration, activeRequests)
+	server := httptest.NewServer(wsServer(observe(chat), middleware.CORSConfig{}, wsOptions{
+		MaxGenerations: 2,
+		WriteTimeout:   time.Second,
+	}))
+	defer server.Close()
+	client := newWSClient(t, server)
+
+	client.send(`{"type":"chat","id":"g1","request":{"message":"hi"}}`)
+	client.expect("text", "g1")
+	if msg := client.expect("event", "g1"); msg.Event != "citations" {
+		t.Fatalf("event = %+v, want citations", msg)
+	}
+	client.expect("done", "g1")
+	// Nothing follows the end of the reply
+	client.send(`{"type":"ping","id":"p"}`)
+	client.expect("pong", "p")
+
+	// Cancelling stops the generation rather than leaving it to run on
+	client.send(`{"type":"chat","id":"g2","request":{"message":"wait"}}`)
+	client.expect("text", "g2")
+	client.send(`{"type":"cancel","id":"g2"}`)
+	client.expect("cancelled", "g2")
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("cancelled generation kept running")
+	}
+}